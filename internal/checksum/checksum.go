@@ -0,0 +1,66 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package checksum implements the digests used to verify snapshot transfers.
+package checksum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strings"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
+)
+
+// Supported algorithms.
+const (
+	SHA256 = "sha256"
+	BLAKE3 = "blake3"
+	XXH3   = "xxh3" // 64-bit
+)
+
+// Algorithms lists the supported algorithms.
+var Algorithms = []string{SHA256, BLAKE3, XXH3}
+
+// New returns a hash computing the given algorithm, or nil if unsupported.
+func New(algo string) hash.Hash {
+	switch algo {
+	case SHA256:
+		return sha256.New()
+	case BLAKE3:
+		return blake3.New()
+	case XXH3:
+		return xxh3.New()
+	default:
+		return nil
+	}
+}
+
+// Supported returns whether the algorithm is supported.
+func Supported(algo string) bool {
+	return New(algo) != nil
+}
+
+// Format formats a digest as "<algorithm>:<hex digest>".
+func Format(algo string, sum []byte) string {
+	return algo + ":" + hex.EncodeToString(sum)
+}
+
+// Algorithm returns the algorithm of a checksum formatted by Format.
+func Algorithm(checksum string) string {
+	algo, _, _ := strings.Cut(checksum, ":")
+	return algo
+}
@@ -0,0 +1,40 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package checksum
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	for algo, expected := range map[string]string{
+		SHA256: "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		BLAKE3: "blake3:ea8f163db38682925e4491c5e58d4bb3506ef8c14eb78a86e908c5624a67200f",
+		XXH3:   "xxh3:9555e8555c62dcfd",
+	} {
+		t.Run(algo, func(t *testing.T) {
+			hash := New(algo)
+			require.NotNil(t, hash)
+			_, _ = hash.Write([]byte("hello"))
+			assert.Equal(t, expected, Format(algo, hash.Sum(nil)))
+			assert.Equal(t, algo, Algorithm(expected))
+		})
+	}
+	assert.Nil(t, New("md5"))
+	assert.False(t, Supported("md5"))
+}
@@ -0,0 +1,294 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.blockdaemon.com/solana/cluster-manager/internal/checksum"
+	"go.blockdaemon.com/solana/cluster-manager/internal/fetch"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// clients holds the API clients of the fetch command.
+// In watch mode, they are reused across fetches to keep connections alive.
+type clients struct {
+	log         *zap.Logger
+	tlsConfig   *tls.Config
+	tracker     *fetch.TrackerClient // nil if --from is set
+	from        *fetch.SidecarClient // only set if --from is set
+	rateLimiter *rate.Limiter
+
+	lock     sync.Mutex
+	sidecars map[string]*fetch.SidecarClient
+	progress *fetchProgress // of the download in progress, if any
+}
+
+// fetchProgress tracks the download of a single fetch.
+type fetchProgress struct {
+	ctx              context.Context
+	bars             *progressBars            // nil if disabled
+	aggregate        *fetch.AggregateProgress // nil if disabled
+	bytesTransferred atomic.Uint64
+}
+
+func newClients(log *zap.Logger) (*clients, error) {
+	if verifyAlgo != "" && !checksum.Supported(verifyAlgo) {
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s", verifyAlgo)
+	}
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	c := &clients{
+		log:       log,
+		tlsConfig: tlsConfig,
+		sidecars:  make(map[string]*fetch.SidecarClient),
+	}
+	if maxBytesPerSec > 0 {
+		c.rateLimiter = fetch.NewByteRateLimiter(maxBytesPerSec)
+	}
+
+	if createIfMissing && fromTarget == "" {
+		return nil, fmt.Errorf("--create-if-missing requires --from")
+	}
+	if fromTarget != "" {
+		if trackerURL != "" {
+			return nil, fmt.Errorf("--from and --tracker are mutually exclusive")
+		}
+		if requestToken == "" {
+			requestToken = os.Getenv("SOLANA_SNAPSHOT_REQUEST_TOKEN")
+		}
+		c.from = fetch.NewSidecarClientWithOpts(sidecarURL(fromTarget, tlsConfig), fetch.SidecarClientOpts{
+			PathPrefix:            sidecarPrefix,
+			TLSConfig:             tlsConfig,
+			DialTimeout:           requestTimeout,
+			ResponseHeaderTimeout: requestTimeout,
+			DisableHTTP2:          forceHTTP1,
+			RequestToken:          requestToken,
+		})
+		return c, nil
+	}
+
+	if manifestKey == "" {
+		manifestKey = os.Getenv("SOLANA_TRACKER_MANIFEST_KEY")
+	}
+	opts := fetch.TrackerClientOpts{
+		DialTimeout:           requestTimeout,
+		ResponseHeaderTimeout: requestTimeout,
+		Timeout:               trackerTimeout,
+		Retries:               trackerRetries,
+	}
+	if manifestKey != "" {
+		opts.ManifestKey = []byte(manifestKey)
+	}
+	c.tracker = fetch.NewTrackerClientWithOpts(opts, strings.Split(trackerURL, ",")...)
+	if tlsConfig != nil {
+		c.tracker.SetTLSConfig(tlsConfig)
+	}
+	if trackerToken == "" {
+		trackerToken = os.Getenv("SOLANA_TRACKER_TOKEN")
+	}
+	if trackerToken != "" {
+		c.tracker.SetAuthToken(trackerToken)
+	}
+	c.tracker.SetMaxAge(maxInfoAge)
+	return c, nil
+}
+
+// getRemoteSnapshots lists snapshots available for download, best first.
+//
+// Snapshots are listed by the tracker, or by a single sidecar if --from is set.
+// If base is set, the tracker is asked for incremental snapshots based on it only.
+// Otherwise, the tracker returns up to count snapshots, -1 for as many as it allows.
+func (c *clients) getRemoteSnapshots(ctx context.Context, base *types.SnapshotFile, count int) ([]types.SnapshotSource, error) {
+	ctx, cancel := context.WithTimeout(ctx, trackerTimeout)
+	defer cancel()
+	if c.from == nil && base != nil {
+		return c.tracker.GetSnapshotsForBase(ctx, base.Slot)
+	}
+	if c.from == nil {
+		return c.tracker.GetBestSnapshots(ctx, count)
+	}
+	infos, err := c.from.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]types.SnapshotSource, len(infos))
+	for i, info := range infos {
+		sources[i] = types.SnapshotSource{
+			SnapshotInfo: *info,
+			Target:       fromTarget,
+			UpdatedAt:    time.Now(),
+		}
+	}
+	return sources, nil
+}
+
+// snapshotRequestPollInterval is the time between checks whether a requested snapshot is ready.
+const snapshotRequestPollInterval = 5 * time.Second
+
+// getPinnedSnapshots lists the sources of the pinned snapshot, and of the snapshots it is based on.
+// The other snapshots listed are only needed to complete incremental snapshot chains, see fetch.CompleteChain.
+func (c *clients) getPinnedSnapshots(ctx context.Context, pin *fetch.Pin) ([]types.SnapshotSource, error) {
+	if c.from != nil || pin.Slot == 0 {
+		// Without a slot, the pinned snapshot has to be among the best ones.
+		return c.getRemoteSnapshots(ctx, nil, -1)
+	}
+	ctx, cancel := context.WithTimeout(ctx, trackerTimeout)
+	defer cancel()
+	snaps, err := c.tracker.GetBestSnapshotsInRange(ctx, -1, pin.Slot, pin.Slot)
+	if err != nil {
+		return nil, err
+	}
+	bases := make(map[uint64]bool)
+	for _, snap := range snaps {
+		if n := len(snap.Files); n > 0 && snap.Files[n-1].BaseSlot != 0 {
+			bases[snap.Files[n-1].BaseSlot] = true
+		}
+	}
+	for baseSlot := range bases {
+		baseSnaps, err := c.tracker.GetBestSnapshotsInRange(ctx, -1, baseSlot, baseSlot)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, baseSnaps...)
+	}
+	return snaps, nil
+}
+
+// createSnapshot asks the --from sidecar for a snapshot at or after the given slot,
+// and waits until it is available.
+func (c *clients) createSnapshot(ctx context.Context, log *zap.Logger, slot uint64) error {
+	req, err := c.from.RequestSnapshot(ctx, slot)
+	if err != nil {
+		return fmt.Errorf("failed to request snapshot: %w", err)
+	}
+	log.Info("Requested snapshot, waiting until ready",
+		zap.String("snapshot_request_id", req.ID),
+		zap.Uint64("slot", slot))
+	ticker := time.NewTicker(snapshotRequestPollInterval)
+	defer ticker.Stop()
+	for {
+		switch req.Status {
+		case types.SnapshotRequestReady:
+			log.Info("Requested snapshot ready", zap.String("snapshot", req.File.FileName))
+			return nil
+		case types.SnapshotRequestFailed:
+			return fmt.Errorf("snapshot request failed: %s", req.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("requested snapshot not ready: %w", ctx.Err())
+		case <-ticker.C:
+		}
+		if req, err = c.from.GetSnapshotRequest(ctx, req.ID); err != nil {
+			return fmt.Errorf("failed to check snapshot request: %w", err)
+		}
+	}
+}
+
+// setProgress sets the progress tracker of the download in progress.
+func (c *clients) setProgress(progress *fetchProgress) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.progress = progress
+}
+
+func (c *clients) currentProgress() *fetchProgress {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.progress
+}
+
+// sidecar returns the client downloading from the given sidecar, creating it on first use.
+func (c *clients) sidecar(target string) *fetch.SidecarClient {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if client, ok := c.sidecars[target]; ok {
+		return client
+	}
+	host := target
+	// Targets reported by the tracker are RPC addresses, --from already names the sidecar.
+	if sidecarPort != 0 && c.from == nil {
+		host = fetch.ReplacePort(target, strconv.Itoa(int(sidecarPort)))
+	}
+	var client *fetch.SidecarClient
+	client = fetch.NewSidecarClientWithOpts(sidecarURL(host, c.tlsConfig), fetch.SidecarClientOpts{
+		PathPrefix: sidecarPrefix,
+		ProxyReaderFunc: func(name string, size int64, rd io.Reader) io.ReadCloser {
+			progress := c.currentProgress()
+			if progress == nil {
+				return io.NopCloser(rd)
+			}
+			rd = &countingReader{rd: rd, n: &progress.bytesTransferred}
+			if progress.bars == nil {
+				return io.NopCloser(rd)
+			}
+			return progress.bars.proxyReader(name, size, rd)
+		},
+		ProgressFunc: func(name string, downloaded, total int64) {
+			if progress := c.currentProgress(); progress != nil && progress.aggregate != nil {
+				progress.aggregate.Report(name, downloaded, total)
+			}
+		},
+		QueueFunc: func(name string) {
+			if progress := c.currentProgress(); progress != nil && progress.bars != nil {
+				progress.bars.queue(name, func() (int64, error) {
+					return client.StatSnapshotFile(progress.ctx, name)
+				})
+			}
+		},
+		VerifyDownload:  verifyDownload,
+		VerifyAlgorithm: verifyAlgo,
+		MaxConcurrent:   maxConcurrent,
+		RateLimiter:     c.rateLimiter,
+		Retries:         retries,
+		RetryBaseDelay:  retryBaseDelay,
+		Decompress:      decompress,
+		WireCompression: wireCompress,
+		TLSConfig:       c.tlsConfig,
+		// Only cap the time until the download starts, large files take a while.
+		DialTimeout:           requestTimeout,
+		ResponseHeaderTimeout: headerTimeout,
+		DisableHTTP2:          forceHTTP1,
+		Log:                   c.log,
+	})
+	c.sidecars[target] = client
+	return client
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	rd io.Reader
+	n  *atomic.Uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.rd.Read(p)
+	c.n.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configEnvPrefix prefixes environment variables setting flags, e.g. $SOLANA_FETCH_LEDGER for --ledger.
+const configEnvPrefix = "SOLANA_FETCH_"
+
+// alternativeFlags are flags setting the same value as another flag.
+// A config value is ignored if its alternative is set explicitly.
+var alternativeFlags = map[string]string{
+	"min-slots": "min-age",
+	"min-age":   "min-slots",
+	"max-slots": "max-age",
+	"max-age":   "max-slots",
+}
+
+// loadConfig sets flags not given on the command line from the environment, then from the config file.
+// The config file is set by --config or $SOLANA_FETCH_CONFIG.
+//
+// The config file maps flag names to values, e.g. "ledger: /mnt/ledger".
+// Lists like source-allow may be given as YAML sequences.
+func loadConfig(flags *pflag.FlagSet) error {
+	explicit := make(map[string]bool)
+	flags.Visit(func(flag *pflag.Flag) {
+		explicit[flag.Name] = true
+	})
+
+	path := configPath
+	if path == "" {
+		path = os.Getenv(configEnvPrefix + "CONFIG")
+	}
+	values := make(map[string]string)
+	if path != "" {
+		var err error
+		values, err = readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		if _, ok := values["config"]; ok {
+			return fmt.Errorf("config files can't include other config files")
+		}
+	}
+	flags.VisitAll(func(flag *pflag.Flag) {
+		envName := configEnvPrefix + strings.ToUpper(strings.ReplaceAll(flag.Name, "-", "_"))
+		if value := os.Getenv(envName); value != "" && flag.Name != "config" {
+			values[flag.Name] = value
+		}
+	})
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("unknown option in config: %s", name)
+		}
+		if explicit[name] || explicit[alternativeFlags[name]] {
+			continue
+		}
+		if err := flags.Set(name, values[name]); err != nil {
+			return fmt.Errorf("invalid config value for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// readConfigFile reads flag values from a YAML file.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var raw map[string]interface{}
+	if err := yaml.NewDecoder(f).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch value := value.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("invalid config file %s: %s must not be a map", path, name)
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
@@ -17,21 +17,28 @@ package fetch
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
-	"io"
-	"net/http"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/gagliardetto/solana-go"
 	"github.com/spf13/cobra"
-	"github.com/vbauerster/mpb/v7"
-	"github.com/vbauerster/mpb/v7/decor"
+	"github.com/spf13/pflag"
+	"go.blockdaemon.com/solana/cluster-manager/internal/checksum"
 	"go.blockdaemon.com/solana/cluster-manager/internal/fetch"
 	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
 	"go.blockdaemon.com/solana/cluster-manager/internal/logger"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
 	"gopkg.in/resty.v1"
 )
 
@@ -39,117 +46,720 @@ var Cmd = cobra.Command{
 	Use:   "fetch",
 	Short: "Snapshot downloader",
 	Long:  "Fetches a snapshot from another node using the tracker API.",
-	Run: func(_ *cobra.Command, _ []string) {
-		run()
+	Run: func(cmd *cobra.Command, _ []string) {
+		run(cmd.Flags())
 	},
 }
 
 var (
 	ledgerDir       string
+	stagingRoot     string
 	trackerURL      string
+	trackerToken    string
+	manifestKey     string
 	minSnapAge      uint64
 	maxSnapAge      uint64
 	requestTimeout  time.Duration
+	trackerTimeout  time.Duration
+	headerTimeout   time.Duration
 	downloadTimeout time.Duration
+	deadline        time.Duration
+	verifyDownload  bool
+	maxConcurrent   int
+	maxBytesPerSec  int64
+	retries         int
+	retryBaseDelay  time.Duration
+	dryRun          bool
+	outputFormat    string
+	decompress      bool
+	wireCompress    bool
+	prune           bool
+	keepSnaps       int
+	tlsCertFile     string
+	tlsKeyFile      string
+	tlsCAFile       string
+	minVersion      string
+	fromTarget      string
+	listSnaps       bool
+	maxInfoAge      time.Duration
+	multiSource     bool
+	policyName      string
+	maxNodeLag      uint64
+	trackerRetries  int
+	numCandidates   int
+	pinSlot         uint64
+	pinHash         string
+	snapshotSubdir  string
+	alertWebhook    string
+	expectedGenesis string
+	forceHTTP1      bool
+	sourceAllow     []string
+	sourceDeny      []string
+	watch           bool
+	watchInterval   time.Duration
+	statusListen    string
+	tieBreakName    string
+	incrOnly        bool
+	slotSubdir      bool
+	sidecarPrefix   string
+	sidecarPort     uint16
+	lockTimeout     time.Duration
+	minSnapAgeTime  time.Duration
+	maxSnapAgeTime  time.Duration
+	slotTime        time.Duration
+	verifyAlgo      string
+	configPath      string
+	maxTotalBytes   uint64
+	createIfMissing bool
+	requestToken    string
 )
 
+// exitLocked is the exit code if another fetch holds the lock on the ledger dir (EX_TEMPFAIL).
+const exitLocked = 75
+
+// exitDeadline is the exit code if the fetch is canceled by --deadline, as used by timeout(1).
+const exitDeadline = 124
+
 func init() {
 	flags := Cmd.Flags()
+	flags.StringVar(&configPath, "config", "", "Path to YAML file setting flags by name, overridden by $SOLANA_FETCH_<FLAG> and flags (default: $SOLANA_FETCH_CONFIG)")
 	flags.StringVar(&ledgerDir, "ledger", "", "Path to ledger dir")
-	flags.StringVar(&trackerURL, "tracker", "", "Download as instructed by given tracker URL")
+	flags.StringVar(&snapshotSubdir, "snapshot-subdir", "", "Subdir of the ledger dir holding snapshots (default: ledger dir)")
+	flags.BoolVar(&slotSubdir, "slot-subdir", false, "Download each snapshot into a subdir of the snapshot dir named after its slot")
+	flags.StringVar(&stagingRoot, "staging-dir", "", "Path to dir holding incomplete downloads (default: snapshot dir)")
+	flags.StringVar(&trackerURL, "tracker", "", "Download as instructed by given tracker URL (comma-separated list for failover)")
+	flags.StringVar(&trackerToken, "tracker-token", "", "Bearer token for tracker API (default: $SOLANA_TRACKER_TOKEN)")
+	flags.StringVar(&manifestKey, "manifest-key", "", "Key tracker manifests must be signed with in watch mode (default: $SOLANA_TRACKER_MANIFEST_KEY)")
 	flags.Uint64Var(&minSnapAge, "min-slots", 500, "Download only snapshots <n> slots newer than local")
+	flags.DurationVar(&minSnapAgeTime, "min-age", 0, "Download only snapshots this much newer than local, converted to slots (alternative to --min-slots)")
+	flags.DurationVar(&maxInfoAge, "max-info-age", 5*time.Minute, "Skip snapshots the tracker hasn't seen in this long (0 to disable)")
+	flags.Uint64Var(&pinSlot, "pin-slot", 0, "Download exactly the snapshot at this slot instead of the best one, failing if unavailable")
+	flags.StringVar(&pinHash, "pin-hash", "", "Download exactly the snapshot with this hash instead of the best one, failing if unavailable")
 	flags.Uint64Var(&maxSnapAge, "max-slots", 10000, "Refuse to download <n> slots older than the newest")
-	flags.DurationVar(&requestTimeout, "request-timeout", 3*time.Second, "Max time to wait for headers (excluding download)")
+	flags.DurationVar(&maxSnapAgeTime, "max-age", 0, "Refuse to download snapshots this much older than the newest, converted to slots (alternative to --max-slots)")
+	flags.DurationVar(&slotTime, "slot-time", fetch.DefaultSlotTime, "Approximate time per slot, to convert --min-age and --max-age to slots")
+	flags.StringVar(&policyName, "policy", "newest", "Snapshot selection policy ("+strings.Join(fetch.PolicyNames, ", ")+")")
+	flags.Uint64Var(&maxNodeLag, "max-node-lag", fetch.DefaultMaxNodeLag, "Skip sources whose node lags the newest node by more slots with --policy caught-up")
+	flags.StringVar(&tieBreakName, "tie-break", "hostname", "How to pick among nodes offering the same snapshot ("+strings.Join(fetch.TieBreakNames, ", ")+")")
+	flags.DurationVar(&requestTimeout, "request-timeout", 3*time.Second, "Max time to connect and wait for headers of API requests")
+	flags.DurationVar(&trackerTimeout, "tracker-timeout", 10*time.Second, "Max time for a tracker request in total")
+	flags.IntVar(&trackerRetries, "tracker-retries", 3, "Number of times to retry a failed tracker request")
+	flags.IntVar(&numCandidates, "candidates", 5, "Number of best snapshots to request from the tracker, leaving sources to fail over to (-1 for as many as the tracker returns)")
+	flags.DurationVar(&headerTimeout, "download-header-timeout", 10*time.Second, "Max time to wait for headers when starting a file download")
 	flags.DurationVar(&downloadTimeout, "download-timeout", 10*time.Minute, "Max time to try downloading in total")
+	flags.DurationVar(&deadline, "deadline", 0, "Max time for the whole fetch including waiting for the lock, exits with code 124 if exceeded (0 for none)")
+	flags.BoolVar(&verifyDownload, "verify", false, "Verify integrity of downloaded snapshots")
+	flags.StringVar(&verifyAlgo, "verify-algo", "", "Checksum algorithm requested from sidecars with --verify, checking only the size if unavailable ("+strings.Join(checksum.Algorithms, ", ")+") (default: chosen by sidecar)")
+	flags.BoolVar(&multiSource, "multi-source", false, "Download parts of each file from all nodes offering the same snapshot in parallel")
+	flags.IntVar(&maxConcurrent, "max-concurrent", 4, "Max number of files to download simultaneously (0 for unlimited)")
+	flags.Int64Var(&maxBytesPerSec, "max-bytes-per-sec", 0, "Max combined download speed in bytes per second (0 for unlimited)")
+	flags.IntVar(&retries, "retries", 3, "Number of times to retry a failed file download")
+	flags.DurationVar(&retryBaseDelay, "retry-base-delay", time.Second, "Delay before first retry, doubles with each attempt")
+	flags.DurationVar(&lockTimeout, "lock-timeout", 0, "Max time to wait for another fetch using the ledger dir to finish (0 to fail immediately)")
+	flags.Uint64Var(&maxTotalBytes, "max-total-bytes", 0, "Refuse snapshots larger than <n> bytes in total, including the full snapshot of an incremental (0 for unlimited)")
+	flags.BoolVar(&dryRun, "dry-run", false, "Show which snapshot would be downloaded, without downloading")
+	flags.StringVar(&outputFormat, "output", "", "Print a summary instead of logs (json)")
+	flags.BoolVar(&decompress, "decompress", false, "Decompress zstd, bzip2 and gzip snapshots while downloading")
+	flags.BoolVar(&wireCompress, "wire-compression", false, "Ask sidecars to compress uncompressed snapshots with zstd for the transfer")
+	flags.BoolVar(&prune, "prune", false, "Delete old snapshots after a successful download")
+	flags.IntVar(&keepSnaps, "keep", 2, "Number of full snapshots to keep when pruning")
+	flags.BoolVar(&incrOnly, "incremental-only", false, "Download only an incremental snapshot based on the newest local full snapshot")
+	flags.StringVar(&expectedGenesis, "expected-genesis", "", "Download only snapshots from the cluster with this genesis hash (default: hash of genesis.bin in ledger dir)")
+	flags.StringSliceVar(&sourceAllow, "source-allow", nil, "Download only from sidecars matching these hosts or CIDRs (repeatable)")
+	flags.StringSliceVar(&sourceDeny, "source-deny", nil, "Never download from sidecars matching these hosts or CIDRs, even if allowed (repeatable)")
+	flags.StringVar(&minVersion, "min-version", "", "Download only snapshots from nodes running at least this Solana version")
+	flags.StringVar(&fromTarget, "from", "", "Download directly from the sidecar at <host:port>, bypassing the tracker")
+	flags.StringVar(&sidecarPrefix, "sidecar-prefix", "", "Path prefix of the sidecar API, for sidecars behind a path-based reverse proxy")
+	flags.Uint16Var(&sidecarPort, "sidecar-port", 0, "Connect to sidecars reported by the tracker on this port, replacing the reported port")
+	flags.BoolVar(&createIfMissing, "create-if-missing", false, "Ask the --from sidecar to create a snapshot if it has none newer than local, and wait for it")
+	flags.StringVar(&requestToken, "snapshot-request-token", "", "Bearer token for --create-if-missing (default: $SOLANA_SNAPSHOT_REQUEST_TOKEN)")
+	flags.BoolVar(&listSnaps, "list", false, "List snapshots offered by the --from host and exit")
+	flags.StringVar(&alertWebhook, "alert-webhook", "", "POST a JSON alert to this URL if the local snapshot is more than max-slots behind and can't be fetched")
+	flags.BoolVar(&watch, "watch", false, "Keep running and fetch every --interval")
+	flags.DurationVar(&watchInterval, "interval", 5*time.Minute, "Time to wait between fetches in watch mode")
+	flags.StringVar(&statusListen, "status-listen", "", "Serve the last fetch result on /status at this address in watch mode")
+	flags.BoolVar(&forceHTTP1, "http1", false, "Use HTTP/1.1 for sidecar requests, even if the server supports HTTP/2")
+	flags.StringVar(&tlsCertFile, "tls-cert", "", "Path to TLS client certificate")
+	flags.StringVar(&tlsKeyFile, "tls-key", "", "Path to TLS client key")
+	flags.StringVar(&tlsCAFile, "tls-ca", "", "Path to CA certificate for verifying servers")
+	flags.AddFlagSet(logger.Flags)
 }
 
-func run() {
-	log := logger.GetConsoleLogger()
+func run(flags *pflag.FlagSet) {
+	// Sets flags affecting everything below, including the logger.
+	cobra.CheckErr(loadConfig(flags))
 
-	// Regardless which API we talk to, we want to cap time from request to response header.
-	// This defends against black holes and really slow servers.
-	// Download time (reading response body) is not affected.
-	http.DefaultTransport.(*http.Transport).ResponseHeaderTimeout = requestTimeout
+	var log *zap.Logger
+	if outputFormat == "json" {
+		log = zap.NewNop()
+	} else {
+		log = logger.GetLogger()
+	}
 
-	// Run until interrupted or time out occurs.
+	// Run until interrupted or terminated.
 	ctx := context.Background()
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer cancel()
-	ctx, cancel2 := context.WithTimeout(ctx, downloadTimeout)
-	defer cancel2()
+	// Keeps a stalled fetch from overlapping the next scheduled run.
+	if deadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+
+	if listSnaps {
+		listCtx, cancelList := context.WithTimeout(ctx, downloadTimeout)
+		defer cancelList()
+		cobra.CheckErr(runList(listCtx, log))
+		return
+	}
+
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		log.Warn("Failed to set up tracing", zap.Error(err))
+	}
+
+	res := new(result)
+	var c *clients
+	err = resolveSlotThresholds(flags)
+	if err == nil && watch && deadline > 0 {
+		err = fmt.Errorf("--deadline and --watch are mutually exclusive")
+	}
+	if err == nil {
+		c, err = newClients(log)
+	}
+	var lock *fetch.DirLock
+	if err == nil && !dryRun {
+		// Concurrent fetches would overwrite each other's files.
+		if lockTimeout > 0 {
+			log.Info("Acquiring lock on ledger dir", zap.Duration("lock_timeout", lockTimeout))
+		}
+		lock, err = fetch.LockDir(ctx, ledgerDir, lockTimeout)
+	}
+	if err == nil {
+		if watch {
+			err = runWatch(ctx, log, c)
+		} else {
+			res, err = fetchOnce(ctx, log, c)
+		}
+	} else {
+		res.Error = err.Error()
+	}
+	if lock != nil {
+		if err := lock.Unlock(); err != nil {
+			log.Warn("Failed to release lock on ledger dir", zap.Error(err))
+		}
+	}
+
+	// Flush spans before exiting, os.Exit skips deferred calls.
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(flushCtx); err != nil {
+		log.Warn("Failed to flush traces", zap.Error(err))
+	}
+	cancelFlush()
+
+	if outputFormat == "json" && !watch {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		cobra.CheckErr(enc.Encode(res))
+	} else if err != nil {
+		log.Error("Fetch failed", zap.Error(err))
+		_ = log.Sync()
+	}
+	if errors.Is(err, fetch.ErrLocked) {
+		os.Exit(exitLocked)
+	} else if err != nil && deadline > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		os.Exit(exitDeadline)
+	} else if err != nil {
+		os.Exit(1)
+	}
+}
+
+// resolveSlotThresholds converts the duration forms of slot thresholds to slots.
+func resolveSlotThresholds(flags *pflag.FlagSet) error {
+	for _, threshold := range []struct {
+		slotsFlag, ageFlag string
+		slots              *uint64
+		age                time.Duration
+	}{
+		{"min-slots", "min-age", &minSnapAge, minSnapAgeTime},
+		{"max-slots", "max-age", &maxSnapAge, maxSnapAgeTime},
+	} {
+		if !flags.Changed(threshold.ageFlag) {
+			continue
+		}
+		if flags.Changed(threshold.slotsFlag) {
+			return fmt.Errorf("--%s and --%s are mutually exclusive", threshold.slotsFlag, threshold.ageFlag)
+		}
+		*threshold.slots = fetch.SlotsIn(threshold.age, slotTime)
+	}
+	return nil
+}
+
+// fetchOnce checks for a newer snapshot and downloads it, within the download timeout.
+func fetchOnce(ctx context.Context, log *zap.Logger, c *clients) (*result, error) {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	// Lets sidecar access logs be correlated with this fetch.
+	requestID := fetch.NewRequestID()
+	ctx = fetch.WithRequestID(ctx, requestID)
+	log = log.With(zap.String("request_id", requestID))
+
+	start := time.Now()
+	res := &result{RequestID: requestID}
+	spanCtx, span := otel.Tracer("go.blockdaemon.com/solana/cluster-manager/internal/cmd/fetch").Start(ctx, "fetch")
+	err := runFetch(spanCtx, log, c, res)
+	span.SetAttributes(
+		attribute.String("advice", res.Advice),
+		attribute.Int64("slot", int64(res.Slot)),
+		attribute.Int64("bytes_transferred", int64(res.BytesTransferred)))
+	span.End()
+	res.Duration = time.Since(start).Seconds()
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if alertWebhook != "" && !dryRun {
+		sendAlert(log, res, err)
+	}
+	return res, err
+}
+
+// result summarizes a fetch for machine-readable output.
+type result struct {
+	Advice           string   `json:"advice"`
+	Reason           string   `json:"reason,omitempty"`
+	Target           string   `json:"target,omitempty"`
+	Slot             uint64   `json:"slot,omitempty"`
+	Hash             string   `json:"hash,omitempty"`
+	Files            []string `json:"files,omitempty"`
+	Dir              string   `json:"dir,omitempty"` // dir holding the files
+	BytesTransferred uint64   `json:"bytes_transferred"`
+	Duration         float64  `json:"duration_seconds"`
+	Error            string   `json:"error,omitempty"`
+	RequestID        string   `json:"request_id"`
+	// Report breaks down the download by file.
+	Report *fetch.DownloadReport `json:"report,omitempty"`
+
+	advice fetch.Advice
+	reason *fetch.AdviceReason // nil if failed before checking advice
+}
+
+// loadTLSConfig loads client certificates used to talk to tracker and sidecars.
+// Returns nil if no TLS flags are set.
+func loadTLSConfig() (*tls.Config, error) {
+	if tlsCertFile == "" && tlsKeyFile == "" && tlsCAFile == "" {
+		return nil, nil
+	}
+	tlsConfig, err := (&types.TLSConfig{
+		CAFile:   tlsCAFile,
+		CertFile: tlsCertFile,
+		KeyFile:  tlsKeyFile,
+	}).Build()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS config: %w", err)
+	}
+	return tlsConfig, nil
+}
+
+// sidecarURL returns the URL of a sidecar, defaulting to HTTPS if TLS is configured.
+func sidecarURL(target string, tlsConfig *tls.Config) string {
+	if tlsConfig != nil && !strings.Contains(target, "://") {
+		return "https://" + fetch.TargetHost(target)
+	}
+	return fetch.TargetURL(target)
+}
+
+// runList prints the snapshots offered by a single sidecar.
+func runList(ctx context.Context, log *zap.Logger) error {
+	if fromTarget == "" {
+		return fmt.Errorf("--list requires --from")
+	}
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		return err
+	}
+	client := fetch.NewSidecarClientWithOpts(sidecarURL(fromTarget, tlsConfig), fetch.SidecarClientOpts{
+		PathPrefix:            sidecarPrefix,
+		TLSConfig:             tlsConfig,
+		DialTimeout:           requestTimeout,
+		ResponseHeaderTimeout: requestTimeout,
+		DisableHTTP2:          forceHTTP1,
+		Log:                   log,
+	})
+	infos, err := client.ListSnapshots(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	if outputFormat == "json" {
+		if infos == nil {
+			infos = make([]*types.SnapshotInfo, 0)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		return enc.Encode(infos)
+	}
+	if len(infos) == 0 {
+		log.Info("No snapshots available", zap.String("target", fromTarget))
+	}
+	for _, info := range infos {
+		log.Info("Snapshot",
+			zap.Uint64("slot", info.Slot),
+			zap.Stringer("hash", info.Hash),
+			zap.Uint64("total_size", info.TotalSize),
+			zap.Int("num_files", len(info.Files)))
+	}
+	return nil
+}
+
+func runFetch(ctx context.Context, log *zap.Logger, c *clients, res *result) error {
+	policy, err := fetch.ParsePolicy(policyName)
+	if err != nil {
+		return err
+	}
+	if caughtUp, ok := policy.(fetch.CaughtUpPolicy); ok {
+		caughtUp.MaxLag = maxNodeLag
+		policy = caughtUp
+	}
+	sourceFilter, err := fetch.NewSourceFilter(sourceAllow, sourceDeny)
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	tieBreaker, err := fetch.ParseTieBreak(tieBreakName, hostname)
+	if err != nil {
+		return err
+	}
+	if numCandidates == 0 || numCandidates < -1 {
+		return fmt.Errorf("--candidates must be positive or -1")
+	}
+	pin, err := fetch.ParsePin(pinSlot, pinHash)
+	if err != nil {
+		return err
+	}
+	if pin != nil && (incrOnly || createIfMissing) {
+		return fmt.Errorf("--pin-slot and --pin-hash can't be combined with --incremental-only or --create-if-missing")
+	}
+	// Slot dirs hold independent snapshots, unrelated to those in the snapshot dir.
+	if slotSubdir && (prune || incrOnly) {
+		return fmt.Errorf("--slot-subdir can't be combined with --prune or --incremental-only")
+	}
 
 	// Check what snapshots we have locally.
-	localSnaps, err := ledger.ListSnapshots(os.DirFS(ledgerDir))
+	snapshotDir, err := ledger.SnapshotDir(ledgerDir, snapshotSubdir)
+	if err != nil {
+		return err
+	}
+	if snapshotSubdir != "" && !dryRun {
+		if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+			return fmt.Errorf("failed to create snapshot dir: %w", err)
+		}
+	}
+	localSnaps, err := ledger.ListSnapshotsContext(ctx, os.DirFS(snapshotDir))
+	if err != nil && !(snapshotSubdir != "" && errors.Is(err, fs.ErrNotExist)) {
+		return fmt.Errorf("failed to check existing snapshots: %w", err)
+	}
+
+	genesis, err := getExpectedGenesis()
 	if err != nil {
-		log.Fatal("Failed to check existing snapshots", zap.Error(err))
+		return err
+	}
+
+	// In incremental-only mode, only snapshots based on the newest local full snapshot are of interest.
+	var base *types.SnapshotFile
+	if incrOnly {
+		if base = fetch.NewestFullSnapshot(localSnaps); base == nil {
+			return fmt.Errorf("--incremental-only requires a local full snapshot")
+		}
+	}
+
+	// Without a local snapshot, any remote one is worth fetching.
+	var minNewSlot uint64
+	if len(localSnaps) > 0 && pin == nil {
+		minNewSlot = localSnaps[0].Slot + minSnapAge
 	}
 
-	// Ask tracker for best snapshots.
-	trackerClient := fetch.NewTrackerClientWithResty(
-		resty.New().
-			SetHostURL(trackerURL).
-			SetTimeout(requestTimeout),
-	)
-	remoteSnaps, err := trackerClient.GetBestSnapshots(ctx, -1)
+	// Ask tracker or peer for best snapshots.
+	var remoteSnaps []types.SnapshotSource
+	if pin != nil {
+		remoteSnaps, err = c.getPinnedSnapshots(ctx, pin)
+	} else {
+		remoteSnaps, err = c.getRemoteSnapshots(ctx, base, numCandidates)
+	}
 	if err != nil {
-		log.Fatal("Failed to request snapshot info", zap.Error(err))
+		return fmt.Errorf("failed to request snapshot info: %w", err)
+	}
+	if createIfMissing && !hasSnapshotSince(remoteSnaps, minNewSlot) {
+		if dryRun {
+			log.Info("Would request a snapshot", zap.Uint64("slot", minNewSlot))
+		} else {
+			if err := c.createSnapshot(ctx, log, minNewSlot); err != nil {
+				return err
+			}
+			if remoteSnaps, err = c.getRemoteSnapshots(ctx, base, numCandidates); err != nil {
+				return fmt.Errorf("failed to request snapshot info: %w", err)
+			}
+		}
+	}
+	if len(sourceAllow) > 0 || len(sourceDeny) > 0 {
+		allowed := sourceFilter.Filter(remoteSnaps)
+		// The candidates may all be disallowed while more snapshots are available.
+		if len(allowed) == 0 && c.tracker != nil && base == nil && pin == nil && numCandidates > 0 && len(remoteSnaps) >= numCandidates {
+			log.Debug("No allowed sources among candidates, requesting more",
+				zap.Int("num_sources", len(remoteSnaps)))
+			if remoteSnaps, err = c.getRemoteSnapshots(ctx, base, -1); err != nil {
+				return fmt.Errorf("failed to request snapshot info: %w", err)
+			}
+			allowed = sourceFilter.Filter(remoteSnaps)
+		}
+		log.Debug("Filtered snapshot sources",
+			zap.Int("num_sources", len(remoteSnaps)),
+			zap.Int("num_allowed", len(allowed)))
+		remoteSnaps = allowed
+	}
+	if base != nil {
+		remoteSnaps = fetch.IncrementalsForBase(remoteSnaps, base)
+		log.Debug("Looking for incremental snapshots",
+			zap.Uint64("base_slot", base.Slot),
+			zap.Int("num_sources", len(remoteSnaps)))
 	}
 
 	// Decide what we want to do.
-	_, advice := fetch.ShouldFetchSnapshot(localSnaps, remoteSnaps, minSnapAge, maxSnapAge)
+	// A pinned snapshot is fetched regardless of its age, but its base is still taken from remoteSnaps.
+	ranked := remoteSnaps
+	var minSlot uint64
+	var advice fetch.Advice
+	var reason fetch.AdviceReason
+	if pin != nil {
+		ranked, advice, reason = fetch.ShouldFetchPinned(localSnaps, remoteSnaps, pin)
+	} else {
+		minSlot, advice, reason = fetch.ShouldFetchSnapshot(localSnaps, remoteSnaps, minSnapAge, maxSnapAge)
+	}
+	if incrOnly && advice == fetch.AdviceNothingFound {
+		reason.Rule = fetch.RuleNoCompatibleIncremental
+	}
+	res.Advice = advice.String()
+	res.Reason = reason.Rule
+	res.advice, res.reason = advice, &reason
+	log.Info("Advice",
+		zap.Stringer("advice", advice),
+		zap.String("rule", reason.Rule),
+		zap.Stringer("reason", reason),
+		zap.Uint64("local_slot", reason.LocalSlot),
+		zap.Uint64("remote_slot", reason.RemoteSlot),
+		zap.Bool("dry_run", dryRun))
 	switch advice {
 	case fetch.AdviceNothingFound:
+		if pin != nil {
+			return fmt.Errorf("pinned snapshot %s is not available", pin)
+		}
 		log.Error("No snapshots available remotely")
-		return
+		return nil
 	case fetch.AdviceUpToDate:
 		log.Info("Existing snapshot is recent enough, no download needed",
-			zap.Uint64("existing_slot", localSnaps[0].Slot))
-		return
+			zap.Uint64("existing_slot", reason.LocalSlot))
+		return nil
 	case fetch.AdviceFetch:
 	}
 
-	// Print snapshot to user.
-	snap := &remoteSnaps[0]
-	buf, _ := json.MarshalIndent(snap, "", "\t")
-	log.Info("Downloading a snapshot", zap.ByteString("snap", buf))
+	// Collect sources to try, best first.
+	var candidates []types.SnapshotSource
+	var genesisErr, sizeErr error
+	for _, snap := range fetch.BreakTies(policy.Rank(ranked), tieBreaker) {
+		if snap.Slot < minSlot || snap.Slot < minNewSlot {
+			continue
+		}
+		if genesis != nil {
+			if err := fetch.CheckGenesisHash(&snap.SnapshotInfo, *genesis); err != nil {
+				log.Warn("Skipping snapshot from other cluster",
+					zap.String("target", snap.Target),
+					zap.Uint64("slot", snap.Slot),
+					zap.Error(err))
+				genesisErr = err
+				continue
+			}
+		}
+		if minVersion != "" && !fetch.HasMinVersion(&snap.SnapshotInfo, minVersion) {
+			log.Debug("Skipping snapshot from outdated node",
+				zap.String("target", snap.Target),
+				zap.Uint64("slot", snap.Slot))
+			continue
+		}
+		// Incremental snapshots are useless without the full snapshot they are based on.
+		// In incremental-only mode, that base is the local full snapshot.
+		if !incrOnly {
+			snap = fetch.CompleteChain(snap, remoteSnaps)
+		}
+		if maxTotalBytes > 0 && snap.TotalSize > maxTotalBytes {
+			log.Warn("Skipping snapshot exceeding max total size",
+				zap.String("target", snap.Target),
+				zap.Uint64("slot", snap.Slot),
+				zap.Uint64("total_size", snap.TotalSize),
+				zap.Uint64("max_total_bytes", maxTotalBytes))
+			sizeErr = fmt.Errorf("snapshot at slot %d has %d bytes including its full snapshot, more than --max-total-bytes %d, "+
+				"wait for a newer full snapshot", snap.Slot, snap.TotalSize, maxTotalBytes)
+			continue
+		}
+		candidates = append(candidates, snap)
+	}
+	if len(candidates) == 0 && genesisErr != nil {
+		return genesisErr
+	}
+	if len(candidates) == 0 && sizeErr != nil {
+		return sizeErr
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no remote snapshot matches requirements")
+	}
+
+	downloader := fetch.NewDownloader()
+	downloader.StagingRoot = stagingRoot
+	downloader.MultiSource = multiSource
+	downloader.SlotSubdir = slotSubdir
+	downloader.Log = log
+	downloader.NewClient = c.sidecar
 
-	// Setup progress bars for download.
-	bars := mpb.New()
-	sidecarClient := fetch.NewSidecarClientWithOpts(snap.Target, fetch.SidecarClientOpts{
-		ProxyReaderFunc: func(name string, size int64, rd io.Reader) io.ReadCloser {
-			bar := bars.New(
-				size,
-				mpb.BarStyle(),
-				mpb.PrependDecorators(decor.Name(name)),
-				mpb.AppendDecorators(
-					decor.AverageSpeed(decor.UnitKB, "% .1f"),
-					decor.Percentage(),
-				),
-			)
-			return bar.ProxyReader(rd)
-		},
-	})
+	if dryRun {
+		snap := &candidates[0]
+		res.setSnapshot(snap)
+		res.Dir = downloader.DestDir(snapshotDir, &snap.SnapshotInfo)
+		// Files already present locally (e.g. the base of an incremental) are not downloaded again.
+		files, err := fetch.MissingFiles(res.Dir, &snap.SnapshotInfo)
+		if err != nil {
+			return err
+		}
+		log.Info("Would download snapshot",
+			zap.String("target", snap.Target),
+			zap.Uint64("slot", snap.Slot),
+			zap.Stringer("hash", snap.Hash),
+			zap.Uint64("total_size", snap.TotalSize),
+			zap.String("dir", res.Dir),
+			zap.Int("num_candidates", len(candidates)))
+		for _, file := range files {
+			log.Info("Snapshot file",
+				zap.String("file_name", file.FileName),
+				zap.Uint64("size", file.Size))
+		}
+		return nil
+	}
 
-	// Download.
-	beforeDownload := time.Now()
-	group, ctx := errgroup.WithContext(ctx)
-	for _, file := range snap.Files {
-		file_ := file
-		group.Go(func() error {
-			err := sidecarClient.DownloadSnapshotFile(ctx, ".", file_.FileName)
-			if err != nil {
-				log.Error("Download failed",
-					zap.String("snapshot", file_.FileName))
+	// Setup progress bars for download.
+	// Watch mode runs unattended, so it only logs.
+	progress := &fetchProgress{ctx: ctx}
+	if outputFormat != "json" && !watch {
+		sizes := make(map[string]int64)
+		for _, snap := range candidates {
+			for _, file := range snap.Files {
+				sizes[file.FileName] = int64(file.Size)
 			}
+		}
+		progress.bars = newProgressBars(sizes)
+		// The total covers the files still missing from the preferred candidate.
+		totals := make(map[string]int64)
+		best := &candidates[0].SnapshotInfo
+		missing, err := fetch.MissingFiles(downloader.DestDir(snapshotDir, best), best)
+		if err != nil {
+			missing = best.Files
+		}
+		for _, file := range missing {
+			totals[file.FileName] = int64(file.Size)
+		}
+		progress.aggregate = fetch.NewAggregateProgress(totals, progress.bars.total)
+	}
+	c.setProgress(progress)
+	defer func() {
+		c.setProgress(nil)
+		res.BytesTransferred = progress.bytesTransferred.Load()
+	}()
+	// Download.
+	snap, report, err := downloader.DownloadBestEffort(ctx, candidates, snapshotDir)
+	if err != nil {
+		return fmt.Errorf("failed to download snapshot: %w", err)
+	}
+	res.setSnapshot(snap)
+	res.Dir = downloader.DestDir(snapshotDir, &snap.SnapshotInfo)
+	res.Report = report
+	log.Info("Snapshot ready", zap.String("dir", res.Dir))
+	if outputFormat != "json" && !watch {
+		if err := printReport(os.Stdout, report); err != nil {
 			return err
-		})
+		}
 	}
-	downloadErr := group.Wait()
-	downloadDuration := time.Since(beforeDownload)
 
-	if downloadErr == nil {
-		log.Info("Download completed", zap.Duration("download_time", downloadDuration))
-	} else {
-		log.Info("Aborting download", zap.Duration("download_time", downloadDuration))
+	// Clean up old snapshots.
+	if prune {
+		if _, err := fetch.PruneSnapshots(snapshotDir, keepSnaps, &snap.SnapshotInfo, log); err != nil {
+			return fmt.Errorf("failed to prune snapshots: %w", err)
+		}
+	}
+	return nil
+}
+
+// hasSnapshotSince returns whether any of the snapshots is at or after the given slot.
+func hasSnapshotSince(snaps []types.SnapshotSource, slot uint64) bool {
+	for _, snap := range snaps {
+		if snap.Slot >= slot {
+			return true
+		}
+	}
+	return false
+}
+
+// getExpectedGenesis returns the genesis hash remote snapshots must match,
+// or nil if there is no local genesis config to compare against.
+func getExpectedGenesis() (*solana.Hash, error) {
+	if expectedGenesis != "" {
+		hash, err := solana.HashFromBase58(expectedGenesis)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --expected-genesis: %w", err)
+		}
+		return &hash, nil
+	}
+	hash, err := ledger.GenesisHash(os.DirFS(ledgerDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read genesis hash: %w", err)
+	}
+	return &hash, nil
+}
+
+// setSnapshot records the downloaded snapshot, listing files by their names in the ledger dir.
+func (r *result) setSnapshot(snap *types.SnapshotSource) {
+	r.Target = snap.Target
+	r.Slot = snap.Slot
+	r.Hash = snap.Hash.String()
+	r.Files = make([]string, len(snap.Files))
+	for i, file := range snap.Files {
+		r.Files[i] = fetch.LocalFileName(file.FileName, decompress)
+	}
+}
+
+// sendAlert notifies the alert webhook if the local snapshot fell behind and the fetch couldn't catch up.
+// Delivery failures are only logged, they don't fail the fetch.
+func sendAlert(log *zap.Logger, res *result, fetchErr error) {
+	if res.reason == nil || !fetch.NeedsAlert(res.advice, *res.reason, maxSnapAge, fetchErr) {
+		return
+	}
+	hostname, _ := os.Hostname()
+	alert := &fetch.SnapshotAlert{
+		Hostname:   hostname,
+		LocalSlot:  res.reason.LocalSlot,
+		RemoteSlot: res.reason.RemoteSlot,
+		Advice:     res.Advice,
+		Error:      res.Error,
+	}
+	if alert.RemoteSlot > alert.LocalSlot {
+		alert.Gap = alert.RemoteSlot - alert.LocalSlot
+	}
+	// The fetch context may have timed out already.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := fetch.PostAlert(ctx, resty.New(), alertWebhook, alert); err != nil {
+		log.Warn("Failed to send alert", zap.Error(err))
+		return
 	}
+	log.Info("Sent alert",
+		zap.Uint64("local_slot", alert.LocalSlot),
+		zap.Uint64("remote_slot", alert.RemoteSlot))
 }
@@ -0,0 +1,133 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"io"
+	"sync"
+
+	"github.com/vbauerster/mpb/v7"
+	"github.com/vbauerster/mpb/v7/decor"
+)
+
+// progressBars shows a progress bar per file, including files waiting for a download slot,
+// and a bar for all files combined on top.
+type progressBars struct {
+	bars *mpb.Progress
+
+	lock     sync.Mutex
+	sizes    map[string]int64 // expected file sizes, if known
+	byName   map[string]*mpb.Bar
+	totalBar *mpb.Bar // created on first report
+}
+
+func newProgressBars(sizes map[string]int64) *progressBars {
+	return &progressBars{
+		bars:   mpb.New(),
+		sizes:  sizes,
+		byName: make(map[string]*mpb.Bar),
+	}
+}
+
+// queue shows a bar for a file before its download starts.
+// If the file size is not known yet, stat is called to look it up.
+func (p *progressBars) queue(name string, stat func() (int64, error)) {
+	p.lock.Lock()
+	known := p.sizes[name] > 0
+	p.lock.Unlock()
+	if !known {
+		if size, err := stat(); err == nil && size > 0 {
+			p.lock.Lock()
+			p.sizes[name] = size
+			p.lock.Unlock()
+		}
+	}
+	p.bar(name)
+}
+
+// proxyReader tracks a download in the file's bar.
+// The size is the number of remaining bytes, which is less than the file size when resuming.
+// If the size is unknown (negative), the bar completes once the download is closed.
+func (p *progressBars) proxyReader(name string, size int64, rd io.Reader) io.ReadCloser {
+	bar := p.bar(name)
+	if size < 0 {
+		return &indeterminateReader{ReadCloser: bar.ProxyReader(rd), bar: bar}
+	}
+	p.lock.Lock()
+	total := p.sizes[name]
+	p.lock.Unlock()
+	if total < size {
+		total = size
+	}
+	bar.SetTotal(total, false)
+	bar.SetCurrent(total - size)
+	bar.EnableTriggerComplete()
+	return bar.ProxyReader(rd)
+}
+
+// total shows the combined progress of all files, see fetch.AggregateProgressFunc.
+func (p *progressBars) total(downloaded, total int64) {
+	p.lock.Lock()
+	if p.totalBar == nil {
+		p.totalBar = p.bars.New(
+			total,
+			mpb.BarStyle(),
+			mpb.BarPriority(-1),
+			mpb.PrependDecorators(decor.Name("total")),
+			mpb.AppendDecorators(
+				decor.AverageSpeed(decor.UnitKB, "% .1f"),
+				decor.Percentage(),
+			),
+		)
+	}
+	bar := p.totalBar
+	p.lock.Unlock()
+	bar.SetTotal(total, false)
+	bar.SetCurrent(downloaded)
+	if total > 0 && downloaded >= total {
+		bar.SetTotal(total, true)
+	}
+}
+
+func (p *progressBars) bar(name string) *mpb.Bar {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if bar, ok := p.byName[name]; ok {
+		return bar
+	}
+	// Without a known size, the bar only completes once the total is set later on.
+	bar := p.bars.New(
+		p.sizes[name],
+		mpb.BarStyle(),
+		mpb.PrependDecorators(decor.Name(name)),
+		mpb.AppendDecorators(
+			decor.AverageSpeed(decor.UnitKB, "% .1f"),
+			decor.Percentage(),
+		),
+	)
+	p.byName[name] = bar
+	return bar
+}
+
+// indeterminateReader completes a bar of unknown size when closed.
+type indeterminateReader struct {
+	io.ReadCloser
+	bar *mpb.Bar
+}
+
+func (r *indeterminateReader) Close() error {
+	r.bar.SetTotal(-1, true)
+	return r.ReadCloser.Close()
+}
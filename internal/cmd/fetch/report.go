@@ -0,0 +1,37 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"go.blockdaemon.com/solana/cluster-manager/internal/fetch"
+)
+
+// printReport prints a table of per-file download throughput.
+func printReport(w io.Writer, report *fetch.DownloadReport) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "FILE\tSOURCE\tBYTES\tELAPSED\tMB/S\t")
+	for _, file := range report.Files {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%.1f\t\n",
+			file.FileName, file.Source, file.Bytes, file.Elapsed.Round(time.Millisecond), file.BytesPerSec()/1e6)
+	}
+	fmt.Fprintf(tw, "%s\t\t%d\t%s\t%.1f\t\n",
+		"TOTAL", report.TotalBytes(), report.Elapsed.Round(time.Millisecond), report.BytesPerSec()/1e6)
+	return tw.Flush()
+}
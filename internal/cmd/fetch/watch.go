@@ -0,0 +1,180 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.blockdaemon.com/solana/cluster-manager/internal/fetch"
+	"go.uber.org/zap"
+)
+
+// runWatch fetches repeatedly, waiting for the watch interval in between, until ctx is cancelled.
+func runWatch(ctx context.Context, log *zap.Logger, c *clients) error {
+	if watchInterval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	status := new(watchStatus)
+	if statusListen != "" {
+		listener, err := net.Listen("tcp", statusListen)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/status", status)
+		server := &http.Server{Handler: mux}
+		go func() {
+			<-ctx.Done()
+			_ = server.Close()
+		}()
+		go func() {
+			log.Info("Serving status", zap.String("listen", listener.Addr().String()))
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("Status server failed", zap.Error(err))
+			}
+		}()
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	manifest := &manifestWatch{enabled: c.tracker != nil}
+	for {
+		if manifest.unchanged(ctx, log, c.tracker) {
+			log.Info("Tracker snapshots unchanged, skipping fetch")
+			status.setNext(time.Now().Add(watchInterval))
+		} else {
+			res, err := fetchOnce(ctx, log, c)
+			if ctx.Err() != nil {
+				// Partial downloads are kept in the staging dir and resumed on the next start.
+				log.Info("Stopping watch")
+				return nil
+			}
+			if err != nil {
+				log.Error("Fetch failed", zap.Error(err))
+			}
+			manifest.fetched(err == nil)
+			status.set(res, time.Now().Add(watchInterval))
+			if outputFormat == "json" {
+				if err := enc.Encode(res); err != nil {
+					return err
+				}
+			}
+		}
+
+		next := time.Now().Add(watchInterval)
+		log.Info("Waiting for next fetch", zap.Time("next_fetch", next))
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping watch")
+			return nil
+		case <-time.After(watchInterval):
+		}
+	}
+}
+
+// manifestWatch skips fetches while the snapshots known to the tracker are unchanged since the last successful fetch.
+type manifestWatch struct {
+	enabled    bool
+	generation uint64 // generation seen before the last fetch
+	pending    uint64 // generation seen before the fetch in progress
+}
+
+// unchanged checks the tracker manifest, returning true if the last fetch saw the same snapshots.
+// Disables itself if the tracker doesn't serve manifests, e.g. because it is outdated.
+func (m *manifestWatch) unchanged(ctx context.Context, log *zap.Logger, tracker *fetch.TrackerClient) bool {
+	if !m.enabled {
+		return false
+	}
+	manifest, err := tracker.GetManifest(ctx, m.generation)
+	var statusErr *fetch.StatusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		log.Info("Tracker doesn't serve manifests, fetching on every interval")
+		m.enabled = false
+		return false
+	case err != nil:
+		if ctx.Err() == nil {
+			log.Warn("Failed to get tracker manifest", zap.Error(err))
+		}
+		m.pending = 0
+		return false
+	case manifest == nil:
+		return true
+	}
+	m.pending = manifest.Generation
+	return false
+}
+
+// fetched records the result of a fetch.
+// Failed fetches are retried on the next interval even if the manifest is unchanged.
+func (m *manifestWatch) fetched(ok bool) {
+	if ok {
+		m.generation = m.pending
+	} else {
+		m.generation = 0
+	}
+}
+
+// watchStatus serves the result of the last fetch in watch mode.
+type watchStatus struct {
+	lock        sync.Mutex
+	lastFetch   *result
+	lastFetchAt time.Time
+	nextFetchAt time.Time
+}
+
+type watchStatusJSON struct {
+	LastFetch   *result    `json:"last_fetch"`
+	LastFetchAt *time.Time `json:"last_fetch_at,omitempty"`
+	NextFetchAt *time.Time `json:"next_fetch_at,omitempty"`
+}
+
+func (s *watchStatus) set(res *result, next time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastFetch = res
+	s.lastFetchAt = time.Now()
+	s.nextFetchAt = next
+}
+
+// setNext updates the time of the next fetch after skipping one.
+func (s *watchStatus) setNext(next time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nextFetchAt = next
+}
+
+func (s *watchStatus) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.lock.Lock()
+	var status watchStatusJSON
+	if s.lastFetch != nil {
+		lastFetchAt, nextFetchAt := s.lastFetchAt, s.nextFetchAt
+		status = watchStatusJSON{
+			LastFetch:   s.lastFetch,
+			LastFetchAt: &lastFetchAt,
+			NextFetchAt: &nextFetchAt,
+		}
+	}
+	s.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&status)
+}
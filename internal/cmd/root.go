@@ -19,6 +19,7 @@ import (
 	"go.blockdaemon.com/solana/cluster-manager/internal/cmd/fetch"
 	"go.blockdaemon.com/solana/cluster-manager/internal/cmd/mirror"
 	"go.blockdaemon.com/solana/cluster-manager/internal/cmd/sidecar"
+	"go.blockdaemon.com/solana/cluster-manager/internal/cmd/snapshots"
 	"go.blockdaemon.com/solana/cluster-manager/internal/cmd/tracker"
 )
 
@@ -35,5 +36,6 @@ func init() {
 		&sidecar.Cmd,
 		&tracker.Cmd,
 		&mirror.Cmd,
+		&snapshots.Cmd,
 	)
 }
@@ -16,11 +16,24 @@
 package sidecar
 
 import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
 	"time"
 
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
+	"go.blockdaemon.com/solana/cluster-manager/internal/checksum"
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
 	"go.blockdaemon.com/solana/cluster-manager/internal/logger"
 	"go.blockdaemon.com/solana/cluster-manager/internal/netx"
 	"go.blockdaemon.com/solana/cluster-manager/internal/sidecar"
@@ -31,6 +44,8 @@ var Cmd = cobra.Command{
 	Use:   "sidecar",
 	Short: "Snapshot node sidecar",
 	Long: "Runs on a Solana node and serves available snapshot archives.\n" +
+		"With --s3-url, serves snapshots from an S3-compatible bucket instead,\n" +
+		"using credentials from env $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY.\n" +
 		"Do not expose this API publicly.",
 	Run: func(_ *cobra.Command, _ []string) {
 		run()
@@ -38,10 +53,23 @@ var Cmd = cobra.Command{
 }
 
 var (
-	netInterface string
-	listenPort   uint16
-	ledgerDir    string
-	rpcWsUrl     string
+	netInterface   string
+	listenPort     uint16
+	ledgerDir      string
+	snapshotSubdir string
+	rpcWsUrl       string
+	rpcUrl         string
+	s3URL          string
+	s3Region       string
+	s3Bucket       string
+	objectPrefix   string
+	maxUploads     int
+	maxUploadRate  int64
+	checksumAlgos  []string
+	wireCompress   bool
+	allowRequests  bool
+	requestToken   string
+	requestCommand string
 )
 
 func init() {
@@ -49,12 +77,32 @@ func init() {
 	flags.StringVar(&netInterface, "interface", "", "Only accept connections from this interface")
 	flags.Uint16Var(&listenPort, "port", 13080, "Listen port")
 	flags.StringVar(&ledgerDir, "ledger", "", "Path to ledger dir")
+	flags.StringVar(&snapshotSubdir, "snapshot-subdir", "", "Subdir of the ledger dir holding snapshots (default: ledger dir)")
 	flags.StringVar(&rpcWsUrl, "ws", "ws://localhost:8900", "Solana RPC PubSub WebSocket endpoint")
+	flags.IntVar(&maxUploads, "max-concurrent-uploads", 0, "Max number of snapshot downloads served at once, excess get 503 (0 for unlimited)")
+	flags.Int64Var(&maxUploadRate, "max-upload-bytes-per-sec", 0, "Max upload speed of each snapshot download in bytes per second (0 for unlimited)")
+	flags.StringSliceVar(&checksumAlgos, "checksum-algos", []string{checksum.SHA256}, "Checksums offered to verify downloads, the first is the default ("+strings.Join(checksum.Algorithms, ", ")+")")
+	flags.BoolVar(&wireCompress, "wire-compression", false, "Compress uncompressed snapshots with zstd for clients accepting it (compressed snapshots are served as is)")
+	flags.StringVar(&rpcUrl, "rpc", "http://localhost:8899", "Solana RPC HTTP endpoint")
+	flags.StringVar(&s3URL, "s3-url", "", "URL to S3 API, serves snapshots from a bucket instead of the ledger dir")
+	flags.StringVar(&s3Region, "s3-region", "", "S3 region (optional)")
+	flags.StringVar(&s3Bucket, "s3-bucket", "", "Bucket name")
+	flags.StringVar(&objectPrefix, "s3-prefix", "", "Prefix for S3 object names (optional)")
+	flags.BoolVar(&allowRequests, "allow-snapshot-requests", false, "Let clients holding the --snapshot-request-token request snapshots at or after a slot")
+	flags.StringVar(&requestToken, "snapshot-request-token", "", "Bearer token required to request snapshots (default: $SOLANA_SNAPSHOT_REQUEST_TOKEN)")
+	flags.StringVar(&requestCommand, "snapshot-request-command", "", "Shell command making the node create a snapshot on request, given the slot as $SNAPSHOT_SLOT (default: wait for regular snapshots)")
 	flags.AddFlagSet(logger.Flags)
 }
 
 func run() {
 	log := logger.GetLogger()
+	for _, algo := range checksumAlgos {
+		if !checksum.Supported(algo) {
+			cobra.CheckErr(fmt.Errorf("unsupported checksum algorithm: %s", algo))
+		}
+	}
+	snapshotDir, err := ledger.SnapshotDir(ledgerDir, snapshotSubdir)
+	cobra.CheckErr(err)
 	listener, listenAddrs, err := netx.ListenTCPInterface("tcp", netInterface, listenPort)
 	if err != nil {
 		cobra.CheckErr(err)
@@ -71,12 +119,87 @@ func run() {
 
 	groupV1 := server.Group("/v1")
 
-	snapshotHandler := sidecar.NewSnapshotHandler(ledgerDir, httpLog)
+	snapshotHandler := sidecar.NewSnapshotHandler(snapshotDir, httpLog)
+	snapshotHandler.GenesisDir = os.DirFS(ledgerDir)
+	snapshotHandler.MaxConcurrentUploads = maxUploads
+	snapshotHandler.MaxUploadBytesPerSec = maxUploadRate
+	snapshotHandler.ChecksumAlgorithms = checksumAlgos
+	snapshotHandler.WireCompression = wireCompress
+	if s3URL != "" {
+		store, err := newObjectStore()
+		cobra.CheckErr(err)
+		snapshotHandler.Store = store
+		if ledgerDir == "" {
+			snapshotHandler.GenesisDir = nil
+		}
+	}
 	snapshotHandler.RegisterHandlers(groupV1)
 
+	if allowRequests {
+		if requestToken == "" {
+			requestToken = os.Getenv("SOLANA_SNAPSHOT_REQUEST_TOKEN")
+		}
+		if requestToken == "" {
+			cobra.CheckErr(fmt.Errorf("--allow-snapshot-requests requires a --snapshot-request-token"))
+		}
+		requestHandler := sidecar.NewSnapshotRequestHandler(snapshotHandler.Store, requestToken, httpLog)
+		if requestCommand != "" {
+			requestHandler.Trigger = commandTrigger(requestCommand)
+		}
+		requestHandler.RegisterHandlers(groupV1)
+	}
+
 	consensusHandler := sidecar.NewConsensusHandler(rpcWsUrl, httpLog)
 	consensusHandler.RegisterHandlers(groupV1)
 
+	versionHandler := sidecar.NewVersionHandler(rpcUrl, httpLog)
+	versionHandler.RegisterHandlers(groupV1)
+
+	nodeHandler := sidecar.NewNodeHandler(rpcUrl, httpLog)
+	nodeHandler.RegisterHandlers(groupV1)
+
+	// Export freshness of local snapshots, a snapshot hub has no local ledger.
+	if s3URL == "" {
+		prometheus.MustRegister(sidecar.NewSnapshotCollector(snapshotDir, rpcUrl, log.Named("metrics")))
+	}
+	server.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
 	err = server.RunListener(listener)
 	log.Error("Server stopped", zap.Error(err))
 }
+
+// commandTrigger returns a snapshot trigger running a shell command.
+func commandTrigger(command string) sidecar.SnapshotTrigger {
+	return func(ctx context.Context, slot uint64) error {
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+		cmd.Env = append(os.Environ(), "SNAPSHOT_SLOT="+strconv.FormatUint(slot, 10))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("snapshot request command failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+}
+
+// newObjectStore connects to the bucket set by the --s3-* flags.
+func newObjectStore() (*sidecar.ObjectStore, error) {
+	if s3Bucket == "" {
+		return nil, fmt.Errorf("--s3-bucket is required with --s3-url")
+	}
+	parsedS3URL, err := url.Parse(s3URL)
+	if err != nil {
+		return nil, err
+	}
+	s3Client, err := minio.New(parsedS3URL.Host, &minio.Options{
+		Creds:  credentials.NewEnvAWS(),
+		Secure: parsedS3URL.Scheme != "http",
+		Region: s3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to S3: %w", err)
+	}
+	return &sidecar.ObjectStore{
+		Client: s3Client,
+		Bucket: s3Bucket,
+		Prefix: objectPrefix,
+	}, nil
+}
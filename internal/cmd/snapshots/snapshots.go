@@ -0,0 +1,132 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package snapshots provides the `snapshots` command.
+package snapshots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+var Cmd = cobra.Command{
+	Use:   "snapshots",
+	Short: "Inspect local snapshots",
+}
+
+var listCmd = cobra.Command{
+	Use:   "list",
+	Short: "List the snapshots in a ledger dir",
+	Long: "Lists the snapshot files in a ledger dir, best first.\n" +
+		"Incremental snapshots whose base snapshot is missing are flagged as orphaned.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, _ []string) {
+		cobra.CheckErr(runList(cmd.Context(), os.Stdout))
+	},
+}
+
+var (
+	ledgerDir      string
+	snapshotSubdir string
+	jsonOutput     bool
+)
+
+func init() {
+	flags := listCmd.Flags()
+	flags.StringVar(&ledgerDir, "ledger", "", "Path to ledger dir")
+	flags.StringVar(&snapshotSubdir, "snapshot-subdir", "", "Subdir of the ledger dir holding snapshots (default: ledger dir)")
+	flags.BoolVar(&jsonOutput, "json", false, "Print snapshots as JSON")
+	Cmd.AddCommand(&listCmd)
+}
+
+// listEntry is a snapshot file as printed by the list command.
+type listEntry struct {
+	*types.SnapshotFile
+	Type     string `json:"type"`               // "full" or "incremental"
+	Orphaned bool   `json:"orphaned,omitempty"` // incremental snapshot lacking its base
+}
+
+func runList(ctx context.Context, out io.Writer) error {
+	if ledgerDir == "" {
+		return fmt.Errorf("--ledger is required")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	snapshotDir, err := ledger.SnapshotDir(ledgerDir, snapshotSubdir)
+	if err != nil {
+		return err
+	}
+	files, err := ledger.ListSnapshotFilesContext(ctx, os.DirFS(snapshotDir))
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	entries := make([]listEntry, len(files))
+	for i, file := range files {
+		entries[i] = listEntry{SnapshotFile: file, Type: "full"}
+		if !file.IsFull() {
+			entries[i].Type = "incremental"
+			_, err := ledger.ResolveChain(files, file)
+			entries[i].Orphaned = errors.Is(err, ledger.ErrMissingBase)
+		}
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "\t")
+		return enc.Encode(entries)
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SLOT\tBASE SLOT\tTYPE\tHASH\tSIZE\tMODIFIED")
+	for _, entry := range entries {
+		baseSlot, modTime := "-", "-"
+		if !entry.IsFull() {
+			baseSlot = fmt.Sprint(entry.BaseSlot)
+		}
+		if entry.ModTime != nil {
+			modTime = entry.ModTime.Format(time.RFC3339)
+		}
+		kind := entry.Type
+		if entry.Orphaned {
+			kind += " (orphaned)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Slot, baseSlot, kind, entry.Hash, formatSize(entry.Size), modTime)
+	}
+	return w.Flush()
+}
+
+// formatSize formats a byte count with binary units, e.g. "1.5 GiB".
+func formatSize(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -50,16 +50,37 @@ var Cmd = cobra.Command{
 }
 
 var (
-	configPath     string
-	internalListen string
-	listen         string
+	configPath      string
+	internalListen  string
+	listen          string
+	metricsListen   string
+	dbPath          string
+	dbMaxAge        time.Duration
+	shutdownTimeout time.Duration
+	healthListen    string
+	readyIntervals  int
+	targetsFile     string
+	sidecarPort     uint16
+	manifestKey     string
 )
 
+// defaultScrapeInterval is used if no config file is given.
+const defaultScrapeInterval = 15 * time.Second
+
 func init() {
 	flags := Cmd.Flags()
 	flags.StringVar(&configPath, "config", "", "Path to config file")
+	flags.StringVar(&targetsFile, "targets-file", "", "Path to file listing sidecars to scrape, one per line, re-read on each scrape")
+	flags.Uint16Var(&sidecarPort, "sidecar-port", 0, "Probe sidecars on this port, replacing the port of discovered targets (default: sidecar_port of each target group)")
 	flags.StringVar(&internalListen, "internal-listen", ":8457", "Internal listen URL")
 	flags.StringVar(&listen, "listen", ":8458", "Listen URL")
+	flags.StringVar(&dbPath, "db-path", "", "Path to file persisting snapshot info across restarts (default: in-memory only)")
+	flags.DurationVar(&dbMaxAge, "db-max-age", time.Hour, "Prune persisted snapshot info older than this")
+	flags.DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "Max time to wait for in-flight probes on shutdown")
+	flags.StringVar(&healthListen, "health-listen", "", "Listen URL for a dedicated /healthz and /readyz server (default: internal listen URL)")
+	flags.IntVar(&readyIntervals, "ready-intervals", 3, "Report not ready if the last successful scrape is older than <n> scrape intervals")
+	flags.StringVar(&manifestKey, "manifest-key", "", "Key to sign snapshot manifests with (default: $SOLANA_TRACKER_MANIFEST_KEY)")
+	flags.StringVar(&metricsListen, "metrics-listen", "", "Listen URL for a dedicated Prometheus metrics server")
 	flags.AddFlagSet(logger.Flags)
 }
 
@@ -85,15 +106,28 @@ func run() {
 	if err != nil {
 		panic(err.Error())
 	}
-	http.Handle("/metrics", promhttp.HandlerFor(
+	metricsHandler := promhttp.HandlerFor(
 		prometheus.DefaultGatherer,
 		promhttp.HandlerOpts{
 			ErrorLog: httpErrLog,
 		},
-	))
+	)
+	http.Handle("/metrics", metricsHandler)
 
 	// Create result collector.
 	db := index.NewDB()
+	if dbPath != "" {
+		db, err = index.OpenDB(dbPath, dbMaxAge)
+		if err != nil {
+			log.Fatal("Failed to open snapshot index", zap.Error(err))
+		}
+		db.Log = log.Named("index")
+		defer db.Close()
+		log.Info("Loaded persisted snapshot index",
+			zap.String("db_path", dbPath),
+			zap.Int("num_snapshots", len(db.GetAllSnapshots())))
+		go pruneLoop(ctx, db, dbMaxAge)
+	}
 	collector := scraper.NewCollector(db)
 	collector.Log = log.Named("collector")
 	collector.Start()
@@ -106,26 +140,72 @@ func run() {
 	server.Use(ginzap.RecoveryWithZap(httpLog, false))
 
 	handler := tracker.NewHandler(db)
+	if manifestKey == "" {
+		manifestKey = os.Getenv("SOLANA_TRACKER_MANIFEST_KEY")
+	}
+	if manifestKey != "" {
+		handler.ManifestKey = []byte(manifestKey)
+	}
 	handler.RegisterHandlers(server.Group("/v1"))
 
+	// Load config, which is optional if a targets file is given.
+	config := &types.Config{ScrapeInterval: defaultScrapeInterval}
+	if configPath != "" || targetsFile == "" {
+		config, err = types.LoadConfig(configPath)
+		if err != nil {
+			log.Fatal("Failed to load config", zap.Error(err))
+		}
+	}
+	if targetsFile != "" {
+		config.TargetGroups = append(config.TargetGroups, &types.TargetGroup{
+			Group:       "targets-file",
+			Scheme:      "http",
+			FileTargets: &types.FileTargets{Path: targetsFile},
+		})
+	}
+	if sidecarPort != 0 {
+		for _, group := range config.TargetGroups {
+			if group.SidecarPort == 0 {
+				group.SidecarPort = sidecarPort
+			}
+		}
+	}
+
+	// Create scrape managers.
+	manager := scraper.NewManager(collector.Probes())
+	manager.Log = log.Named("scraper")
+
+	// Install health checks, using the internal server unless configured otherwise.
+	health := &tracker.HealthHandler{
+		DB:           db,
+		LastScrape:   manager.LastSuccess,
+		MaxScrapeAge: time.Duration(readyIntervals) * config.ScrapeInterval,
+	}
+	healthMux := http.DefaultServeMux
+	if healthListen != "" {
+		healthMux = http.NewServeMux()
+	}
+	health.RegisterHandlers(healthMux)
+
 	// Start services.
 	group, ctx := errgroup.WithContext(ctx)
 	if internalListen != "" {
 		httpLog.Info("Starting internal server", zap.String("listen", internalListen))
 	}
 	runGroupServer(ctx, group, internalListen, nil) // default handler
+	if metricsListen != "" {
+		httpLog.Info("Starting metrics server", zap.String("listen", metricsListen))
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metricsHandler)
+		runGroupServer(ctx, group, metricsListen, metricsMux)
+	}
+	if healthListen != "" {
+		httpLog.Info("Starting health server", zap.String("listen", healthListen))
+		runGroupServer(ctx, group, healthListen, healthMux)
+	}
 	httpLog.Info("Starting server", zap.String("listen", listen))
 	runGroupServer(ctx, group, listen, server) // public handler
 
-	// Create config reloader.
-	config, err := types.LoadConfig(configPath)
-	if err != nil {
-		log.Fatal("Failed to load config", zap.Error(err))
-	}
-
-	// Create scrape managers.
-	manager := scraper.NewManager(collector.Probes())
-	manager.Log = log.Named("scraper")
 	manager.Update(config)
 
 	// TODO Config reloading
@@ -136,6 +216,27 @@ func run() {
 	} else {
 		log.Info("Shutting down")
 	}
+
+	// Let in-flight probes drain, but don't hang on stuck ones.
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := manager.Shutdown(shutdownCtx); err != nil {
+		log.Warn("Scrapers did not stop in time", zap.Duration("shutdown_timeout", shutdownTimeout))
+	}
+}
+
+// pruneLoop periodically deletes snapshot info that hasn't been updated in a while.
+func pruneLoop(ctx context.Context, db *index.DB, maxAge time.Duration) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			db.DeleteOldSnapshots(now.Add(-maxAge))
+		}
+	}
 }
 
 func runGroupServer(ctx context.Context, group *errgroup.Group, listen string, handler http.Handler) {
@@ -17,6 +17,8 @@ package discovery
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/hashicorp/consul/api"
 	"go.blockdaemon.com/solana/cluster-manager/types"
@@ -27,8 +29,26 @@ type Consul struct {
 	Client  *api.Client
 	Service string
 
-	Datacenter string // Consul datacenter (dc param)
-	Filter     string // Consul filter expression (filter param)
+	Datacenter  string // Consul datacenter (dc param)
+	Filter      string // Consul filter expression (filter param)
+	Tag         string // Only return instances with this tag (tag param)
+	PassingOnly bool   // Only return instances passing health checks
+}
+
+// ConsulDiscoverer is an alias for the Consul discovery backend.
+type ConsulDiscoverer = Consul
+
+// NewConsulDiscoverer creates a Consul discoverer returning healthy instances of a service.
+// The tag is optional.
+func NewConsulDiscoverer(addr, service, tag string) (*ConsulDiscoverer, error) {
+	client, err := api.NewClient(&api.Config{Address: addr})
+	if err != nil {
+		return nil, err
+	}
+	sd := NewConsul(client, service)
+	sd.Tag = tag
+	sd.PassingOnly = true
+	return sd, nil
 }
 
 // NewConsulFromConfig invokes NewConsul using typed config.
@@ -44,6 +64,8 @@ func NewConsulFromConfig(config *types.ConsulSDConfig) (*Consul, error) {
 	sd := NewConsul(client, config.Service)
 	sd.Datacenter = config.Datacenter
 	sd.Filter = config.Filter
+	sd.Tag = config.Tag
+	sd.PassingOnly = config.PassingOnly
 	return sd, nil
 }
 
@@ -56,18 +78,31 @@ func NewConsul(client *api.Client, service string) *Consul {
 }
 
 // DiscoverTargets queries Consul Catalog API to find nodes.
+// If PassingOnly is set, queries the Health API instead to skip unhealthy instances.
 // Returns a list of targets referred to by IP addresses.
 func (c *Consul) DiscoverTargets(ctx context.Context) ([]string, error) {
-	services, _, err := c.Client.Catalog().Service(c.Service, "", (&api.QueryOptions{
+	opts := (&api.QueryOptions{
 		Datacenter: c.Datacenter,
 		Filter:     c.Filter,
-	}).WithContext(ctx))
+	}).WithContext(ctx)
+	if c.PassingOnly {
+		entries, _, err := c.Client.Health().Service(c.Service, c.Tag, true, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query Consul health: %w", err)
+		}
+		targets := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			targets = append(targets, net.JoinHostPort(entry.Node.Address, strconv.Itoa(entry.Service.Port)))
+		}
+		return targets, nil
+	}
+	services, _, err := c.Client.Catalog().Service(c.Service, c.Tag, opts)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to query Consul catalog: %w", err)
 	}
 	targets := make([]string, 0, len(services))
 	for _, service := range services {
-		targets = append(targets, fmt.Sprintf("%s:%d", service.Address, service.ServicePort))
+		targets = append(targets, net.JoinHostPort(service.Address, strconv.Itoa(service.ServicePort)))
 	}
 	return targets, nil
 }
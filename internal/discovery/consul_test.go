@@ -0,0 +1,50 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsulDiscoverer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/health/service/solana", r.URL.Path)
+		assert.Equal(t, "mainnet", r.URL.Query().Get("tag"))
+		assert.Equal(t, "1", r.URL.Query().Get("passing"))
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"Node": {"Address": "10.0.0.1"}, "Service": {"Port": 13080}},
+			{"Node": {"Address": "10.0.0.2"}, "Service": {"Port": 13081}},
+			{"Node": {"Address": "2001:db8::1"}, "Service": {"Port": 13080}}
+		]`))
+	}))
+	defer server.Close()
+
+	sd, err := NewConsulDiscoverer(server.URL, "solana", "mainnet")
+	require.NoError(t, err)
+	targets, err := sd.DiscoverTargets(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:13080", "10.0.0.2:13081", "[2001:db8::1]:13080"}, targets)
+
+	server.Close()
+	_, err = sd.DiscoverTargets(context.Background())
+	assert.ErrorContains(t, err, "failed to query Consul health")
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/zap"
 )
 
 // Discoverer returns a list of host:port combinations for all targets.
@@ -30,15 +31,47 @@ type Discoverer interface {
 // Simple backends can be found in ../types/config.go
 
 // NewFromConfig attempts to create a discoverer from config.
+// If several discovery mechanisms are configured, the union of their targets is discovered.
 func NewFromConfig(t *types.TargetGroup) (Discoverer, error) {
+	var discoverers []Discoverer
 	if t.StaticTargets != nil {
-		return t.StaticTargets, nil
+		discoverers = append(discoverers, t.StaticTargets)
 	}
 	if t.FileTargets != nil {
-		return t.FileTargets, nil
+		discoverers = append(discoverers, NewFileDiscoverer(t.FileTargets.Path))
 	}
 	if t.ConsulSDConfig != nil {
-		return NewConsulFromConfig(t.ConsulSDConfig)
+		consul, err := NewConsulFromConfig(t.ConsulSDConfig)
+		if err != nil {
+			return nil, err
+		}
+		discoverers = append(discoverers, consul)
+	}
+	if t.SRVSDConfig != nil {
+		discoverers = append(discoverers, NewSRV(t.SRVSDConfig.Name))
+	}
+	if t.GossipSDConfig != nil {
+		discoverers = append(discoverers, NewGossipFromConfig(t.GossipSDConfig))
+	}
+	switch len(discoverers) {
+	case 0:
+		return nil, fmt.Errorf("missing config")
+	case 1:
+		return discoverers[0], nil
+	default:
+		return NewMultiDiscoverer(discoverers...), nil
+	}
+}
+
+// SetLogger sets the logger of discoverers that log, including those wrapped by a Multi.
+func SetLogger(d Discoverer, log *zap.Logger) {
+	switch d := d.(type) {
+	case *File:
+		d.Log = log
+	case *Multi:
+		d.Log = log
+		for _, inner := range d.Discoverers {
+			SetLogger(inner, log)
+		}
 	}
-	return nil, fmt.Errorf("missing config")
 }
@@ -0,0 +1,113 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// File discovers targets listed in a file, one per line.
+//
+// The file is read again on each discovery, so targets can be changed without a restart.
+// Lines may be written as YAML list items ("- host:port"). Blank lines and comments starting with "#" are ignored.
+// Malformed lines are logged and skipped.
+type File struct {
+	Path string
+	Log  *zap.Logger
+}
+
+// FileDiscoverer is an alias for the file discovery backend.
+type FileDiscoverer = File
+
+// NewFileDiscoverer creates a discoverer reading targets from the file at path.
+func NewFileDiscoverer(path string) *FileDiscoverer {
+	return &File{
+		Path: path,
+		Log:  zap.NewNop(),
+	}
+}
+
+// DiscoverTargets reads the targets file.
+// Returns the targets in file order.
+func (d *File) DiscoverTargets(_ context.Context) ([]string, error) {
+	f, err := os.Open(d.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var targets []string
+	scn := bufio.NewScanner(f)
+	for lineNum := 1; scn.Scan(); lineNum++ {
+		line := scn.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimPrefix(line, "- "))
+		line = strings.Trim(line, `"'`)
+		if line == "" {
+			continue
+		}
+		if err := checkTarget(line); err != nil {
+			d.Log.Warn("Skipping malformed line in targets file",
+				zap.String("path", d.Path),
+				zap.Int("line", lineNum),
+				zap.Error(err))
+			continue
+		}
+		targets = append(targets, line)
+	}
+	return targets, scn.Err()
+}
+
+// checkTarget validates a target given as "host", "host:port" or sidecar URL.
+func checkTarget(target string) error {
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return err
+		}
+		if u.Host == "" {
+			return fmt.Errorf("missing host in URL %q", target)
+		}
+		return nil
+	}
+	host := target
+	if h, port, err := net.SplitHostPort(target); err == nil {
+		if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+			return fmt.Errorf("invalid port in %q", target)
+		}
+		host = h
+	} else if strings.HasPrefix(target, "[") && strings.HasSuffix(target, "]") {
+		host = target[1 : len(target)-1]
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if host == "" || strings.ContainsAny(host, " \t:/[]") {
+		return fmt.Errorf("invalid host in %q", target)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestFile_DiscoverTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`# Mainnet nodes
+- solana-1.example.org:8899
+- "10.0.0.2:8899" # quoted
+- [2001:db8::1]:8899
+- "[2001:db8::2]"
+2001:db8::3
+
+solana-3.example.org
+https://solana-4.example.org/sidecar
+- solana-5.example.org:notaport
+- bad host
+`), 0644))
+
+	core, logs := observer.New(zap.WarnLevel)
+	d := NewFileDiscoverer(path)
+	d.Log = zap.New(core)
+	targets, err := d.DiscoverTargets(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"solana-1.example.org:8899",
+		"10.0.0.2:8899",
+		"[2001:db8::1]:8899",
+		"[2001:db8::2]",
+		"2001:db8::3",
+		"solana-3.example.org",
+		"https://solana-4.example.org/sidecar",
+	}, targets)
+	assert.Equal(t, 2, logs.FilterMessage("Skipping malformed line in targets file").Len())
+
+	// Changes are picked up on the next discovery.
+	require.NoError(t, os.WriteFile(path, []byte("- solana-6.example.org:8899\n"), 0644))
+	targets, err = d.DiscoverTargets(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"solana-6.example.org:8899"}, targets)
+
+	require.NoError(t, os.Remove(path))
+	_, err = d.DiscoverTargets(context.Background())
+	assert.Error(t, err)
+}
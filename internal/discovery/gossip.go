@@ -0,0 +1,79 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// Gossip discovers targets from the cluster nodes known to a Solana RPC node.
+type Gossip struct {
+	Client *rpc.Client
+
+	MinPeers    int    // Fail if the RPC node reports fewer cluster nodes
+	SidecarPort uint16 // Replace the RPC port of each node with the sidecar port, if set
+}
+
+// GossipDiscoverer is an alias for the gossip discovery backend.
+type GossipDiscoverer = Gossip
+
+// NewGossipDiscoverer creates a new gossip discoverer using a seed RPC node.
+func NewGossipDiscoverer(rpcURL string) *GossipDiscoverer {
+	return &Gossip{Client: rpc.New(rpcURL)}
+}
+
+// NewGossipFromConfig invokes NewGossipDiscoverer using typed config.
+func NewGossipFromConfig(config *types.GossipSDConfig) *Gossip {
+	sd := NewGossipDiscoverer(config.RPCURL)
+	sd.MinPeers = config.MinPeers
+	sd.SidecarPort = config.SidecarPort
+	return sd
+}
+
+// DiscoverTargets queries RPC "getClusterNodes".
+// Returns a sorted list of nodes that expose RPC, referred to by IP addresses.
+func (g *Gossip) DiscoverTargets(ctx context.Context) ([]string, error) {
+	nodes, err := g.Client.GetClusterNodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster nodes: %w", err)
+	}
+	if len(nodes) < g.MinPeers {
+		return nil, fmt.Errorf("RPC node knows only %d cluster nodes, expected at least %d", len(nodes), g.MinPeers)
+	}
+	targets := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if node.RPC == nil || *node.RPC == "" {
+			continue
+		}
+		target := *node.RPC
+		if g.SidecarPort != 0 {
+			host, _, err := net.SplitHostPort(target)
+			if err != nil {
+				continue
+			}
+			target = net.JoinHostPort(host, strconv.Itoa(int(g.SidecarPort)))
+		}
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
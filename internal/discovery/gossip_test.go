@@ -0,0 +1,51 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGossipDiscoverer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte(`{"jsonrpc": "2.0", "id": 0, "result": [
+			{"pubkey": "11111111111111111111111111111111", "rpc": "10.0.0.2:8899"},
+			{"pubkey": "11111111111111111111111111111111", "gossip": "10.0.0.3:8001"},
+			{"pubkey": "11111111111111111111111111111111", "rpc": "10.0.0.1:8899"}
+		]}`))
+	}))
+	defer server.Close()
+
+	sd := NewGossipDiscoverer(server.URL)
+	targets, err := sd.DiscoverTargets(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:8899", "10.0.0.2:8899"}, targets)
+
+	sd.SidecarPort = 13080
+	targets, err = sd.DiscoverTargets(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:13080", "10.0.0.2:13080"}, targets)
+
+	sd.MinPeers = 4
+	_, err = sd.DiscoverTargets(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Multi discovers the union of the targets of several discoverers.
+type Multi struct {
+	Discoverers []Discoverer
+	Log         *zap.Logger
+}
+
+// MultiDiscoverer is an alias for the composite discovery backend.
+type MultiDiscoverer = Multi
+
+// NewMultiDiscoverer creates a discoverer merging the targets of the given discoverers.
+func NewMultiDiscoverer(discoverers ...Discoverer) *MultiDiscoverer {
+	return &Multi{
+		Discoverers: discoverers,
+		Log:         zap.NewNop(),
+	}
+}
+
+// DiscoverTargets queries all discoverers concurrently.
+// Returns the targets in discoverer order, without duplicates.
+//
+// Failing discoverers are logged and skipped. Fails only if all of them fail.
+func (m *Multi) DiscoverTargets(ctx context.Context) ([]string, error) {
+	results := make([][]string, len(m.Discoverers))
+	errs := make([]error, len(m.Discoverers))
+	var wg sync.WaitGroup
+	wg.Add(len(m.Discoverers))
+	for i, d := range m.Discoverers {
+		go func(i int, d Discoverer) {
+			defer wg.Done()
+			results[i], errs[i] = d.DiscoverTargets(ctx)
+		}(i, d)
+	}
+	wg.Wait()
+
+	var targets []string
+	seen := make(map[string]bool)
+	var numFailed int
+	var lastErr error
+	for i, err := range errs {
+		if err != nil {
+			m.Log.Warn("Service discovery failed, using other sources",
+				zap.Int("source", i),
+				zap.String("type", fmt.Sprintf("%T", m.Discoverers[i])),
+				zap.Error(err))
+			numFailed++
+			lastErr = err
+			continue
+		}
+		for _, target := range results[i] {
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+	}
+	if numFailed > 0 && numFailed == len(m.Discoverers) {
+		return nil, fmt.Errorf("all %d discovery sources failed, last error: %w", numFailed, lastErr)
+	}
+	return targets, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/zap/zaptest"
+)
+
+type failingDiscoverer struct{}
+
+func (failingDiscoverer) DiscoverTargets(context.Context) ([]string, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestMulti_DiscoverTargets(t *testing.T) {
+	m := NewMultiDiscoverer(
+		&types.StaticTargets{Targets: []string{"a:1", "b:1"}},
+		failingDiscoverer{},
+		&types.StaticTargets{Targets: []string{"b:1", "c:1"}},
+	)
+	m.Log = zaptest.NewLogger(t)
+	targets, err := m.DiscoverTargets(context.Background())
+	require.NoError(t, err, "returns partial results")
+	assert.Equal(t, []string{"a:1", "b:1", "c:1"}, targets)
+
+	m = NewMultiDiscoverer(failingDiscoverer{}, failingDiscoverer{})
+	_, err = m.DiscoverTargets(context.Background())
+	assert.EqualError(t, err, "all 2 discovery sources failed, last error: unavailable")
+}
+
+func TestNewFromConfig_Multi(t *testing.T) {
+	d, err := NewFromConfig(&types.TargetGroup{
+		StaticTargets: &types.StaticTargets{Targets: []string{"a:1"}},
+		SRVSDConfig:   &types.SRVSDConfig{Name: "_sidecar._tcp.example.org"},
+	})
+	require.NoError(t, err)
+	require.IsType(t, &Multi{}, d)
+	assert.Len(t, d.(*Multi).Discoverers, 2)
+
+	d, err = NewFromConfig(&types.TargetGroup{
+		StaticTargets: &types.StaticTargets{Targets: []string{"a:1"}},
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &types.StaticTargets{}, d)
+}
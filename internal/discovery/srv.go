@@ -0,0 +1,57 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SRV discovers targets using DNS SRV records.
+type SRV struct {
+	Resolver *net.Resolver
+	Name     string // Full SRV record name, e.g. "_sidecar._tcp.example.org"
+}
+
+// SRVDiscoverer is an alias for the SRV discovery backend.
+type SRVDiscoverer = SRV
+
+// NewSRV creates a new SRV discoverer using the default resolver.
+func NewSRV(name string) *SRV {
+	return &SRV{
+		Resolver: net.DefaultResolver,
+		Name:     name,
+	}
+}
+
+// DiscoverTargets resolves the SRV record.
+// Returns a sorted list of targets referred to by host names.
+func (s *SRV) DiscoverTargets(ctx context.Context) ([]string, error) {
+	_, records, err := s.Resolver.LookupSRV(ctx, "", "", s.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve SRV record: %w", err)
+	}
+	targets := make([]string, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		targets = append(targets, net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
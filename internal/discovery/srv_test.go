@@ -0,0 +1,104 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newStubResolver returns a resolver answering SRV queries for the given name from a stub DNS server.
+func newStubResolver(t *testing.T, name string, records []dnsmessage.SRVResource) *net.Resolver {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+			question := query.Questions[0]
+			res := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+				Questions: query.Questions,
+			}
+			if question.Name.String() == name+"." && question.Type == dnsmessage.TypeSRV {
+				for i := range records {
+					res.Answers = append(res.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{
+							Name:  question.Name,
+							Type:  dnsmessage.TypeSRV,
+							Class: dnsmessage.ClassINET,
+							TTL:   60,
+						},
+						Body: &records[i],
+					})
+				}
+			} else {
+				res.RCode = dnsmessage.RCodeNameError
+			}
+			packed, err := res.Pack()
+			if err != nil {
+				continue
+			}
+			_, _ = conn.WriteTo(packed, addr)
+		}
+	}()
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+func TestSRVDiscoverer(t *testing.T) {
+	const name = "_sidecar._tcp.example.org"
+	resolver := newStubResolver(t, name, []dnsmessage.SRVResource{
+		{Target: dnsmessage.MustNewName("node2.example.org."), Port: 13080},
+		{Target: dnsmessage.MustNewName("node1.example.org."), Port: 13081},
+		{Target: dnsmessage.MustNewName("node1.example.org."), Port: 13080},
+	})
+
+	sd := NewSRV(name)
+	sd.Resolver = resolver
+	targets, err := sd.DiscoverTargets(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"node1.example.org:13080",
+		"node1.example.org:13081",
+		"node2.example.org:13080",
+	}, targets)
+
+	sd.Name = "_missing._tcp.example.org"
+	_, err = sd.DiscoverTargets(context.Background())
+	var dnsErr *net.DNSError
+	assert.ErrorAs(t, err, &dnsErr)
+	assert.ErrorContains(t, err, "failed to resolve SRV record")
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"context"
+	"net/http"
+
+	"gopkg.in/resty.v1"
+)
+
+// SnapshotAlert reports that the local snapshot is too far behind the cluster and a fetch couldn't fix it.
+type SnapshotAlert struct {
+	Hostname   string `json:"hostname"`
+	LocalSlot  uint64 `json:"local_slot"`
+	RemoteSlot uint64 `json:"remote_slot"` // zero if no remote snapshot was found
+	Gap        uint64 `json:"gap"`
+	Advice     string `json:"advice"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NeedsAlert returns whether a local snapshot more than maxAge slots behind could not be brought up to date.
+// Set fetchErr to the error of the download, if any.
+func NeedsAlert(advice Advice, reason AdviceReason, maxAge uint64, fetchErr error) bool {
+	switch advice {
+	case AdviceNothingFound:
+		return true // can't tell how far behind the node is
+	case AdviceFetch:
+		return fetchErr != nil && reason.RemoteSlot > reason.LocalSlot+maxAge
+	default:
+		return false
+	}
+}
+
+// PostAlert posts the alert as JSON to the webhook URL.
+func PostAlert(ctx context.Context, client *resty.Client, webhookURL string, alert *SnapshotAlert) error {
+	res, err := client.R().
+		SetContext(ctx).
+		SetHeader("content-type", "application/json").
+		SetBody(alert).
+		Post(webhookURL)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode() < http.StatusOK || res.StatusCode() >= http.StatusMultipleChoices {
+		return &StatusError{Op: "post alert", StatusCode: res.StatusCode(), Status: res.Status()}
+	}
+	return nil
+}
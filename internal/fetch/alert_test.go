@@ -0,0 +1,48 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/resty.v1"
+)
+
+func TestNeedsAlert(t *testing.T) {
+	behind := AdviceReason{LocalSlot: 100, RemoteSlot: 20000}
+	current := AdviceReason{LocalSlot: 100, RemoteSlot: 5000}
+	failed := errors.New("download failed")
+
+	assert.True(t, NeedsAlert(AdviceNothingFound, AdviceReason{}, 10000, nil))
+	assert.True(t, NeedsAlert(AdviceFetch, behind, 10000, failed))
+	assert.False(t, NeedsAlert(AdviceFetch, behind, 10000, nil), "fetch succeeded")
+	assert.False(t, NeedsAlert(AdviceFetch, current, 10000, failed), "not far enough behind")
+	assert.False(t, NeedsAlert(AdviceUpToDate, current, 10000, nil))
+}
+
+func TestPostAlert(t *testing.T) {
+	var received SnapshotAlert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("content-type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	alert := &SnapshotAlert{Hostname: "node1", LocalSlot: 100, RemoteSlot: 20000, Gap: 19900, Advice: "fetch"}
+	require.NoError(t, PostAlert(context.TODO(), resty.NewWithClient(server.Client()), server.URL, alert))
+	assert.Equal(t, *alert, received)
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+	err := PostAlert(context.TODO(), resty.NewWithClient(broken.Client()), broken.URL, alert)
+	assert.EqualError(t, err, "post alert: 502 Bad Gateway")
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrUnsupportedCompression is returned when decompressing an archive with an unknown compression format.
+var ErrUnsupportedCompression = errors.New("unsupported compression")
+
+// compressionSuffix returns the compression extension of a tar archive name, e.g. ".zst" for "x.tar.zst".
+// Returns "" for uncompressed archives and names not ending in a tar extension.
+func compressionSuffix(name string) string {
+	ext := path.Ext(name)
+	if ext == ".tar" || !strings.HasSuffix(strings.TrimSuffix(name, ext), ".tar") {
+		return ""
+	}
+	return ext
+}
+
+// canDecompress returns whether archives with the given compression extension can be decompressed.
+func canDecompress(compression string) bool {
+	switch compression {
+	case "", ".zst", ".bz2", ".gz":
+		return true
+	default:
+		return false
+	}
+}
+
+// newDecompressor returns a reader decompressing data with the given compression extension.
+func newDecompressor(compression string, rd io.Reader) (io.ReadCloser, error) {
+	switch compression {
+	case "":
+		return io.NopCloser(rd), nil
+	case ".zst":
+		dec, err := zstd.NewReader(rd)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case ".bz2":
+		return io.NopCloser(bzip2.NewReader(rd)), nil
+	case ".gz":
+		return gzip.NewReader(rd)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedCompression, compression)
+	}
+}
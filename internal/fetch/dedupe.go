@@ -0,0 +1,132 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/zap"
+)
+
+// linkLocalCopies places files already present in other slot dirs of root into dest,
+// instead of downloading them again.
+// Archival nodes keep many incremental snapshots sharing the same full snapshot this way.
+//
+// Returns the files that still need to be downloaded.
+func linkLocalCopies(root string, dest string, files []*types.SnapshotFile, log *zap.Logger) []*types.SnapshotFile {
+	dirs := localCopyDirs(root, dest)
+	var missing []*types.SnapshotFile
+	for _, file := range files {
+		src := findLocalCopy(dirs, file)
+		if src == "" {
+			missing = append(missing, file)
+			continue
+		}
+		if err := linkOrCopy(src, filepath.Join(dest, filepath.Base(src))); err != nil {
+			log.Warn("Failed to reuse local copy of snapshot file, downloading it",
+				zap.String("snapshot", file.FileName),
+				zap.String("source", src),
+				zap.Error(err))
+			missing = append(missing, file)
+			continue
+		}
+		log.Info("Reusing local copy of snapshot file",
+			zap.String("snapshot", file.FileName),
+			zap.String("source", src))
+	}
+	return missing
+}
+
+// localCopyDirs returns root and its slot dirs, except dest.
+func localCopyDirs(root string, dest string) []string {
+	dirs := []string{root}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return dirs
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := strconv.ParseUint(entry.Name(), 10, 64); err != nil {
+			continue
+		}
+		if dir := filepath.Join(root, entry.Name()); dir != filepath.Clean(dest) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// findLocalCopy returns the path of a snapshot file with the same slot and hash as file in one of dirs.
+// Returns an empty string if there is none.
+func findLocalCopy(dirs []string, file *types.SnapshotFile) string {
+	if file.Validate() != nil {
+		return ""
+	}
+	for _, dir := range dirs {
+		local, err := ledger.ListSnapshotFiles(os.DirFS(dir))
+		if err != nil {
+			continue
+		}
+		for _, f := range local {
+			if f.Compare(file) == 0 {
+				return filepath.Join(dir, f.FileName)
+			}
+		}
+	}
+	return ""
+}
+
+// linkOrCopy hardlinks src to dst, falling back to a copy if they are on different file systems.
+func linkOrCopy(src string, dst string) error {
+	err := os.Link(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	return copyFile(src, dst)
+}
+
+// copyFile copies src to dst via a temporary file, so dst never holds partial content.
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmpPath := dst + ".part"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
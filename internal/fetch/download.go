@@ -0,0 +1,351 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// Downloader downloads snapshots from sidecars into a ledger dir.
+type Downloader struct {
+	// NewClient creates a sidecar client for the given target.
+	NewClient func(target string) *SidecarClient
+	// StagingRoot holds incomplete downloads. Defaults to the destination dir.
+	StagingRoot string
+	// MultiSource downloads files from all sources offering the same snapshot in parallel.
+	MultiSource bool
+	// SlotSubdir places each snapshot into a subdir of the destination named after its slot.
+	// Files already present in the destination or other slot dirs are hardlinked instead of downloaded.
+	SlotSubdir bool
+
+	Log *zap.Logger
+}
+
+func NewDownloader() *Downloader {
+	return &Downloader{
+		NewClient: func(target string) *SidecarClient {
+			return NewSidecarClient(TargetURL(target))
+		},
+		Log: zap.NewNop(),
+	}
+}
+
+// TargetURL returns the sidecar URL of a target as reported by the tracker.
+// Targets without a scheme default to HTTP.
+func TargetURL(target string) string {
+	if strings.Contains(target, "://") {
+		return target
+	}
+	return "http://" + TargetHost(target)
+}
+
+// TargetHost returns a target without scheme in a form usable as URL host,
+// i.e. with IPv6 literals lacking a port enclosed in brackets.
+func TargetHost(target string) string {
+	if ip := net.ParseIP(target); ip != nil && strings.Contains(target, ":") {
+		return "[" + target + "]"
+	}
+	return target
+}
+
+// DownloadBestEffort tries downloading the given snapshots in order until one succeeds.
+// Gives up without trying further sources if the files can't be installed or credentials are rejected.
+// Returns the snapshot that was downloaded, and a report of the successful download.
+func (d *Downloader) DownloadBestEffort(ctx context.Context, snaps []types.SnapshotSource, dest string) (*types.SnapshotSource, *DownloadReport, error) {
+	if len(snaps) == 0 {
+		return nil, nil, fmt.Errorf("no snapshot sources")
+	}
+	if err := d.Preflight(dest); err != nil {
+		return nil, nil, err
+	}
+	var lastErr error
+	for i := range snaps {
+		snap := &snaps[i]
+		var peers []*types.SnapshotSource
+		if d.MultiSource {
+			peers = samePeers(snaps, snap)
+		}
+		report, err := d.downloadSnapshot(ctx, snap, peers, dest)
+		if err == nil {
+			return snap, report, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		var installErr *InstallError
+		if errors.As(err, &installErr) {
+			return nil, nil, err // other sources won't help
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			return nil, nil, err // other sources check the same credentials
+		}
+		lastErr = err
+		d.Log.Warn("Snapshot download failed, trying next source",
+			zap.String("target", snap.Target),
+			zap.Uint64("slot", snap.Slot),
+			zap.Error(err))
+	}
+	return nil, nil, fmt.Errorf("all %d snapshot sources failed, last error: %w", len(snaps), lastErr)
+}
+
+// samePeers returns the other sources offering the same snapshot.
+func samePeers(snaps []types.SnapshotSource, snap *types.SnapshotSource) (peers []*types.SnapshotSource) {
+	for i := range snaps {
+		peer := &snaps[i]
+		if peer.Target != snap.Target && peer.Slot == snap.Slot && peer.Hash == snap.Hash {
+			peers = append(peers, peer)
+		}
+	}
+	return
+}
+
+// DownloadSnapshot downloads all files of a snapshot and moves them into the dest dir once complete.
+func (d *Downloader) DownloadSnapshot(ctx context.Context, snap *types.SnapshotSource, dest string) error {
+	if err := d.Preflight(dest); err != nil {
+		return err
+	}
+	_, err := d.downloadSnapshot(ctx, snap, nil, dest)
+	return err
+}
+
+// DestDir returns the dir the files of a snapshot are placed in, given the destination dir.
+func (d *Downloader) DestDir(dest string, snap *types.SnapshotInfo) string {
+	if !d.SlotSubdir {
+		return dest
+	}
+	return filepath.Join(dest, strconv.FormatUint(snap.Slot, 10))
+}
+
+// Preflight checks that the dest and staging dirs are writable, before transferring anything.
+func (d *Downloader) Preflight(dest string) error {
+	if err := CheckWritable(dest); err != nil {
+		return err
+	}
+	if d.StagingRoot == "" || d.StagingRoot == dest {
+		return nil
+	}
+	if err := os.MkdirAll(d.StagingRoot, 0755); err != nil {
+		return fmt.Errorf("failed to create staging dir: %w", err)
+	}
+	return CheckWritable(d.StagingRoot)
+}
+
+// downloadSnapshot is like DownloadSnapshot,
+// but also fetches parts of files from the given peers offering the same snapshot.
+func (d *Downloader) downloadSnapshot(ctx context.Context, snap *types.SnapshotSource, peers []*types.SnapshotSource, dest string) (*DownloadReport, error) {
+	log := d.Log.With(zap.String("target", snap.Target), zap.Uint64("slot", snap.Slot))
+	log.Info("Downloading a snapshot",
+		zap.Stringer("hash", snap.Hash),
+		zap.Int("num_files", len(snap.Files)),
+		zap.Uint64("size", snap.TotalSize))
+
+	root := dest
+	dest = d.DestDir(dest, &snap.SnapshotInfo)
+	if d.SlotSubdir {
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return nil, &InstallError{Err: fmt.Errorf("failed to create slot dir: %w", err)}
+		}
+	}
+	stagingRoot := d.StagingRoot
+	if stagingRoot == "" {
+		stagingRoot = dest
+	}
+	stagingDir := StagingDir(stagingRoot, &snap.SnapshotInfo)
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging dir: %w", err)
+	}
+
+	files, err := MissingFiles(dest, &snap.SnapshotInfo)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) < len(snap.Files) {
+		log.Info("Reusing snapshot files already in ledger dir",
+			zap.Int("num_reused", len(snap.Files)-len(files)))
+	}
+	if d.SlotSubdir {
+		files = linkLocalCopies(root, dest, files, log)
+	}
+
+	client := d.NewClient(snap.Target)
+	peerClients := make([]*SidecarClient, len(peers))
+	for i, peer := range peers {
+		peerClients[i] = d.NewClient(peer.Target)
+	}
+	report := &DownloadReport{Files: make([]FileReport, len(files))}
+	beforeDownload := time.Now()
+	group, groupCtx := errgroup.WithContext(ctx)
+	for i, file := range files {
+		i_, file_ := i, file
+		group.Go(func() error {
+			var fileReport FileReport
+			var err error
+			// A copy already in the ledger dir is checked with a conditional request to the primary source.
+			sources := fileSources(client, file_, peers, peerClients)
+			if len(sources) > 1 && currentETag(filepath.Join(dest, client.LocalFileName(file_.FileName)), file_.FileName) == "" {
+				multi := NewMultiSourceDownloader(sources...)
+				multi.Log = log
+				fileReport, err = multi.DownloadSnapshotFileWithReport(groupCtx, stagingDir, file_.FileName, int64(file_.Size))
+			} else {
+				fileReport, err = client.downloadSnapshotFileWithReport(groupCtx, stagingDir, dest, file_.FileName)
+			}
+			report.Files[i_] = fileReport
+			if err != nil {
+				log.Error("Download failed",
+					zap.String("snapshot", file_.FileName),
+					zap.String("source", fileReport.Source),
+					zap.Error(err))
+				return err
+			}
+			if fileReport.Unchanged {
+				log.Info("File in ledger dir is current, skipping download", zap.String("snapshot", file_.FileName))
+				return nil
+			}
+			log.Info("Downloaded file",
+				zap.String("snapshot", file_.FileName),
+				zap.String("source", fileReport.Source),
+				zap.Int64("bytes", fileReport.Bytes),
+				zap.Duration("download_time", fileReport.Elapsed),
+				zap.Float64("bytes_per_sec", fileReport.BytesPerSec()))
+			return nil
+		})
+	}
+	downloadErr := group.Wait()
+	downloadDuration := time.Since(beforeDownload)
+	report.Elapsed = downloadDuration
+
+	if downloadErr != nil {
+		log.Info("Aborting download", zap.Duration("download_time", downloadDuration))
+		if ctx.Err() != nil || isRetryable(downloadErr) {
+			// Keep partial files so the next attempt can resume.
+			log.Info("Keeping partial download", zap.String("staging_dir", stagingDir))
+		} else if err := os.RemoveAll(stagingDir); err != nil {
+			log.Warn("Failed to clean up staging dir", zap.Error(err))
+		}
+		return nil, downloadErr
+	}
+	log.Info("Download completed",
+		zap.Duration("download_time", downloadDuration),
+		zap.Int64("bytes", report.TotalBytes()),
+		zap.Float64("bytes_per_sec", report.BytesPerSec()))
+
+	names := make([]string, 0, len(files))
+	for i, file := range files {
+		if !report.Files[i].Unchanged {
+			names = append(names, client.LocalFileName(file.FileName))
+		}
+	}
+	if err := InstallSnapshot(stagingDir, dest, names); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// fileSources returns the clients of all sources offering the same file, starting with the primary one.
+func fileSources(primary *SidecarClient, file *types.SnapshotFile, peers []*types.SnapshotSource, peerClients []*SidecarClient) []*SidecarClient {
+	sources := []*SidecarClient{primary}
+	for i, peer := range peers {
+		for _, peerFile := range peer.Files {
+			if peerFile.FileName == file.FileName && peerFile.Size == file.Size {
+				sources = append(sources, peerClients[i])
+				break
+			}
+		}
+	}
+	return sources
+}
+
+// MissingFiles returns the files of a snapshot that are not yet present in the ledger dir.
+// Files without a known hash count as missing even if present,
+// the Downloader asks the server whether such copies are current.
+//
+// Fails if the snapshot could not be restored after downloading them,
+// e.g. when an incremental snapshot's base is neither available locally nor remotely.
+func MissingFiles(ledgerDir string, snap *types.SnapshotInfo) ([]*types.SnapshotFile, error) {
+	if len(snap.Files) == 0 {
+		return nil, nil
+	}
+	local, err := ledger.ListSnapshotFiles(os.DirFS(ledgerDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var missing []*types.SnapshotFile
+	for _, file := range snap.Files {
+		if !containsSnapshotFile(local, file) {
+			missing = append(missing, file)
+		}
+	}
+	available := append(local, missing...)
+	if _, err := ledger.ResolveChain(available, snap.Files[0]); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// containsSnapshotFile returns whether files include file.
+// Files without a known hash never match.
+func containsSnapshotFile(files []*types.SnapshotFile, file *types.SnapshotFile) bool {
+	if file.Validate() != nil {
+		return false
+	}
+	for _, f := range files {
+		if f.Compare(file) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CompleteChain returns snap with the files of its base snapshots appended,
+// if the tracker reported them as separate entries of the same target.
+//
+// Snapshots whose chain is already complete are returned unchanged.
+func CompleteChain(snap types.SnapshotSource, remote []types.SnapshotSource) types.SnapshotSource {
+	// Bounded by the number of entries in case of cyclic chains.
+	for i := 0; i < len(remote) && len(snap.Files) > 0; i++ {
+		base := snap.Files[len(snap.Files)-1].BaseSlot
+		if base == 0 {
+			break
+		}
+		var found bool
+		for _, other := range remote {
+			if other.Target == snap.Target && other.Slot == base && len(other.Files) > 0 {
+				files := make([]*types.SnapshotFile, 0, len(snap.Files)+len(other.Files))
+				snap.Files = append(append(files, snap.Files...), other.Files...)
+				snap.TotalSize += other.TotalSize
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return snap
+}
@@ -0,0 +1,512 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/atomic"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestDownloader_DownloadBestEffort(t *testing.T) {
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader([]byte("A")))
+	}))
+	defer working.Close()
+
+	snapInfo := types.SnapshotInfo{
+		Slot:  100,
+		Files: []*types.SnapshotFile{{FileName: snapshotName, Slot: 100}},
+	}
+	snaps := []types.SnapshotSource{
+		{SnapshotInfo: snapInfo, Target: broken.URL},
+		{SnapshotInfo: snapInfo, Target: working.URL},
+	}
+
+	ledgerDir := t.TempDir()
+	downloader := NewDownloader()
+	downloader.Log = zaptest.NewLogger(t)
+	snap, report, err := downloader.DownloadBestEffort(context.TODO(), snaps, ledgerDir)
+	require.NoError(t, err)
+	assert.Equal(t, working.URL, snap.Target)
+	require.Len(t, report.Files, 1)
+	assert.Equal(t, snapshotName, report.Files[0].FileName)
+	assert.Equal(t, strings.TrimPrefix(working.URL, "http://"), report.Files[0].Source)
+	assert.Equal(t, int64(1), report.Files[0].Bytes)
+	assert.Equal(t, int64(1), report.TotalBytes())
+
+	_, err = os.Stat(filepath.Join(ledgerDir, snapshotName))
+	assert.NoError(t, err)
+	_, err = os.Stat(StagingDir(ledgerDir, &snapInfo))
+	assert.True(t, os.IsNotExist(err))
+
+	_, _, err = downloader.DownloadBestEffort(context.TODO(), snaps[:1], ledgerDir)
+	assert.EqualError(t, err, "all 1 snapshot sources failed, last error: download snapshot: 500 Internal Server Error")
+	var statusErr *StatusError
+	assert.ErrorAs(t, err, &statusErr)
+}
+
+func TestDownloader_DownloadBestEffort_ErrorKinds(t *testing.T) {
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer unauthorized.Close()
+	var hits atomic.Int32
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Inc()
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader([]byte("A")))
+	}))
+	defer working.Close()
+
+	snapInfo := types.SnapshotInfo{
+		Slot:  100,
+		Files: []*types.SnapshotFile{{FileName: snapshotName, Slot: 100}},
+	}
+	downloader := NewDownloader()
+	downloader.Log = zaptest.NewLogger(t)
+
+	// Missing snapshots are skipped.
+	_, _, err := downloader.DownloadBestEffort(context.TODO(), []types.SnapshotSource{
+		{SnapshotInfo: snapInfo, Target: notFound.URL},
+	}, t.TempDir())
+	assert.ErrorIs(t, err, ErrSnapshotNotFound)
+	snap, _, err := downloader.DownloadBestEffort(context.TODO(), []types.SnapshotSource{
+		{SnapshotInfo: snapInfo, Target: notFound.URL},
+		{SnapshotInfo: snapInfo, Target: working.URL},
+	}, t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, working.URL, snap.Target)
+
+	// Rejected credentials abort.
+	hits.Store(0)
+	_, _, err = downloader.DownloadBestEffort(context.TODO(), []types.SnapshotSource{
+		{SnapshotInfo: snapInfo, Target: unauthorized.URL},
+		{SnapshotInfo: snapInfo, Target: working.URL},
+	}, t.TempDir())
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	assert.Equal(t, int32(0), hits.Load(), "should not try other sources")
+}
+
+func TestDownloader_DownloadSnapshot_Resume(t *testing.T) {
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	content := bytes.Repeat([]byte("A"), 1000)
+
+	// First server drops the connection halfway through.
+	var interrupt atomic.Bool
+	interrupt.Store(true)
+	var rangeHeader atomic.String
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if interrupt.Load() {
+			w.Header().Set("content-length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:400])
+			w.(http.Flusher).Flush()
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			_ = conn.Close()
+			return
+		}
+		rangeHeader.Store(r.Header.Get("range"))
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	snap := &types.SnapshotSource{
+		SnapshotInfo: types.SnapshotInfo{
+			Slot:  100,
+			Files: []*types.SnapshotFile{{FileName: snapshotName, Slot: 100}},
+		},
+		Target: server.URL,
+	}
+	ledgerDir := t.TempDir()
+	downloader := NewDownloader()
+	downloader.Log = zaptest.NewLogger(t)
+
+	err := downloader.DownloadSnapshot(context.TODO(), snap, ledgerDir)
+	require.Error(t, err)
+	partPath := filepath.Join(StagingDir(ledgerDir, &snap.SnapshotInfo), snapshotName+".part")
+	stat, err := os.Stat(partPath)
+	require.NoError(t, err, "partial download should be kept")
+	assert.Equal(t, int64(400), stat.Size())
+
+	// Re-run resumes where the first run left off.
+	interrupt.Store(false)
+	require.NoError(t, downloader.DownloadSnapshot(context.TODO(), snap, ledgerDir))
+	assert.Equal(t, "bytes=400-", rangeHeader.Load())
+	actual, err := os.ReadFile(filepath.Join(ledgerDir, snapshotName))
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+}
+
+func TestDownloader_DownloadBestEffort_Deadline(t *testing.T) {
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+
+	// Slow server stalls after sending part of the file.
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-length", "1000")
+		_, _ = w.Write(bytes.Repeat([]byte("A"), 400))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	var hits atomic.Int32
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Inc()
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader([]byte("A")))
+	}))
+	defer other.Close()
+
+	snapInfo := types.SnapshotInfo{
+		Slot:  100,
+		Files: []*types.SnapshotFile{{FileName: snapshotName, Slot: 100}},
+	}
+	ledgerDir := t.TempDir()
+	downloader := NewDownloader()
+	downloader.Log = zaptest.NewLogger(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := downloader.DownloadBestEffort(ctx, []types.SnapshotSource{
+		{SnapshotInfo: snapInfo, Target: slow.URL},
+		{SnapshotInfo: snapInfo, Target: other.URL},
+	}, ledgerDir)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second, "should return soon after the deadline")
+	assert.Equal(t, int32(0), hits.Load(), "should not try other sources")
+
+	stat, err := os.Stat(filepath.Join(StagingDir(ledgerDir, &snapInfo), snapshotName+".part"))
+	require.NoError(t, err, "partial download should be kept")
+	assert.Equal(t, int64(400), stat.Size())
+}
+
+func TestDownloader_DownloadBestEffort_InstallError(t *testing.T) {
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Inc()
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader([]byte("A")))
+	}))
+	defer server.Close()
+
+	snapInfo := types.SnapshotInfo{
+		Slot:  100,
+		Files: []*types.SnapshotFile{{FileName: snapshotName, Slot: 100}},
+	}
+	snaps := []types.SnapshotSource{
+		{SnapshotInfo: snapInfo, Target: server.URL},
+		{SnapshotInfo: snapInfo, Target: server.URL},
+	}
+
+	// A dir is in the way of the snapshot file, so installing fails.
+	ledgerDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(ledgerDir, snapshotName), 0755))
+	downloader := NewDownloader()
+	downloader.StagingRoot = t.TempDir()
+	_, _, err := downloader.DownloadBestEffort(context.TODO(), snaps, ledgerDir)
+	var installErr *InstallError
+	assert.ErrorAs(t, err, &installErr)
+	assert.Equal(t, int32(1), hits.Load(), "should not try other sources")
+}
+
+func TestDownloader_DownloadBestEffort_NotWritable(t *testing.T) {
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Inc()
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader([]byte("A")))
+	}))
+	defer server.Close()
+	snaps := []types.SnapshotSource{{
+		SnapshotInfo: types.SnapshotInfo{
+			Slot:  100,
+			Files: []*types.SnapshotFile{{FileName: snapshotName, Slot: 100}},
+		},
+		Target: server.URL,
+	}}
+
+	// Destination dir does not exist.
+	downloader := NewDownloader()
+	_, _, err := downloader.DownloadBestEffort(context.TODO(), snaps, filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorContains(t, err, "is not writable")
+	assert.Equal(t, int32(0), hits.Load(), "should fail before downloading")
+
+	// Staging dir is read-only.
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only dirs")
+	}
+	stagingRoot := t.TempDir()
+	require.NoError(t, os.Chmod(stagingRoot, 0555))
+	defer os.Chmod(stagingRoot, 0755)
+	downloader.StagingRoot = stagingRoot
+	_, _, err = downloader.DownloadBestEffort(context.TODO(), snaps, t.TempDir())
+	assert.ErrorContains(t, err, "is not writable")
+	assert.Equal(t, int32(0), hits.Load(), "should fail before downloading")
+}
+
+func TestDownloader_DownloadSnapshot_ReuseBase(t *testing.T) {
+	const fullName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	const incName = "incremental-snapshot-100-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	hash := solana.MustHashFromBase58("AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr")
+
+	var requested []string
+	var lock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requested = append(requested, path.Base(r.URL.Path))
+		lock.Unlock()
+		http.ServeContent(w, r, path.Base(r.URL.Path), time.Time{}, bytes.NewReader([]byte("A")))
+	}))
+	defer server.Close()
+
+	snap := &types.SnapshotSource{
+		SnapshotInfo: types.SnapshotInfo{
+			Slot: 200,
+			Hash: hash,
+			Files: []*types.SnapshotFile{
+				{FileName: incName, Slot: 200, BaseSlot: 100, Hash: hash, Ext: ".tar.zst"},
+				{FileName: fullName, Slot: 100, Hash: hash, Ext: ".tar.zst"},
+			},
+		},
+		Target: server.URL,
+	}
+	downloader := NewDownloader()
+	downloader.Log = zaptest.NewLogger(t)
+
+	t.Run("MissingBase", func(t *testing.T) {
+		orphan := *snap
+		orphan.Files = snap.Files[:1]
+		err := downloader.DownloadSnapshot(context.TODO(), &orphan, t.TempDir())
+		assert.ErrorIs(t, err, ledger.ErrMissingBase)
+		assert.Empty(t, requested)
+	})
+	t.Run("BaseExists", func(t *testing.T) {
+		ledgerDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(ledgerDir, fullName), []byte("A"), 0644))
+		require.NoError(t, downloader.DownloadSnapshot(context.TODO(), snap, ledgerDir))
+		assert.Equal(t, []string{incName}, requested)
+		_, err := os.Stat(filepath.Join(ledgerDir, incName))
+		assert.NoError(t, err)
+	})
+}
+
+func TestDownloader_DownloadBestEffort_NotModified(t *testing.T) {
+	// Without a known hash, files in the ledger dir are only reused if the server reports them unchanged.
+	const name = "snapshot-100-11111111111111111111111111111111.tar.zst"
+
+	var etag, content atomic.String
+	etag.Store(`"v1"`)
+	content.Store("A")
+	var requests, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		if r.Header.Get("if-none-match") == etag.Load() {
+			notModified.Inc()
+		}
+		w.Header().Set("etag", etag.Load())
+		http.ServeContent(w, r, path.Base(r.URL.Path), time.Time{}, strings.NewReader(content.Load()))
+	}))
+	defer server.Close()
+
+	snap := types.SnapshotSource{
+		SnapshotInfo: types.SnapshotInfo{
+			Slot:  100,
+			Files: []*types.SnapshotFile{{FileName: name, Slot: 100, Ext: ".tar.zst", Size: 1}},
+		},
+		Target: server.URL,
+	}
+	downloader := NewDownloader()
+	downloader.Log = zaptest.NewLogger(t)
+	ledgerDir := t.TempDir()
+	download := func() *DownloadReport {
+		_, report, err := downloader.DownloadBestEffort(context.TODO(), []types.SnapshotSource{snap}, ledgerDir)
+		require.NoError(t, err)
+		require.Len(t, report.Files, 1)
+		return report
+	}
+	assertLedgerDir := func(content string, etag string) {
+		data, err := os.ReadFile(filepath.Join(ledgerDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+		data, err = os.ReadFile(filepath.Join(ledgerDir, "."+name+".etag"))
+		require.NoError(t, err)
+		assert.Equal(t, etag, string(data))
+		_, err = os.Stat(StagingDir(ledgerDir, &snap.SnapshotInfo))
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	}
+
+	report := download()
+	assert.False(t, report.Files[0].Unchanged)
+	assert.Equal(t, int64(1), report.TotalBytes())
+	assert.Equal(t, int32(0), notModified.Load())
+	assertLedgerDir("A", `"v1"`)
+
+	report = download()
+	assert.True(t, report.Files[0].Unchanged)
+	assert.Equal(t, int64(0), report.TotalBytes())
+	assert.Equal(t, int32(1), notModified.Load())
+	assertLedgerDir("A", `"v1"`)
+
+	etag.Store(`"v2"`)
+	content.Store("B")
+	report = download()
+	assert.False(t, report.Files[0].Unchanged)
+	assert.Equal(t, int64(1), report.TotalBytes())
+	assertLedgerDir("B", `"v2"`)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestDownloader_DownloadBestEffort_SlotSubdir(t *testing.T) {
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader([]byte("A")))
+	}))
+	defer server.Close()
+	snaps := []types.SnapshotSource{{
+		SnapshotInfo: types.SnapshotInfo{
+			Slot:  100,
+			Files: []*types.SnapshotFile{{FileName: snapshotName, Slot: 100}},
+		},
+		Target: server.URL,
+	}}
+
+	ledgerDir := t.TempDir()
+	downloader := NewDownloader()
+	downloader.SlotSubdir = true
+	snap, _, err := downloader.DownloadBestEffort(context.TODO(), snaps, ledgerDir)
+	require.NoError(t, err)
+	slotDir := downloader.DestDir(ledgerDir, &snap.SnapshotInfo)
+	assert.Equal(t, filepath.Join(ledgerDir, "100"), slotDir)
+	_, err = os.Stat(filepath.Join(slotDir, snapshotName))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(ledgerDir, snapshotName))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCompleteChain(t *testing.T) {
+	full := &types.SnapshotFile{FileName: "full", Slot: 100}
+	inc := &types.SnapshotFile{FileName: "inc", Slot: 200, BaseSlot: 100}
+	remote := []types.SnapshotSource{
+		{
+			SnapshotInfo: types.SnapshotInfo{Slot: 200, Files: []*types.SnapshotFile{inc}, TotalSize: 2},
+			Target:       "a",
+		},
+		{
+			SnapshotInfo: types.SnapshotInfo{Slot: 100, Files: []*types.SnapshotFile{full}, TotalSize: 1},
+			Target:       "b",
+		},
+		{
+			SnapshotInfo: types.SnapshotInfo{Slot: 100, Files: []*types.SnapshotFile{full}, TotalSize: 1},
+			Target:       "a",
+		},
+	}
+
+	snap := CompleteChain(remote[0], remote)
+	assert.Equal(t, []*types.SnapshotFile{inc, full}, snap.Files)
+	assert.Equal(t, uint64(3), snap.TotalSize)
+	assert.Equal(t, []*types.SnapshotFile{inc}, remote[0].Files, "input must not be modified")
+
+	// Already complete.
+	assert.Equal(t, remote[1], CompleteChain(remote[1], remote))
+	// Base not reported by the same target.
+	assert.Equal(t, remote[0], CompleteChain(remote[0], remote[:2]))
+}
+
+func TestDownloader_DownloadBestEffort_SlotSubdir_LinkLocalCopies(t *testing.T) {
+	const (
+		fullName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+		incName  = "incremental-snapshot-100-200-7jMmeXZSNcWPrB2RsTdeXfXrsyW5c1BfPjqoLW2X5T7V.tar.zst"
+	)
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		http.ServeContent(w, r, incName, time.Time{}, bytes.NewReader([]byte("B")))
+	}))
+	defer server.Close()
+	full, err := types.ParseSnapshotFileName(fullName)
+	require.NoError(t, err)
+	inc, err := types.ParseSnapshotFileName(incName)
+	require.NoError(t, err)
+	snaps := []types.SnapshotSource{{
+		SnapshotInfo: types.SnapshotInfo{
+			Slot:  200,
+			Files: []*types.SnapshotFile{inc, full},
+		},
+		Target: server.URL,
+	}}
+
+	// Full snapshot was downloaded into its own slot dir before.
+	ledgerDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(ledgerDir, "100"), 0755))
+	localFull := filepath.Join(ledgerDir, "100", fullName)
+	require.NoError(t, os.WriteFile(localFull, []byte("A"), 0644))
+
+	downloader := NewDownloader()
+	downloader.SlotSubdir = true
+	downloader.Log = zaptest.NewLogger(t)
+	_, _, err = downloader.DownloadBestEffort(context.TODO(), snaps, ledgerDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/v1/snapshot/" + incName}, requests, "only downloads the incremental snapshot")
+
+	linked, err := os.Stat(filepath.Join(ledgerDir, "200", fullName))
+	require.NoError(t, err)
+	original, err := os.Stat(localFull)
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(original, linked), "hardlinks the full snapshot")
+	_, err = os.Stat(filepath.Join(ledgerDir, "200", incName))
+	assert.NoError(t, err)
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	require.NoError(t, os.WriteFile(src, []byte("data"), 0644))
+	dst := filepath.Join(dir, "dst")
+	require.NoError(t, copyFile(src, dst))
+	data, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	_, err = os.Stat(dst + ".part")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestTargetURL(t *testing.T) {
+	for _, tc := range []struct{ target, want string }{
+		{"10.0.0.1:13080", "http://10.0.0.1:13080"},
+		{"solana-1.example.org", "http://solana-1.example.org"},
+		{"https://solana-1.example.org/sidecar", "https://solana-1.example.org/sidecar"},
+		{"[2001:db8::1]:13080", "http://[2001:db8::1]:13080"},
+		{"[2001:db8::1]", "http://[2001:db8::1]"},
+		{"2001:db8::1", "http://[2001:db8::1]"},
+		{"http://[2001:db8::1]:13080", "http://[2001:db8::1]:13080"},
+	} {
+		assert.Equal(t, tc.want, TargetURL(tc.target), tc.target)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var (
+	// ErrSnapshotNotFound is returned when a sidecar doesn't have the requested snapshot file.
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrUnauthorized is returned when a server rejects the credentials of a request.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrTrackerUnavailable is returned when no tracker could be reached, or all failed with server errors.
+	ErrTrackerUnavailable = errors.New("tracker unavailable")
+	// ErrBadResponse is returned when a server response can't be decoded.
+	ErrBadResponse = errors.New("bad response")
+)
+
+// kindError marks an error as one of the sentinel errors of this package,
+// keeping the message and the underlying cause accessible via errors.As.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// withKind wraps err such that errors.Is(err, kind) holds.
+func withKind(kind error, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// decodeError marks JSON decoding errors as ErrBadResponse.
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return withKind(ErrBadResponse, err)
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
+)
+
+// etagPath returns the path of the hidden file storing the ETag of a downloaded snapshot file.
+func etagPath(path string) string {
+	dir, name := filepath.Split(path)
+	return filepath.Join(dir, "."+name+".etag")
+}
+
+// storeETag records the ETag a server returned for the file at path, if any.
+func storeETag(path string, etag string) {
+	if etag == "" {
+		_ = os.Remove(etagPath(path))
+		return
+	}
+	_ = os.WriteFile(etagPath(path), []byte(etag), 0666)
+}
+
+// currentETag returns the ETag to send to check whether the file at path is still current,
+// or an empty string if there is no such file.
+//
+// Prefers the ETag stored when downloading the file, falling back to the one sidecars derive from the remote name.
+func currentETag(path string, name string) string {
+	if stat, err := os.Stat(path); err != nil || !stat.Mode().IsRegular() {
+		return ""
+	}
+	if etag, err := os.ReadFile(etagPath(path)); err == nil && len(etag) > 0 {
+		return strings.TrimSpace(string(etag))
+	}
+	if file := ledger.ParseSnapshotFileName(name); file != nil {
+		return file.ETag()
+	}
+	return ""
+}
+
+// moveETag moves the stored ETag of a file along with it, if any.
+func moveETag(oldPath string, newPath string) error {
+	err := os.Rename(etagPath(oldPath), etagPath(newPath))
+	if os.IsNotExist(err) {
+		_ = os.Remove(etagPath(newPath)) // don't keep the ETag of a replaced file
+		return nil
+	}
+	return err
+}
+
+// removeETag removes the stored ETag of a deleted file, if any.
+func removeETag(path string) error {
+	if err := os.Remove(etagPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
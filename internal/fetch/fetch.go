@@ -14,44 +14,169 @@
 
 package fetch
 
-import "go.blockdaemon.com/solana/cluster-manager/types"
+import (
+	"fmt"
+	"time"
 
-// ShouldFetchSnapshot returns whether a new snapshot should be fetched.
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// ShouldFetchSnapshot returns whether a new snapshot should be fetched, and why.
 //
 // If advice is AdviceFetch, `minSlot` indicates the lowest slot number at which fetch is useful.
+// Which of the remote snapshots to download is up to a SnapshotPolicy.
+//
+// The best local and remote snapshots are compared by slot and kind using types.SnapshotFile.Compare:
+//
+//	remote vs local                      advice
+//	older                                up to date (RuleMinSlots)
+//	same slot, not better                up to date (RuleSameSlot)
+//	same slot, full replacing incr.      fetch if minAge is 0 (RuleFullReplacesIncremental), else up to date (RuleMinSlots)
+//	newer by less than minAge            up to date (RuleMinSlots)
+//	newer by at least minAge             fetch (RuleNewerRemote)
+//
+// Full and incremental snapshots at different slots are only compared by slot,
+// e.g. a remote full snapshot one slot ahead of a local incremental one is fetched if minAge is at most 1.
+// A remote incremental snapshot at the same slot as a local one is never better,
+// even if based on a newer full snapshot, since fetching it would require that full snapshot as well.
 func ShouldFetchSnapshot(
 	local []*types.SnapshotInfo,
 	remote []types.SnapshotSource,
 	minAge uint64, // if diff between remote and local is smaller than minAge, use local
 	maxAge uint64, // if diff between latest remote and any other remote is larger than maxAge, abort
-) (minSlot uint64, advice Advice) {
+) (minSlot uint64, advice Advice, reason AdviceReason) {
+	if len(local) > 0 {
+		reason.LocalSlot = local[0].Slot
+	}
+
 	// Check if remote reports to snapshots.
 	if len(remote) == 0 {
 		advice = AdviceNothingFound
+		reason.Rule = RuleNoRemoteSnapshots
 		return
 	}
 
-	// Compare local and remote slot numbers.
-	remoteSlot := remote[0].Slot
-	var localSlot uint64
-	if len(local) > 0 {
-		localSlot = local[0].Slot
+	// Compare local and best remote snapshots.
+	best := &remote[0].SnapshotInfo
+	for i := range remote {
+		if compareSnapshots(&remote[i].SnapshotInfo, best) > 0 {
+			best = &remote[i].SnapshotInfo
+		}
+	}
+	reason.RemoteSlot = best.Slot
+	remoteSlot := reason.RemoteSlot
+	if maxAge < remoteSlot {
+		minSlot = remoteSlot - maxAge
+	}
+
+	// Without a local snapshot, any remote one is better than nothing.
+	if len(local) == 0 {
+		advice = AdviceFetch
+		reason.Rule = RuleNoLocalSnapshots
+		reason.MinSlot = minSlot
+		return
+	}
+	localSlot := reason.LocalSlot
+
+	// At the same slot, only a full snapshot replacing a local incremental one is an improvement.
+	if remoteSlot == localSlot {
+		if compareSnapshots(best, local[0]) <= 0 || !isFullSnapshot(best) {
+			minSlot = 0
+			advice = AdviceUpToDate
+			reason.Rule = RuleSameSlot
+			return
+		}
+		if minAge == 0 {
+			minSlot = remoteSlot
+			advice = AdviceFetch
+			reason.Rule = RuleFullReplacesIncremental
+			reason.MinSlot = minSlot
+			return
+		}
 	}
 
 	// Check if local is newer or remote is not new enough to be interesting.
 	if int64(remoteSlot)-int64(localSlot) < int64(minAge) {
+		minSlot = 0
 		advice = AdviceUpToDate
+		reason.Rule = RuleMinSlots
 		return
 	}
 
 	// Remote is new enough.
-	if maxAge < remoteSlot {
-		minSlot = remoteSlot - maxAge
-	}
 	advice = AdviceFetch
+	reason.Rule = RuleNewerRemote
+	reason.MinSlot = minSlot
 	return
 }
 
+// compareSnapshots orders snapshots like types.SnapshotFile.Compare, ignoring hashes.
+// Snapshots without files are compared as full snapshots.
+func compareSnapshots(a, b *types.SnapshotInfo) int {
+	return snapshotKind(a).Compare(snapshotKind(b))
+}
+
+// snapshotKind returns the slot and base slot of a snapshot as a file.
+func snapshotKind(info *types.SnapshotInfo) *types.SnapshotFile {
+	file := &types.SnapshotFile{Slot: info.Slot}
+	if len(info.Files) > 0 {
+		file.BaseSlot = info.Files[0].BaseSlot
+	}
+	return file
+}
+
+// AdviceReason describes which rule of ShouldFetchSnapshot led to an advice.
+type AdviceReason struct {
+	Rule       string
+	LocalSlot  uint64 // newest local slot, zero if none
+	RemoteSlot uint64 // newest remote slot, zero if none
+	MinSlot    uint64 // lowest slot worth fetching, only set with AdviceFetch
+}
+
+// Rules reported in AdviceReason.
+const (
+	RuleNoRemoteSnapshots = "no_remote_snapshots" // remote reports no snapshots
+	RuleNoLocalSnapshots  = "no_local_snapshots"  // no local snapshot, fetch regardless of slot
+	RuleMinSlots          = "min_slots"           // remote is not enough slots ahead of local
+	RuleNewerRemote       = "newer_remote"        // remote is enough slots ahead of local
+	RuleSameSlot          = "same_slot"           // remote is at the same slot as local and not better
+
+	RuleFullReplacesIncremental = "full_replaces_incremental" // remote full snapshot at the slot of the local incremental
+
+	RuleNoCompatibleIncremental = "no_compatible_incremental" // no remote incremental based on the local full snapshot
+
+	RulePinned            = "pinned"             // remote offers the pinned snapshot
+	RulePinnedLocal       = "pinned_local"       // pinned snapshot exists locally
+	RulePinnedUnavailable = "pinned_unavailable" // no remote offers the pinned snapshot
+)
+
+func (r AdviceReason) String() string {
+	switch r.Rule {
+	case RuleNoRemoteSnapshots:
+		return "no remote snapshots"
+	case RuleNoCompatibleIncremental:
+		return "no remote incremental snapshot based on local full snapshot"
+	case RuleNoLocalSnapshots:
+		return fmt.Sprintf("no local snapshot, fetching from slot %d", r.MinSlot)
+	case RuleMinSlots:
+		return fmt.Sprintf("remote slot %d is not enough slots ahead of local slot %d", r.RemoteSlot, r.LocalSlot)
+	case RuleSameSlot:
+		return fmt.Sprintf("remote snapshot at slot %d is no better than local snapshot", r.RemoteSlot)
+	case RuleFullReplacesIncremental:
+		return fmt.Sprintf("remote full snapshot at slot %d replaces local incremental snapshot", r.RemoteSlot)
+	case RuleNewerRemote:
+		return fmt.Sprintf("remote slot %d is newer than local slot %d, fetching from slot %d", r.RemoteSlot, r.LocalSlot, r.MinSlot)
+	case RulePinned:
+		return fmt.Sprintf("fetching pinned snapshot at slot %d", r.RemoteSlot)
+	case RulePinnedLocal:
+		return fmt.Sprintf("pinned snapshot at slot %d exists locally", r.LocalSlot)
+	case RulePinnedUnavailable:
+		return "pinned snapshot not available remotely"
+	default:
+		return r.Rule
+	}
+}
+
 // Advice indicates the recommended next action.
 type Advice int
 
@@ -60,3 +185,31 @@ const (
 	AdviceNothingFound                // no snapshot available
 	AdviceUpToDate                    // local snapshot is up-to-date or newer, don't download
 )
+
+func (a Advice) String() string {
+	switch a {
+	case AdviceFetch:
+		return "fetch"
+	case AdviceNothingFound:
+		return "nothing_found"
+	case AdviceUpToDate:
+		return "up_to_date"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultSlotTime is the approximate time between slots on Solana clusters.
+const DefaultSlotTime = 400 * time.Millisecond
+
+// SlotsIn returns the number of slots produced in d, at one slot per slotTime.
+// Uses DefaultSlotTime if slotTime is not positive.
+func SlotsIn(d time.Duration, slotTime time.Duration) uint64 {
+	if slotTime <= 0 {
+		slotTime = DefaultSlotTime
+	}
+	if d <= 0 {
+		return 0
+	}
+	return uint64(d / slotTime)
+}
@@ -16,6 +16,7 @@ package fetch
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.blockdaemon.com/solana/cluster-manager/types"
@@ -32,6 +33,7 @@ func TestShouldFetchSnapshot(t *testing.T) {
 
 		minSlot uint64
 		advice  Advice
+		rule    string
 	}{
 		{
 			name:    "NothingRemote",
@@ -41,6 +43,7 @@ func TestShouldFetchSnapshot(t *testing.T) {
 			maxAge:  10000,
 			minSlot: 0,
 			advice:  AdviceNothingFound,
+			rule:    RuleNoRemoteSnapshots,
 		},
 		{
 			name:    "NothingLocal",
@@ -50,6 +53,17 @@ func TestShouldFetchSnapshot(t *testing.T) {
 			maxAge:  10000,
 			minSlot: 113456,
 			advice:  AdviceFetch,
+			rule:    RuleNoLocalSnapshots,
+		},
+		{
+			name:    "NothingLocalLowSlotNumber",
+			local:   []uint64{},
+			remote:  []uint64{100},
+			minAge:  500,
+			maxAge:  10000,
+			minSlot: 0,
+			advice:  AdviceFetch,
+			rule:    RuleNoLocalSnapshots,
 		},
 		{
 			name:    "LowSlotNumber",
@@ -59,6 +73,7 @@ func TestShouldFetchSnapshot(t *testing.T) {
 			maxAge:  10000,
 			minSlot: 0,
 			advice:  AdviceFetch,
+			rule:    RuleNoLocalSnapshots,
 		},
 		{
 			name:    "Refresh",
@@ -68,6 +83,17 @@ func TestShouldFetchSnapshot(t *testing.T) {
 			maxAge:  10000,
 			minSlot: 113456,
 			advice:  AdviceFetch,
+			rule:    RuleNewerRemote,
+		},
+		{
+			name:    "UnsortedRemote",
+			local:   []uint64{100000},
+			remote:  []uint64{100002, 123456},
+			minAge:  500,
+			maxAge:  10000,
+			minSlot: 113456,
+			advice:  AdviceFetch,
+			rule:    RuleNewerRemote,
 		},
 		{
 			name:    "NotNewEnough",
@@ -77,6 +103,7 @@ func TestShouldFetchSnapshot(t *testing.T) {
 			maxAge:  10000,
 			minSlot: 0,
 			advice:  AdviceUpToDate,
+			rule:    RuleMinSlots,
 		},
 		{
 			name:    "UpToDate",
@@ -86,12 +113,13 @@ func TestShouldFetchSnapshot(t *testing.T) {
 			maxAge:  10000,
 			minSlot: 0,
 			advice:  AdviceUpToDate,
+			rule:    RuleMinSlots,
 		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			minSlot, advice := ShouldFetchSnapshot(
+			minSlot, advice, reason := ShouldFetchSnapshot(
 				fakeSnapshotInfo(tc.local),
 				fakeSnapshotSources(tc.remote),
 				tc.minAge,
@@ -99,10 +127,132 @@ func TestShouldFetchSnapshot(t *testing.T) {
 			)
 			assert.Equal(t, tc.minSlot, minSlot, "different minSlot")
 			assert.Equal(t, tc.advice, advice, "different advice")
+			assert.Equal(t, tc.rule, reason.Rule, "different rule")
 		})
 	}
 }
 
+func TestShouldFetchSnapshot_Incremental(t *testing.T) {
+	full := func(slot uint64) types.SnapshotInfo {
+		return types.SnapshotInfo{Slot: slot, Files: []*types.SnapshotFile{{Slot: slot}}}
+	}
+	incr := func(slot, baseSlot uint64) types.SnapshotInfo {
+		return types.SnapshotInfo{Slot: slot, Files: []*types.SnapshotFile{
+			{Slot: slot, BaseSlot: baseSlot},
+			{Slot: baseSlot},
+		}}
+	}
+	cases := []struct {
+		name string
+
+		local  types.SnapshotInfo
+		remote []types.SnapshotInfo
+		minAge uint64
+
+		minSlot uint64
+		advice  Advice
+		rule    string
+	}{
+		{
+			name:    "FullReplacesIncremental",
+			local:   incr(100000, 90000),
+			remote:  []types.SnapshotInfo{full(100000)},
+			minSlot: 100000,
+			advice:  AdviceFetch,
+			rule:    RuleFullReplacesIncremental,
+		},
+		{
+			name:   "FullReplacesIncrementalBelowMinAge",
+			local:  incr(100000, 90000),
+			remote: []types.SnapshotInfo{full(100000)},
+			minAge: 500,
+			advice: AdviceUpToDate,
+			rule:   RuleMinSlots,
+		},
+		{
+			name:    "FullPreferredAtSameSlot",
+			local:   incr(100000, 90000),
+			remote:  []types.SnapshotInfo{incr(100000, 90000), full(100000)},
+			minSlot: 100000,
+			advice:  AdviceFetch,
+			rule:    RuleFullReplacesIncremental,
+		},
+		{
+			name:    "AdjacentFull",
+			local:   incr(100000, 90000),
+			remote:  []types.SnapshotInfo{full(100001)},
+			minAge:  1,
+			minSlot: 90001,
+			advice:  AdviceFetch,
+			rule:    RuleNewerRemote,
+		},
+		{
+			name:   "AdjacentFullBelowMinAge",
+			local:  incr(100000, 90000),
+			remote: []types.SnapshotInfo{full(100001)},
+			minAge: 2,
+			advice: AdviceUpToDate,
+			rule:   RuleMinSlots,
+		},
+		{
+			name:    "AdjacentIncremental",
+			local:   full(100000),
+			remote:  []types.SnapshotInfo{incr(100001, 100000)},
+			minAge:  1,
+			minSlot: 90001,
+			advice:  AdviceFetch,
+			rule:    RuleNewerRemote,
+		},
+		{
+			name:   "IncrementalAtSameSlotAsFull",
+			local:  full(100000),
+			remote: []types.SnapshotInfo{incr(100000, 90000)},
+			advice: AdviceUpToDate,
+			rule:   RuleSameSlot,
+		},
+		{
+			name:   "SameFull",
+			local:  full(100000),
+			remote: []types.SnapshotInfo{full(100000)},
+			advice: AdviceUpToDate,
+			rule:   RuleSameSlot,
+		},
+		{
+			name:   "IncrementalWithNewerBase",
+			local:  incr(100000, 90000),
+			remote: []types.SnapshotInfo{incr(100000, 95000)},
+			advice: AdviceUpToDate,
+			rule:   RuleSameSlot,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			local := tc.local
+			remote := make([]types.SnapshotSource, len(tc.remote))
+			for i, info := range tc.remote {
+				remote[i] = types.SnapshotSource{SnapshotInfo: info}
+			}
+			minSlot, advice, reason := ShouldFetchSnapshot([]*types.SnapshotInfo{&local}, remote, tc.minAge, 10000)
+			assert.Equal(t, tc.minSlot, minSlot, "different minSlot")
+			assert.Equal(t, tc.advice, advice, "different advice")
+			assert.Equal(t, tc.rule, reason.Rule, "different rule")
+		})
+	}
+}
+
+func TestAdviceReason_String(t *testing.T) {
+	_, _, reason := ShouldFetchSnapshot(fakeSnapshotInfo([]uint64{100000}), fakeSnapshotSources([]uint64{100002}), 500, 10000)
+	assert.Equal(t, AdviceReason{Rule: RuleMinSlots, LocalSlot: 100000, RemoteSlot: 100002}, reason)
+	assert.Equal(t, "remote slot 100002 is not enough slots ahead of local slot 100000", reason.String())
+}
+
+func TestShouldFetchSnapshot_NothingRemoteReason(t *testing.T) {
+	_, advice, reason := ShouldFetchSnapshot(fakeSnapshotInfo([]uint64{100000}), nil, 500, 10000)
+	assert.Equal(t, AdviceNothingFound, advice)
+	assert.Equal(t, AdviceReason{Rule: RuleNoRemoteSnapshots, LocalSlot: 100000}, reason)
+}
+
 func fakeSnapshotInfo(slots []uint64) []*types.SnapshotInfo {
 	infos := make([]*types.SnapshotInfo, len(slots))
 	for i, slot := range slots {
@@ -124,3 +274,10 @@ func fakeSnapshotSources(slots []uint64) []types.SnapshotSource {
 	}
 	return infos
 }
+
+func TestSlotsIn(t *testing.T) {
+	assert.Equal(t, uint64(750), SlotsIn(5*time.Minute, 0))
+	assert.Equal(t, uint64(600), SlotsIn(5*time.Minute, 500*time.Millisecond))
+	assert.Equal(t, uint64(2), SlotsIn(time.Second, 0), "rounds down")
+	assert.Equal(t, uint64(0), SlotsIn(-time.Second, 0))
+}
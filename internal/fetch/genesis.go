@@ -0,0 +1,41 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// GenesisMismatchError is returned when a snapshot belongs to another cluster.
+type GenesisMismatchError struct {
+	Expected solana.Hash
+	Actual   solana.Hash
+}
+
+func (e *GenesisMismatchError) Error() string {
+	return fmt.Sprintf("genesis hash mismatch: expected %s, but snapshot is from cluster with genesis %s", e.Expected, e.Actual)
+}
+
+// CheckGenesisHash fails with GenesisMismatchError if the snapshot's node advertises a different genesis hash.
+// Snapshots from nodes not advertising a genesis hash pass.
+func CheckGenesisHash(info *types.SnapshotInfo, expected solana.Hash) error {
+	if info.GenesisHash == nil || *info.GenesisHash == expected {
+		return nil
+	}
+	return &GenesisMismatchError{Expected: expected, Actual: *info.GenesisHash}
+}
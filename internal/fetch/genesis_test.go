@@ -0,0 +1,24 @@
+package fetch
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+func TestCheckGenesisHash(t *testing.T) {
+	local := solana.Hash{1}
+	other := solana.Hash{2}
+
+	assert.NoError(t, CheckGenesisHash(&types.SnapshotInfo{}, local), "unknown genesis")
+	assert.NoError(t, CheckGenesisHash(&types.SnapshotInfo{GenesisHash: &local}, local))
+
+	err := CheckGenesisHash(&types.SnapshotInfo{GenesisHash: &other}, local)
+	var mismatch *GenesisMismatchError
+	if assert.ErrorAs(t, err, &mismatch) {
+		assert.Equal(t, local, mismatch.Expected)
+		assert.Equal(t, other, mismatch.Actual)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// NewestFullSnapshot returns the newest full snapshot file among local snapshots, or nil if there is none.
+func NewestFullSnapshot(local []*types.SnapshotInfo) *types.SnapshotFile {
+	var newest *types.SnapshotFile
+	for _, info := range local {
+		for _, file := range info.Files {
+			if file.IsFull() && (newest == nil || file.Slot > newest.Slot) {
+				newest = file
+			}
+		}
+	}
+	return newest
+}
+
+// IncrementalsForBase returns the remote incremental snapshots that apply on top of the given full snapshot.
+//
+// Files of the returned sources are reduced to the incremental itself, as the base is already available.
+// Sources claiming a different full snapshot at the base slot are skipped.
+func IncrementalsForBase(remote []types.SnapshotSource, base *types.SnapshotFile) []types.SnapshotSource {
+	var matches []types.SnapshotSource
+	for _, snap := range remote {
+		if len(snap.Files) == 0 {
+			continue
+		}
+		incremental := snap.Files[0]
+		if !incremental.IsIncremental() || incremental.BaseSlot != base.Slot {
+			continue
+		}
+		if !sameBase(snap.Files[1:], base) {
+			continue
+		}
+		snap.Files = []*types.SnapshotFile{incremental}
+		snap.TotalSize = incremental.Size
+		matches = append(matches, snap)
+	}
+	return matches
+}
+
+// sameBase returns false if files contain a full snapshot at the slot of base with a different hash.
+func sameBase(files []*types.SnapshotFile, base *types.SnapshotFile) bool {
+	for _, file := range files {
+		if file.IsFull() && file.Slot == base.Slot && file.Hash != base.Hash {
+			return false
+		}
+	}
+	return true
+}
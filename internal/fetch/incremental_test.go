@@ -0,0 +1,57 @@
+package fetch
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+func TestNewestFullSnapshot(t *testing.T) {
+	assert.Nil(t, NewestFullSnapshot(nil))
+
+	full100 := &types.SnapshotFile{Slot: 100}
+	full200 := &types.SnapshotFile{Slot: 200}
+	incr := &types.SnapshotFile{Slot: 250, BaseSlot: 200}
+	local := []*types.SnapshotInfo{
+		{Slot: 250, Files: []*types.SnapshotFile{incr, full200}},
+		{Slot: 100, Files: []*types.SnapshotFile{full100}},
+	}
+	assert.Same(t, full200, NewestFullSnapshot(local))
+}
+
+func TestIncrementalsForBase(t *testing.T) {
+	base := &types.SnapshotFile{Slot: 100, Hash: solana.Hash{1}}
+	otherBase := &types.SnapshotFile{Slot: 100, Hash: solana.Hash{2}}
+	incr := &types.SnapshotFile{Slot: 150, BaseSlot: 100, Size: 10}
+	remote := []types.SnapshotSource{
+		{
+			// New full snapshot, never offered.
+			SnapshotInfo: types.SnapshotInfo{Slot: 300, Files: []*types.SnapshotFile{{Slot: 300}}},
+			Target:       "full:8899",
+		},
+		{
+			// Incremental on top of another base slot.
+			SnapshotInfo: types.SnapshotInfo{Slot: 250, Files: []*types.SnapshotFile{{Slot: 250, BaseSlot: 200}}},
+			Target:       "other:8899",
+		},
+		{
+			// Incremental on top of a different full snapshot at the same slot.
+			SnapshotInfo: types.SnapshotInfo{Slot: 170, Files: []*types.SnapshotFile{{Slot: 170, BaseSlot: 100}, otherBase}},
+			Target:       "fork:8899",
+		},
+		{
+			SnapshotInfo: types.SnapshotInfo{Slot: 150, Files: []*types.SnapshotFile{incr, base}, TotalSize: 1010},
+			Target:       "match:8899",
+		},
+	}
+	matches := IncrementalsForBase(remote, base)
+	assert.Equal(t, []types.SnapshotSource{
+		{
+			SnapshotInfo: types.SnapshotInfo{Slot: 150, Files: []*types.SnapshotFile{incr}, TotalSize: 10},
+			Target:       "match:8899",
+		},
+	}, matches)
+	assert.Empty(t, IncrementalsForBase(remote, &types.SnapshotFile{Slot: 400}))
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// StagingDir returns the directory that stages the files of a snapshot while downloading.
+//
+// The path is stable for a given snapshot so that an interrupted fetch can resume.
+// Partial downloads are kept in the staging dir after transient failures and cancellation.
+func StagingDir(stagingRoot string, snap *types.SnapshotInfo) string {
+	return filepath.Join(stagingRoot, fmt.Sprintf(".fetch-%d-%s", snap.Slot, snap.Hash))
+}
+
+// CheckWritable fails unless files can be created in dir, by creating and removing a temp file.
+func CheckWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	_, err = f.Write([]byte{0})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if removeErr := os.Remove(name); err == nil {
+		err = removeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	return nil
+}
+
+// InstallError is returned when downloaded files cannot be moved into the ledger dir.
+// Unlike download errors, it is not specific to the snapshot source.
+type InstallError struct {
+	Err error
+}
+
+func (e *InstallError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InstallError) Unwrap() error {
+	return e.Err
+}
+
+// InstallSnapshot moves the files of a downloaded snapshot from the staging dir into the ledger dir.
+//
+// Names are given in snapshot chain order (target first, base last).
+// Files are moved base first, so the ledger dir never contains an incremental snapshot without its base.
+// Both dirs need to be on the same file system.
+// Failures are returned as *InstallError.
+func InstallSnapshot(stagingDir string, ledgerDir string, names []string) error {
+	for i := len(names) - 1; i >= 0; i-- {
+		name := names[i]
+		oldPath, newPath := filepath.Join(stagingDir, name), filepath.Join(ledgerDir, name)
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return &InstallError{Err: fmt.Errorf("failed to install %s: %w", name, err)}
+		}
+		if err := moveETag(oldPath, newPath); err != nil {
+			return &InstallError{Err: fmt.Errorf("failed to install %s: %w", name, err)}
+		}
+	}
+	if err := os.Remove(stagingDir); err != nil {
+		return &InstallError{Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package fetch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+func TestInstallSnapshot(t *testing.T) {
+	ledgerDir := t.TempDir()
+	snap := &types.SnapshotInfo{
+		Slot: 200,
+		Files: []*types.SnapshotFile{
+			{FileName: "incremental-snapshot-100-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"},
+			{FileName: "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"},
+		},
+	}
+
+	stagingDir := StagingDir(ledgerDir, snap)
+	require.NoError(t, os.Mkdir(stagingDir, 0755))
+	for _, file := range snap.Files {
+		require.NoError(t, os.WriteFile(filepath.Join(stagingDir, file.FileName), []byte("A"), 0666))
+	}
+
+	names := []string{snap.Files[0].FileName, snap.Files[1].FileName}
+	require.NoError(t, InstallSnapshot(stagingDir, ledgerDir, names))
+
+	entries, err := os.ReadDir(ledgerDir)
+	require.NoError(t, err)
+	var actualNames []string
+	for _, entry := range entries {
+		actualNames = append(actualNames, entry.Name())
+	}
+	assert.ElementsMatch(t, names, actualNames)
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, CheckWritable(dir))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "removes the temp file")
+
+	notDir := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(notDir, nil, 0644))
+	assert.Error(t, CheckWritable(notDir))
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only dirs")
+	}
+	readOnly := t.TempDir()
+	require.NoError(t, os.Chmod(readOnly, 0555))
+	defer os.Chmod(readOnly, 0755)
+	assert.ErrorContains(t, CheckWritable(readOnly), "is not writable")
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// LockFileName is the name of the file locked by a fetch in the ledger dir.
+const LockFileName = ".solana-cluster-fetch.lock"
+
+// ErrLocked is returned when another process holds the fetch lock.
+var ErrLocked = errors.New("another fetch is running")
+
+// errLockHeld is returned by tryLockFile if the lock is held.
+var errLockHeld = errors.New("lock held")
+
+// lockPollInterval is the time between attempts to acquire a held lock.
+const lockPollInterval = 100 * time.Millisecond
+
+// DirLock is an exclusive lock on a dir, guarding it against concurrent fetches.
+//
+// On unix, the lock is an advisory flock(2) on a lock file in the dir,
+// and the kernel releases it if the process exits without unlocking.
+// Elsewhere, the lock is the existence of the lock file,
+// which has to be removed by hand if the process exits without unlocking.
+type DirLock struct {
+	fileLock
+}
+
+// LockDir acquires the fetch lock of dir, waiting up to timeout for another process to release it.
+// Fails with ErrLocked if the lock is still held after the timeout. Zero timeout fails immediately.
+func LockDir(ctx context.Context, dir string, timeout time.Duration) (*DirLock, error) {
+	path := filepath.Join(dir, LockFileName)
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := tryLockFile(path)
+		if err == nil {
+			return &DirLock{fileLock: lock}, nil
+		}
+		if !errors.Is(err, errLockHeld) {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: %s is locked", ErrLocked, path)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Unlock releases the lock.
+func (l *DirLock) Unlock() error {
+	return l.unlock()
+}
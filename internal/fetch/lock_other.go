@@ -0,0 +1,48 @@
+//go:build !unix
+
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// fileLock is the lock file created exclusively by the lock holder.
+type fileLock struct {
+	path string
+}
+
+// tryLockFile creates the lock file at path, failing with errLockHeld if it exists.
+func tryLockFile(path string) (fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return fileLock{}, errLockHeld
+	} else if err != nil {
+		return fileLock{}, err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return fileLock{}, err
+	}
+	return fileLock{path: path}, nil
+}
+
+// unlock releases the lock by removing the lock file.
+func (l fileLock) unlock() error {
+	return os.Remove(l.path)
+}
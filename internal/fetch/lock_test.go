@@ -0,0 +1,44 @@
+package fetch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	first, err := LockDir(ctx, dir, 0)
+	require.NoError(t, err)
+
+	_, err = LockDir(ctx, dir, 0)
+	assert.ErrorIs(t, err, ErrLocked)
+	_, err = LockDir(ctx, dir, 50*time.Millisecond)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	// Waiting acquires the lock once released.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, first.Unlock())
+	}()
+	second, err := LockDir(ctx, dir, 5*time.Second)
+	require.NoError(t, err)
+	require.NoError(t, second.Unlock())
+}
+
+func TestLockDir_Cancel(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := LockDir(context.Background(), dir, 0)
+	require.NoError(t, err)
+	defer func() { _ = lock.Unlock() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = LockDir(ctx, dir, time.Hour)
+	assert.ErrorIs(t, err, context.Canceled)
+}
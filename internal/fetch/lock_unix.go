@@ -0,0 +1,55 @@
+//go:build unix
+
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// fileLock holds a flock(2) on the open lock file.
+type fileLock struct {
+	file *os.File
+}
+
+// tryLockFile locks the file at path without waiting, creating it if needed.
+// Returns errLockHeld if another process holds the lock.
+func tryLockFile(path string) (fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fileLock{}, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return fileLock{}, errLockHeld
+		}
+		return fileLock{}, err
+	}
+	return fileLock{file: f}, nil
+}
+
+// unlock releases the lock. The lock file is left in place,
+// removing it would race with processes about to lock it.
+func (l fileLock) unlock() error {
+	if err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN); err != nil {
+		_ = l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
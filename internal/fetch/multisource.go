@@ -0,0 +1,407 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultChunkSize is the default size of byte ranges in multi-source downloads.
+	DefaultChunkSize = 64 << 20
+	// DefaultSampleSize is the default size of the range compared across sources.
+	DefaultSampleSize = 64 << 10
+)
+
+// MultiSourceDownloader downloads a file from multiple sidecars in parallel,
+// fetching different byte ranges from each.
+//
+// Only sources serving the same content as the primary source are used,
+// as determined by comparing checksums of a sample range.
+// Falls back to downloading from the primary source alone
+// if no other source qualifies or the primary source doesn't support range requests.
+type MultiSourceDownloader struct {
+	// Sources serve the same file. The first source is the primary one,
+	// its download slots, verification and decompression settings apply.
+	Sources []*SidecarClient
+	// ChunkSize is the size of the byte ranges fetched at a time.
+	ChunkSize int64
+	// SampleSize is the size of the range compared across sources.
+	SampleSize int64
+
+	Log *zap.Logger
+}
+
+func NewMultiSourceDownloader(sources ...*SidecarClient) *MultiSourceDownloader {
+	return &MultiSourceDownloader{
+		Sources:    sources,
+		ChunkSize:  DefaultChunkSize,
+		SampleSize: DefaultSampleSize,
+		Log:        zap.NewNop(),
+	}
+}
+
+// DownloadSnapshotFile downloads a snapshot file of known size into destDir.
+func (m *MultiSourceDownloader) DownloadSnapshotFile(ctx context.Context, destDir string, name string, size int64) error {
+	_, err := m.DownloadSnapshotFileWithReport(ctx, destDir, name, size)
+	return err
+}
+
+// DownloadSnapshotFileWithReport is like DownloadSnapshotFile, but also reports how long the transfer took.
+func (m *MultiSourceDownloader) DownloadSnapshotFileWithReport(ctx context.Context, destDir string, name string, size int64) (FileReport, error) {
+	primary := m.Sources[0]
+	log := m.Log.With(zap.String("snapshot", name))
+	// Decompression needs the file as one continuous stream.
+	if len(m.Sources) < 2 || size <= 0 || primary.LocalFileName(name) != name {
+		return primary.DownloadSnapshotFileWithReport(ctx, destDir, name)
+	}
+	sources := m.checkSources(ctx, name, size)
+	if len(sources) < 2 {
+		log.Info("No other source serves identical content, downloading from a single source")
+		return primary.DownloadSnapshotFileWithReport(ctx, destDir, name)
+	}
+
+	report := FileReport{FileName: name, Source: sourceHosts(sources)}
+	release, err := primary.acquireSlot(ctx, name)
+	if err != nil {
+		return report, err
+	}
+	defer release()
+	log.Debug("Downloading from multiple sources", zap.Int("num_sources", len(sources)))
+
+	start := time.Now()
+	report.Bytes, err = m.downloadFile(ctx, sources, destDir, name, size)
+	report.Elapsed = time.Since(start)
+	return report, err
+}
+
+// downloadFile downloads a file from all sources, returning the number of bytes transferred.
+func (m *MultiSourceDownloader) downloadFile(ctx context.Context, sources []*SidecarClient, destDir string, name string, size int64) (transferred int64, err error) {
+	partPath := filepath.Join(destDir, name+".part")
+	// Resume from the valid prefix left by an interrupted download.
+	// Partial files as big as the whole file may have gaps, so they are downloaded again.
+	var offset int64
+	if stat, err := os.Stat(partPath); err == nil && stat.Mode().IsRegular() && stat.Size() < size {
+		offset = stat.Size()
+		m.Log.Debug("Resuming partial download", zap.String("snapshot", name), zap.Int64("offset", offset))
+	}
+	f, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return 0, err
+	}
+	progress := newChunkProgress(sources[0], name, offset, size)
+	valid, err := m.download(ctx, sources, f, name, offset, size, progress)
+	transferred = progress.close(err == nil)
+	if err != nil {
+		// Keep only the prefix without gaps, so the next attempt resumes from there.
+		if truncErr := f.Truncate(valid); truncErr != nil {
+			_ = f.Close()
+			_ = os.Remove(partPath)
+		}
+		return transferred, err
+	}
+	if err := f.Close(); err != nil {
+		return transferred, err
+	}
+
+	if primary := sources[0]; primary.verifyDownload {
+		if err := primary.verifyPartFile(ctx, partPath, name, size, nil, ""); err != nil {
+			_ = os.Remove(partPath)
+			return transferred, fmt.Errorf("download from %s: %w", sourceHosts(sources), err)
+		}
+	}
+	return transferred, os.Rename(partPath, filepath.Join(destDir, name))
+}
+
+// chunkProgress tracks the chunks of a file downloaded concurrently
+// using the ProxyReaderFunc and ProgressFunc of the primary source,
+// as if the chunks were read from a single stream.
+type chunkProgress struct {
+	source *SidecarClient
+	name   string
+	size   int64
+
+	lock    sync.Mutex
+	feed    bytes.Reader
+	proxy   io.ReadCloser // reads feed
+	scratch []byte
+	n       int64
+}
+
+func newChunkProgress(source *SidecarClient, name string, offset, size int64) *chunkProgress {
+	p := &chunkProgress{source: source, name: name, size: size}
+	var rd io.Reader = &p.feed
+	if source.progressFunc != nil {
+		rd = newProgressReader(rd, source.progressFunc, source.progressEvery, name, offset, size)
+	}
+	p.proxy = source.proxyReaderFunc(name, size-offset, rd)
+	return p
+}
+
+// Write passes bytes written to the file through the progress tracking.
+func (p *chunkProgress) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.scratch) < len(b) {
+		p.scratch = make([]byte, len(b))
+	}
+	// Reading exactly what was fed never hits EOF, which would mark the stream complete.
+	p.feed.Reset(b)
+	n, err := io.ReadFull(p.proxy, p.scratch[:len(b)])
+	p.n += int64(n)
+	return n, err
+}
+
+// close ends the progress tracking, returning the number of bytes tracked.
+func (p *chunkProgress) close(complete bool) int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	_ = p.proxy.Close()
+	if complete && p.source.progressFunc != nil {
+		p.source.progressFunc(p.name, p.size, p.size)
+	}
+	return p.n
+}
+
+// checkSources returns the sources serving the same sample range as the primary source.
+// Returns only the primary source if it cannot serve the sample range itself.
+func (m *MultiSourceDownloader) checkSources(ctx context.Context, name string, size int64) []*SidecarClient {
+	start := size / 2
+	end := start + m.SampleSize - 1
+	if end >= size {
+		end = size - 1
+	}
+	sums := make([][]byte, len(m.Sources))
+	errs := make([]error, len(m.Sources))
+	var wg sync.WaitGroup
+	wg.Add(len(m.Sources))
+	for i, source := range m.Sources {
+		go func(i int, source *SidecarClient) {
+			defer wg.Done()
+			sums[i], errs[i] = sampleChecksum(ctx, source, name, start, end)
+		}(i, source)
+	}
+	wg.Wait()
+
+	sources := []*SidecarClient{m.Sources[0]}
+	if errs[0] != nil {
+		m.Log.Debug("Primary source failed to serve sample range",
+			zap.String("snapshot", name), zap.Error(errs[0]))
+		return sources
+	}
+	for i := 1; i < len(m.Sources); i++ {
+		switch {
+		case errs[i] != nil:
+			m.Log.Debug("Skipping source failing to serve sample range",
+				zap.String("snapshot", name), zap.Int("source", i), zap.Error(errs[i]))
+		case !bytes.Equal(sums[0], sums[i]):
+			m.Log.Warn("Skipping source serving different content",
+				zap.String("snapshot", name), zap.Int("source", i))
+		default:
+			sources = append(sources, m.Sources[i])
+		}
+	}
+	return sources
+}
+
+func sampleChecksum(ctx context.Context, source *SidecarClient, name string, start, end int64) ([]byte, error) {
+	res, err := source.StreamSnapshotRange(ctx, name, start, end)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(hash, res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if n != end-start+1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return hash.Sum(nil), nil
+}
+
+type byteRange struct {
+	start, end int64 // inclusive
+	index      int   // position in file
+}
+
+// download fetches all chunks of a file from offset on, distributing them across sources.
+// Chunks that fail get handed to another source. The failing source retries with backoff
+// if the error is transient, and is dropped otherwise or once out of retries.
+//
+// Returns the end of the downloaded prefix of the file, which has no gaps even if the download failed.
+func (m *MultiSourceDownloader) download(ctx context.Context, sources []*SidecarClient, f *os.File, name string, offset, size int64, progress io.Writer) (valid int64, err error) {
+	chunkSize := m.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	var ranges []byteRange
+	for start := offset; start < size; start += chunkSize {
+		end := start + chunkSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		ranges = append(ranges, byteRange{start: start, end: end, index: len(ranges)})
+	}
+	chunks := make(chan byteRange, len(ranges))
+	for _, chunk := range ranges {
+		chunks <- chunk
+	}
+
+	parentCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	var remaining atomic.Int64
+	remaining.Store(int64(len(ranges)))
+	var lock sync.Mutex
+	var lastErr error
+	completed := make([]bool, len(ranges))
+	active := len(sources)
+
+	var wg sync.WaitGroup
+	wg.Add(len(sources))
+	for i, source := range sources {
+		go func(i int, source *SidecarClient) {
+			defer wg.Done()
+			for attempt := 0; ; {
+				var chunk byteRange
+				select {
+				case <-ctx.Done():
+					return
+				case <-done:
+					return
+				case chunk = <-chunks:
+				}
+				err := downloadChunk(ctx, source, f, name, chunk, progress)
+				if err == nil {
+					attempt = 0
+					lock.Lock()
+					completed[chunk.index] = true
+					lock.Unlock()
+					if remaining.Dec() == 0 {
+						close(done)
+					}
+					continue
+				}
+				chunks <- chunk // let another source retry
+				if attempt < source.retries && isRetryable(err) {
+					delay := retryDelay(source.retryBaseDelay, attempt, err)
+					attempt++
+					m.Log.Warn("Chunk download failed, retrying",
+						zap.String("snapshot", name), zap.Int("source", i),
+						zap.Int("attempt", attempt), zap.Duration("delay", delay), zap.Error(err))
+					timer := time.NewTimer(delay)
+					select {
+					case <-timer.C:
+						continue
+					case <-done:
+						timer.Stop()
+						return
+					case <-ctx.Done():
+						timer.Stop()
+					}
+				}
+				m.Log.Warn("Dropping failed source",
+					zap.String("snapshot", name), zap.Int("source", i), zap.Error(err))
+				lock.Lock()
+				lastErr = err
+				active--
+				if active == 0 {
+					cancel()
+				}
+				lock.Unlock()
+				return
+			}
+		}(i, source)
+	}
+	wg.Wait()
+
+	valid = offset
+	for _, chunk := range ranges {
+		if !completed[chunk.index] {
+			break
+		}
+		valid = chunk.end + 1
+	}
+	if remaining.Load() == 0 {
+		return valid, nil
+	}
+	if err := parentCtx.Err(); err != nil {
+		return valid, err
+	}
+	return valid, fmt.Errorf("all %d sources failed, last error: %w", len(sources), lastErr)
+}
+
+// downloadChunk writes a chunk of a file from the given source to f, and its bytes to progress.
+func downloadChunk(ctx context.Context, source *SidecarClient, f *os.File, name string, chunk byteRange, progress io.Writer) error {
+	res, err := source.StreamSnapshotRange(ctx, name, chunk.start, chunk.end)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	length := chunk.end - chunk.start + 1
+	rd := io.LimitReader(newThrottledReader(ctx, res.Body, source.rateLimiter), length)
+	n, err := io.Copy(io.MultiWriter(&offsetWriter{f: f, off: chunk.start}, progress), rd)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	if n != length {
+		return fmt.Errorf("download failed: %w", io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// offsetWriter writes to a file sequentially, starting at an offset.
+type offsetWriter struct {
+	f   *os.File
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
+
+// sourceHosts returns the comma-separated hosts of the given sources.
+func sourceHosts(sources []*SidecarClient) string {
+	hosts := make([]string, len(sources))
+	for i, source := range sources {
+		hosts[i] = source.Host()
+	}
+	return strings.Join(hosts, ",")
+}
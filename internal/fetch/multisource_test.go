@@ -0,0 +1,221 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/zap/zaptest"
+	"gopkg.in/resty.v1"
+)
+
+func TestMultiSourceDownloader(t *testing.T) {
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	content := make([]byte, 10_000)
+	rand.New(rand.NewSource(1)).Read(content)
+	other := bytes.Repeat([]byte("B"), len(content))
+
+	// rangeServer serves the given content, counting range requests.
+	rangeServer := func(content []byte, ranges *atomic.Int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("range") != "" {
+				ranges.Inc()
+			}
+			http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader(content))
+		}))
+	}
+	newDownloader := func(servers ...*httptest.Server) *MultiSourceDownloader {
+		var clients []*SidecarClient
+		for _, server := range servers {
+			clients = append(clients, NewSidecarClientWithOpts(server.URL,
+				SidecarClientOpts{Resty: resty.NewWithClient(server.Client())}))
+		}
+		downloader := NewMultiSourceDownloader(clients...)
+		downloader.ChunkSize = 1000
+		downloader.SampleSize = 100
+		downloader.Log = zaptest.NewLogger(t)
+		return downloader
+	}
+	download := func(t *testing.T, downloader *MultiSourceDownloader) {
+		dir := t.TempDir()
+		require.NoError(t, downloader.DownloadSnapshotFile(context.TODO(), dir, snapshotName, int64(len(content))))
+		actual, err := os.ReadFile(filepath.Join(dir, snapshotName))
+		require.NoError(t, err)
+		assert.Equal(t, content, actual)
+	}
+
+	t.Run("Parallel", func(t *testing.T) {
+		var ranges1, ranges2 atomic.Int32
+		server1 := rangeServer(content, &ranges1)
+		defer server1.Close()
+		server2 := rangeServer(content, &ranges2)
+		defer server2.Close()
+
+		download(t, newDownloader(server1, server2))
+		assert.Greater(t, ranges1.Load(), int32(1))
+		assert.Greater(t, ranges2.Load(), int32(1))
+		assert.Equal(t, int32(2+10), ranges1.Load()+ranges2.Load(), "one sample each plus all chunks")
+	})
+	t.Run("DifferentContent", func(t *testing.T) {
+		var ranges1, ranges2 atomic.Int32
+		server1 := rangeServer(content, &ranges1)
+		defer server1.Close()
+		server2 := rangeServer(other, &ranges2)
+		defer server2.Close()
+
+		download(t, newDownloader(server1, server2))
+		assert.Equal(t, int32(1), ranges2.Load(), "only the sample is fetched from the mismatching source")
+	})
+	t.Run("RangeUnsupported", func(t *testing.T) {
+		primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(content)
+		}))
+		defer primary.Close()
+		var ranges atomic.Int32
+		server2 := rangeServer(content, &ranges)
+		defer server2.Close()
+
+		download(t, newDownloader(primary, server2))
+		assert.Equal(t, int32(1), ranges.Load(), "falls back to the primary source")
+	})
+	t.Run("Progress", func(t *testing.T) {
+		var ranges1, ranges2 atomic.Int32
+		server1 := rangeServer(content, &ranges1)
+		defer server1.Close()
+		server2 := rangeServer(content, &ranges2)
+		defer server2.Close()
+
+		var downloaded, total atomic.Int64
+		var proxied *byteCounter
+		primary := NewSidecarClientWithOpts(server1.URL, SidecarClientOpts{
+			Resty: resty.NewWithClient(server1.Client()),
+			ProxyReaderFunc: func(name string, size int64, rd io.Reader) io.ReadCloser {
+				assert.Equal(t, snapshotName, name)
+				assert.Equal(t, int64(len(content)), size)
+				proxied = &byteCounter{rd: rd}
+				return io.NopCloser(proxied)
+			},
+			ProgressFunc: func(_ string, downloaded_, total_ int64) {
+				downloaded.Store(downloaded_)
+				total.Store(total_)
+			},
+		})
+		downloader := newDownloader(server1, server2)
+		downloader.Sources[0] = primary
+		report, err := downloader.DownloadSnapshotFileWithReport(context.TODO(), t.TempDir(), snapshotName, int64(len(content)))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), report.Bytes)
+		require.NotNil(t, proxied)
+		assert.Equal(t, int64(len(content)), proxied.n)
+		assert.Equal(t, int64(len(content)), downloaded.Load())
+		assert.Equal(t, int64(len(content)), total.Load())
+	})
+	t.Run("Resume", func(t *testing.T) {
+		var ranges1, ranges2 atomic.Int32
+		var minStart atomic.Int64
+		minStart.Store(math.MaxInt64)
+		server := func(ranges *atomic.Int32) *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var start, end int64
+				if _, err := fmt.Sscanf(r.Header.Get("range"), "bytes=%d-%d", &start, &end); err == nil && end-start+1 != 100 {
+					ranges.Inc()
+					for old := minStart.Load(); start < old && !minStart.CompareAndSwap(old, start); old = minStart.Load() {
+					}
+				}
+				http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader(content))
+			}))
+		}
+		server1 := server(&ranges1)
+		defer server1.Close()
+		server2 := server(&ranges2)
+		defer server2.Close()
+
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, snapshotName+".part"), content[:2500], 0666))
+		report, err := newDownloader(server1, server2).DownloadSnapshotFileWithReport(context.TODO(), dir, snapshotName, int64(len(content)))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)-2500), report.Bytes)
+		assert.Equal(t, int64(2500), minStart.Load(), "resumes after the partial file")
+		assert.Equal(t, int32(8), ranges1.Load()+ranges2.Load(), "chunks of the remainder only")
+		actual, err := os.ReadFile(filepath.Join(dir, snapshotName))
+		require.NoError(t, err)
+		assert.Equal(t, content, actual)
+	})
+	t.Run("Retry", func(t *testing.T) {
+		// Both sources fail twice after serving the sample.
+		server := func() *httptest.Server {
+			var requests atomic.Int32
+			return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if n := requests.Inc(); n == 2 || n == 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader(content))
+			}))
+		}
+		server1 := server()
+		defer server1.Close()
+		server2 := server()
+		defer server2.Close()
+
+		downloader := newDownloader(server1, server2)
+		for _, source := range downloader.Sources {
+			source.retries = 2
+			source.retryBaseDelay = time.Millisecond
+		}
+		download(t, downloader)
+	})
+	t.Run("KeepsPrefix", func(t *testing.T) {
+		// Sources fail all chunks from 3000 on.
+		server := func() *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var start int64
+				if _, err := fmt.Sscanf(r.Header.Get("range"), "bytes=%d-", &start); err == nil && start >= 3000 && start != 5000 {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader(content))
+			}))
+		}
+		server1 := server()
+		defer server1.Close()
+		server2 := server()
+		defer server2.Close()
+
+		dir := t.TempDir()
+		err := newDownloader(server1, server2).DownloadSnapshotFile(context.TODO(), dir, snapshotName, int64(len(content)))
+		require.Error(t, err)
+		actual, err := os.ReadFile(filepath.Join(dir, snapshotName+".part"))
+		require.NoError(t, err)
+		assert.Equal(t, content[:3000], actual)
+	})
+	t.Run("SourceFails", func(t *testing.T) {
+		var ranges1 atomic.Int32
+		server1 := rangeServer(content, &ranges1)
+		defer server1.Close()
+		// Serves the sample, then fails.
+		var requests atomic.Int32
+		server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Inc() > 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader(content))
+		}))
+		defer server2.Close()
+
+		download(t, newDownloader(server1, server2))
+	})
+}
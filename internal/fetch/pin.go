@@ -0,0 +1,98 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// Pin identifies the exact snapshot to fetch, instead of the best one.
+// Unset fields match any snapshot.
+type Pin struct {
+	Slot uint64
+	Hash solana.Hash
+}
+
+// ParsePin returns the pin given by a slot number and base58 hash, either of which may be unset.
+// Returns nil if neither is set.
+func ParsePin(slot uint64, hash string) (*Pin, error) {
+	if slot == 0 && hash == "" {
+		return nil, nil
+	}
+	pin := &Pin{Slot: slot}
+	if hash != "" {
+		var err error
+		if pin.Hash, err = solana.HashFromBase58(hash); err != nil {
+			return nil, fmt.Errorf("invalid pinned hash %q: %w", hash, err)
+		}
+	}
+	return pin, nil
+}
+
+// Matches returns whether the snapshot is the pinned one.
+func (p *Pin) Matches(info *types.SnapshotInfo) bool {
+	return (p.Slot == 0 || info.Slot == p.Slot) && (p.Hash.IsZero() || info.Hash == p.Hash)
+}
+
+func (p *Pin) String() string {
+	switch {
+	case p.Hash.IsZero():
+		return fmt.Sprintf("at slot %d", p.Slot)
+	case p.Slot == 0:
+		return fmt.Sprintf("with hash %s", p.Hash)
+	default:
+		return fmt.Sprintf("at slot %d with hash %s", p.Slot, p.Hash)
+	}
+}
+
+// ShouldFetchPinned is like ShouldFetchSnapshot, but only considers the pinned snapshot.
+//
+// Returns the remote sources of the pinned snapshot, or AdviceNothingFound if there are none.
+// If the pinned snapshot exists locally, advice is AdviceUpToDate.
+func ShouldFetchPinned(
+	local []*types.SnapshotInfo,
+	remote []types.SnapshotSource,
+	pin *Pin,
+) (matches []types.SnapshotSource, advice Advice, reason AdviceReason) {
+	if len(local) > 0 {
+		reason.LocalSlot = local[0].Slot
+	}
+	for _, info := range local {
+		if pin.Matches(info) {
+			reason.LocalSlot = info.Slot
+			advice = AdviceUpToDate
+			reason.Rule = RulePinnedLocal
+			return
+		}
+	}
+	for _, snap := range remote {
+		if pin.Matches(&snap.SnapshotInfo) {
+			matches = append(matches, snap)
+			reason.RemoteSlot = snap.Slot
+		}
+	}
+	if len(matches) == 0 {
+		advice = AdviceNothingFound
+		reason.Rule = RulePinnedUnavailable
+		return
+	}
+	advice = AdviceFetch
+	reason.Rule = RulePinned
+	reason.MinSlot = reason.RemoteSlot
+	return
+}
@@ -0,0 +1,72 @@
+package fetch
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+func TestParsePin(t *testing.T) {
+	pin, err := ParsePin(0, "")
+	require.NoError(t, err)
+	assert.Nil(t, pin)
+
+	pin, err = ParsePin(100, "AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr")
+	require.NoError(t, err)
+	assert.Equal(t, &Pin{Slot: 100, Hash: solana.MustHashFromBase58("AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr")}, pin)
+	assert.Equal(t, "at slot 100 with hash AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr", pin.String())
+
+	_, err = ParsePin(0, "not-a-hash")
+	assert.Error(t, err)
+}
+
+func TestShouldFetchPinned(t *testing.T) {
+	remote := func(target string, slot uint64, hash byte) types.SnapshotSource {
+		return types.SnapshotSource{
+			SnapshotInfo: types.SnapshotInfo{Slot: slot, Hash: solana.Hash{hash}},
+			Target:       target,
+		}
+	}
+	remotes := []types.SnapshotSource{
+		remote("a", 300, 3),
+		remote("a", 200, 2),
+		remote("b", 200, 2),
+		remote("c", 200, 4), // same slot, other bank
+		remote("a", 100, 1),
+	}
+	local := []*types.SnapshotInfo{{Slot: 250, Hash: solana.Hash{5}}, {Slot: 100, Hash: solana.Hash{1}}}
+
+	t.Run("Slot", func(t *testing.T) {
+		matches, advice, reason := ShouldFetchPinned(local, remotes, &Pin{Slot: 200})
+		assert.Equal(t, AdviceFetch, advice)
+		assert.Equal(t, RulePinned, reason.Rule)
+		assert.Equal(t, uint64(200), reason.RemoteSlot)
+		assert.Equal(t, []types.SnapshotSource{remotes[1], remotes[2], remotes[3]}, matches)
+	})
+	t.Run("SlotAndHash", func(t *testing.T) {
+		matches, advice, _ := ShouldFetchPinned(local, remotes, &Pin{Slot: 200, Hash: solana.Hash{2}})
+		assert.Equal(t, AdviceFetch, advice, "older than local, but pinned")
+		assert.Equal(t, []types.SnapshotSource{remotes[1], remotes[2]}, matches)
+	})
+	t.Run("Hash", func(t *testing.T) {
+		matches, advice, _ := ShouldFetchPinned(local, remotes, &Pin{Hash: solana.Hash{4}})
+		assert.Equal(t, AdviceFetch, advice)
+		assert.Equal(t, []types.SnapshotSource{remotes[3]}, matches)
+	})
+	t.Run("Local", func(t *testing.T) {
+		matches, advice, reason := ShouldFetchPinned(local, remotes, &Pin{Slot: 100})
+		assert.Empty(t, matches)
+		assert.Equal(t, AdviceUpToDate, advice)
+		assert.Equal(t, RulePinnedLocal, reason.Rule)
+		assert.Equal(t, uint64(100), reason.LocalSlot)
+	})
+	t.Run("Unavailable", func(t *testing.T) {
+		matches, advice, reason := ShouldFetchPinned(local, remotes, &Pin{Slot: 200, Hash: solana.Hash{9}})
+		assert.Empty(t, matches)
+		assert.Equal(t, AdviceNothingFound, advice)
+		assert.Equal(t, RulePinnedUnavailable, reason.Rule)
+	})
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"fmt"
+	"sort"
+
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// SnapshotPolicy decides which remote snapshots are preferred for download.
+//
+// ShouldFetchSnapshot decides whether downloading is worthwhile at all,
+// the policy then ranks the snapshots to try, possibly excluding some.
+type SnapshotPolicy interface {
+	// Rank returns the remote snapshots ordered most preferred first, leaving out those never to be used.
+	// The input is ordered newest first, as reported by the tracker, and must not be modified.
+	Rank(remote []types.SnapshotSource) []types.SnapshotSource
+}
+
+// DefaultPolicy prefers the newest snapshot.
+type DefaultPolicy struct{}
+
+func (DefaultPolicy) Rank(remote []types.SnapshotSource) []types.SnapshotSource {
+	ranked := make([]types.SnapshotSource, len(remote))
+	copy(ranked, remote)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Slot > ranked[j].Slot
+	})
+	return ranked
+}
+
+// FullPreferredPolicy prefers full snapshots over incremental snapshots, even if those are newer.
+// Snapshots too old to be downloaded at all are still excluded by the max-slots limit.
+type FullPreferredPolicy struct{}
+
+func (FullPreferredPolicy) Rank(remote []types.SnapshotSource) []types.SnapshotSource {
+	ranked := DefaultPolicy{}.Rank(remote)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return isFullSnapshot(&ranked[i].SnapshotInfo) && !isFullSnapshot(&ranked[j].SnapshotInfo)
+	})
+	return ranked
+}
+
+func isFullSnapshot(info *types.SnapshotInfo) bool {
+	return len(info.Files) > 0 && info.Files[0].IsFull()
+}
+
+// MostReplicatedPolicy prefers the snapshots offered by the most sources, then the newest.
+type MostReplicatedPolicy struct{}
+
+func (MostReplicatedPolicy) Rank(remote []types.SnapshotSource) []types.SnapshotSource {
+	type snapshotKey struct {
+		slot uint64
+		hash [32]byte
+	}
+	replicas := make(map[snapshotKey]int)
+	for _, snap := range remote {
+		replicas[snapshotKey{snap.Slot, snap.Hash}]++
+	}
+	ranked := DefaultPolicy{}.Rank(remote)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return replicas[snapshotKey{ranked[i].Slot, ranked[i].Hash}] >
+			replicas[snapshotKey{ranked[j].Slot, ranked[j].Hash}]
+	})
+	return ranked
+}
+
+// DefaultMaxNodeLag is the default CaughtUpPolicy.MaxLag, about a minute of slots.
+const DefaultMaxNodeLag = 150
+
+// CaughtUpPolicy prefers the newest snapshot, excluding sources whose node is unhealthy
+// or more than MaxLag slots behind the newest node among all sources.
+// Sources not reporting their node status, e.g. older sidecars, are tried last.
+type CaughtUpPolicy struct {
+	MaxLag uint64
+}
+
+func (p CaughtUpPolicy) Rank(remote []types.SnapshotSource) []types.SnapshotSource {
+	var clusterSlot uint64
+	for _, snap := range remote {
+		if snap.Node != nil && snap.Node.Slot > clusterSlot {
+			clusterSlot = snap.Node.Slot
+		}
+	}
+	ranked := make([]types.SnapshotSource, 0, len(remote))
+	var unknown []types.SnapshotSource
+	for _, snap := range (DefaultPolicy{}).Rank(remote) {
+		switch {
+		case snap.Node == nil:
+			unknown = append(unknown, snap)
+		case snap.Node.Healthy && snap.Node.Slot+p.MaxLag >= clusterSlot:
+			ranked = append(ranked, snap)
+		}
+	}
+	return append(ranked, unknown...)
+}
+
+// PolicyNames lists the names accepted by ParsePolicy.
+var PolicyNames = []string{"newest", "full-preferred", "most-replicated", "caught-up"}
+
+// ParsePolicy returns the snapshot policy with the given name.
+func ParsePolicy(name string) (SnapshotPolicy, error) {
+	switch name {
+	case "newest", "":
+		return DefaultPolicy{}, nil
+	case "full-preferred":
+		return FullPreferredPolicy{}, nil
+	case "most-replicated":
+		return MostReplicatedPolicy{}, nil
+	case "caught-up":
+		return CaughtUpPolicy{MaxLag: DefaultMaxNodeLag}, nil
+	default:
+		return nil, fmt.Errorf("unknown snapshot policy %q", name)
+	}
+}
@@ -0,0 +1,82 @@
+package fetch
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+func TestSnapshotPolicy(t *testing.T) {
+	snap := func(target string, slot uint64, full bool) types.SnapshotSource {
+		file := &types.SnapshotFile{Slot: slot}
+		if !full {
+			file.BaseSlot = slot - 50
+		}
+		return types.SnapshotSource{
+			SnapshotInfo: types.SnapshotInfo{Slot: slot, Hash: solana.Hash{byte(slot)}, Files: []*types.SnapshotFile{file}},
+			Target:       target,
+		}
+	}
+	remote := []types.SnapshotSource{
+		snap("a", 130, false),
+		snap("b", 120, false),
+		snap("c", 120, false),
+		snap("d", 100, true),
+		snap("e", 90, true),
+		snap("f", 90, true),
+	}
+	targets := func(snaps []types.SnapshotSource) (targets []string) {
+		for _, snap := range snaps {
+			targets = append(targets, snap.Target)
+		}
+		return
+	}
+
+	cases := []struct {
+		name   string
+		policy string
+		expect []string
+	}{
+		{"Newest", "newest", []string{"a", "b", "c", "d", "e", "f"}},
+		{"FullPreferred", "full-preferred", []string{"d", "e", "f", "a", "b", "c"}},
+		{"MostReplicated", "most-replicated", []string{"b", "c", "e", "f", "a", "d"}},
+		{"CaughtUpUnknown", "caught-up", []string{"a", "b", "c", "d", "e", "f"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := ParsePolicy(tc.policy)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, targets(policy.Rank(remote)))
+		})
+	}
+	assert.Equal(t, "a", remote[0].Target, "input must not be modified")
+
+	_, err := ParsePolicy("oldest")
+	assert.EqualError(t, err, `unknown snapshot policy "oldest"`)
+}
+
+func TestCaughtUpPolicy(t *testing.T) {
+	snap := func(target string, slot uint64, node *types.NodeStatus) types.SnapshotSource {
+		return types.SnapshotSource{
+			SnapshotInfo: types.SnapshotInfo{Slot: slot, Hash: solana.Hash{byte(slot)}},
+			Target:       target,
+			Node:         node,
+		}
+	}
+	remote := []types.SnapshotSource{
+		snap("delinquent", 130, &types.NodeStatus{Slot: 900, Healthy: true}),
+		snap("unhealthy", 130, &types.NodeStatus{Slot: 1000, Healthy: false}),
+		snap("unknown", 120, nil),
+		snap("lagging", 120, &types.NodeStatus{Slot: 949, Healthy: true}),
+		snap("caught-up", 110, &types.NodeStatus{Slot: 950, Healthy: true}),
+		snap("newest", 100, &types.NodeStatus{Slot: 1000, Healthy: true}),
+	}
+	var targets []string
+	for _, snap := range (CaughtUpPolicy{MaxLag: 50}).Rank(remote) {
+		targets = append(targets, snap.Target)
+	}
+	assert.Equal(t, []string{"caught-up", "newest", "unknown"}, targets)
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// ProgressFunc reports the progress of a file download.
+// Downloaded includes bytes of a resumed partial download. Total is -1 if the file size is unknown.
+type ProgressFunc func(name string, downloaded, total int64)
+
+// DefaultProgressInterval is the default min time between progress reports of a file.
+const DefaultProgressInterval = 100 * time.Millisecond
+
+// progressReader reports the bytes read through it, at most once per interval.
+// The final report at the end of the stream is never skipped.
+type progressReader struct {
+	rd         io.Reader
+	fn         ProgressFunc
+	name       string
+	downloaded int64
+	total      int64
+	interval   time.Duration
+	last       time.Time
+}
+
+func newProgressReader(rd io.Reader, fn ProgressFunc, interval time.Duration, name string, offset, total int64) *progressReader {
+	return &progressReader{
+		rd:         rd,
+		fn:         fn,
+		name:       name,
+		downloaded: offset,
+		total:      total,
+		interval:   interval,
+		last:       time.Now(),
+	}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.rd.Read(b)
+	p.downloaded += int64(n)
+	if now := time.Now(); err == io.EOF || now.Sub(p.last) >= p.interval {
+		p.last = now
+		p.fn(p.name, p.downloaded, p.total)
+	}
+	return n, err
+}
+
+// AggregateProgressFunc reports the combined progress of several file downloads.
+// Total is the sum of the sizes of all files known so far.
+type AggregateProgressFunc func(downloaded, total int64)
+
+// AggregateProgress sums up the progress of concurrent file downloads, e.g. of all files of a snapshot.
+// Pass its Report method as ProgressFunc of the clients downloading the files.
+type AggregateProgress struct {
+	fn         AggregateProgressFunc // optional
+	files      sync.Map              // file name to *fileProgress
+	downloaded atomic.Int64
+	total      atomic.Int64
+}
+
+type fileProgress struct {
+	downloaded atomic.Int64
+	total      atomic.Int64
+}
+
+// NewAggregateProgress creates an aggregate of file downloads with the given expected sizes.
+// Files not listed are added to the total once their size is reported.
+func NewAggregateProgress(sizes map[string]int64, fn AggregateProgressFunc) *AggregateProgress {
+	a := &AggregateProgress{fn: fn}
+	for name, size := range sizes {
+		file := new(fileProgress)
+		if size > 0 {
+			file.total.Store(size)
+			a.total.Add(size)
+		}
+		a.files.Store(name, file)
+	}
+	return a
+}
+
+// Report records the progress of a file download, see ProgressFunc.
+// Safe for concurrent use.
+func (a *AggregateProgress) Report(name string, downloaded, total int64) {
+	value, _ := a.files.LoadOrStore(name, new(fileProgress))
+	file := value.(*fileProgress)
+	if total >= 0 {
+		if old := file.total.Swap(total); old != total {
+			a.total.Add(total - old)
+		}
+	}
+	// Restarted downloads report fewer bytes than before.
+	a.downloaded.Add(downloaded - file.downloaded.Swap(downloaded))
+	if a.fn != nil {
+		a.fn(a.Progress())
+	}
+}
+
+// Progress returns the bytes downloaded of all files and the sum of their sizes.
+func (a *AggregateProgress) Progress() (downloaded, total int64) {
+	return a.downloaded.Load(), a.total.Load()
+}
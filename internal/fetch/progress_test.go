@@ -0,0 +1,100 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"gopkg.in/resty.v1"
+)
+
+func TestProgressReader(t *testing.T) {
+	type report struct{ downloaded, total int64 }
+	var reports []report
+	fn := func(name string, downloaded, total int64) {
+		assert.Equal(t, "bla.tar.zst", name)
+		reports = append(reports, report{downloaded, total})
+	}
+
+	// Reads one byte at a time, far more often than the interval.
+	rd := newProgressReader(iotest.OneByteReader(bytes.NewReader(make([]byte, 100))), fn, time.Hour, "bla.tar.zst", 10, 110)
+	n, err := io.Copy(io.Discard, rd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), n)
+	assert.Equal(t, []report{{110, 110}}, reports, "only the final report")
+
+	reports = nil
+	rd = newProgressReader(iotest.OneByteReader(bytes.NewReader(make([]byte, 3))), fn, 0, "bla.tar.zst", 0, -1)
+	_, err = io.Copy(io.Discard, rd)
+	require.NoError(t, err)
+	assert.Equal(t, []report{{1, -1}, {2, -1}, {3, -1}, {3, -1}}, reports)
+}
+
+func TestSidecarClient_DownloadSnapshotFile_Progress(t *testing.T) {
+	const snapshotName = "bla.tar.zst"
+	content := bytes.Repeat([]byte{'A'}, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	var downloaded, total int64
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+		Resty: resty.NewWithClient(server.Client()),
+		ProgressFunc: func(_ string, downloaded_, total_ int64) {
+			downloaded, total = downloaded_, total_
+		},
+	})
+
+	// Resumed bytes count as downloaded.
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, snapshotName+".part"), content[:40], 0666))
+	require.NoError(t, client.DownloadSnapshotFile(context.TODO(), tmpDir, snapshotName))
+	assert.Equal(t, int64(100), downloaded)
+	assert.Equal(t, int64(100), total)
+}
+
+func TestAggregateProgress(t *testing.T) {
+	var last atomic.Int64
+	agg := NewAggregateProgress(map[string]int64{"a": 100, "b": 50, "c": 0}, func(downloaded, total int64) {
+		last.Store(downloaded)
+	})
+	downloaded, total := agg.Progress()
+	assert.Equal(t, int64(0), downloaded)
+	assert.Equal(t, int64(150), total)
+
+	// Files advance concurrently.
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for i := int64(1); i <= 50; i++ {
+				agg.Report(name, i, -1)
+			}
+		}(name)
+	}
+	wg.Wait()
+	downloaded, total = agg.Progress()
+	assert.Equal(t, int64(100), downloaded)
+	assert.Equal(t, int64(150), total)
+	assert.Equal(t, int64(100), last.Load())
+
+	// Size of c becomes known, b restarts from scratch.
+	agg.Report("c", 10, 20)
+	agg.Report("b", 5, 50)
+	downloaded, total = agg.Progress()
+	assert.Equal(t, int64(65), downloaded)
+	assert.Equal(t, int64(170), total)
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/zap"
+)
+
+// PruneSnapshots deletes all but the newest keep full snapshots in a ledger dir,
+// along with incremental snapshots based on deleted (or missing) full snapshots.
+//
+// The full snapshot that pinned depends on is never deleted, even if it is not among the newest.
+// Returns the names of deleted files.
+func PruneSnapshots(ledgerDir string, keep int, pinned *types.SnapshotInfo, log *zap.Logger) ([]string, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("must keep at least one snapshot, got %d", keep)
+	}
+	files, err := ledger.ListSnapshotFiles(os.DirFS(ledgerDir))
+	if err != nil {
+		return nil, err
+	}
+
+	// Select full snapshots to keep. Files are sorted newest first.
+	keepSlots := make(map[uint64]bool)
+	if pinned != nil {
+		for _, file := range pinned.Files {
+			if file.IsFull() {
+				keepSlots[file.Slot] = true
+			} else {
+				keepSlots[file.BaseSlot] = true
+			}
+		}
+	}
+	var numFull int
+	for _, file := range files {
+		if file.IsFull() && numFull < keep {
+			keepSlots[file.Slot] = true
+			numFull++
+		}
+	}
+
+	var deleted []string
+	for _, file := range files {
+		baseSlot := file.BaseSlot
+		if file.IsFull() {
+			baseSlot = file.Slot
+		}
+		if keepSlots[baseSlot] {
+			continue
+		}
+		log.Info("Deleting old snapshot", zap.String("snapshot", file.FileName))
+		path := filepath.Join(ledgerDir, file.FileName)
+		if err := os.Remove(path); err != nil {
+			return deleted, fmt.Errorf("failed to delete old snapshot: %w", err)
+		}
+		if err := removeETag(path); err != nil {
+			return deleted, fmt.Errorf("failed to delete old snapshot: %w", err)
+		}
+		deleted = append(deleted, file.FileName)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,61 @@
+package fetch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/zap"
+)
+
+func TestPruneSnapshots(t *testing.T) {
+	ledgerDir := t.TempDir()
+	for _, name := range []string{
+		"snapshot-50-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"incremental-snapshot-50-60-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"incremental-snapshot-100-150-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"snapshot-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"incremental-snapshot-200-250-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"incremental-snapshot-300-350-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"unrelated.txt",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(ledgerDir, name), []byte("A"), 0666))
+	}
+
+	// Pretend we just downloaded an incremental based on the oldest full snapshot.
+	pinned := &types.SnapshotInfo{
+		Slot: 60,
+		Files: []*types.SnapshotFile{
+			{FileName: "incremental-snapshot-50-60-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst", Slot: 60, BaseSlot: 50},
+			{FileName: "snapshot-50-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst", Slot: 50},
+		},
+	}
+	deleted, err := PruneSnapshots(ledgerDir, 1, pinned, zap.NewNop())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"incremental-snapshot-100-150-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"incremental-snapshot-300-350-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+	}, deleted)
+
+	entries, err := os.ReadDir(ledgerDir)
+	require.NoError(t, err)
+	var remaining []string
+	for _, entry := range entries {
+		remaining = append(remaining, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{
+		"snapshot-50-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"incremental-snapshot-50-60-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"snapshot-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"incremental-snapshot-200-250-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		"unrelated.txt",
+	}, remaining)
+
+	_, err = PruneSnapshots(ledgerDir, 0, nil, zap.NewNop())
+	assert.Error(t, err)
+}
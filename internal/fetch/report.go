@@ -0,0 +1,84 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// FileReport describes the download of a single snapshot file.
+type FileReport struct {
+	FileName  string
+	Source    string        // host the file was downloaded from, comma-separated for multi-source downloads
+	Bytes     int64         // bytes transferred, excluding parts resumed from a previous attempt
+	Elapsed   time.Duration // time spent downloading, excluding waiting for a download slot
+	Unchanged bool          // the existing copy in the ledger dir is current, nothing was downloaded
+}
+
+// BytesPerSec returns the average download speed.
+func (r FileReport) BytesPerSec() float64 {
+	return bytesPerSec(r.Bytes, r.Elapsed)
+}
+
+func (r FileReport) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		FileName    string  `json:"file_name"`
+		Source      string  `json:"source,omitempty"`
+		Bytes       int64   `json:"bytes"`
+		Elapsed     float64 `json:"elapsed_seconds"`
+		BytesPerSec float64 `json:"bytes_per_sec"`
+		Unchanged   bool    `json:"unchanged,omitempty"`
+	}{r.FileName, r.Source, r.Bytes, r.Elapsed.Seconds(), r.BytesPerSec(), r.Unchanged})
+}
+
+// DownloadReport summarizes the download of a snapshot.
+type DownloadReport struct {
+	Files   []FileReport
+	Elapsed time.Duration // wall time of the download, files are downloaded concurrently
+}
+
+// TotalBytes returns the number of bytes transferred for all files.
+func (r *DownloadReport) TotalBytes() (n int64) {
+	for _, file := range r.Files {
+		n += file.Bytes
+	}
+	return
+}
+
+// BytesPerSec returns the average combined download speed.
+func (r *DownloadReport) BytesPerSec() float64 {
+	return bytesPerSec(r.TotalBytes(), r.Elapsed)
+}
+
+func (r *DownloadReport) MarshalJSON() ([]byte, error) {
+	files := r.Files
+	if files == nil {
+		files = make([]FileReport, 0)
+	}
+	return json.Marshal(struct {
+		Files       []FileReport `json:"files"`
+		Bytes       int64        `json:"bytes"`
+		Elapsed     float64      `json:"elapsed_seconds"`
+		BytesPerSec float64      `json:"bytes_per_sec"`
+	}{files, r.TotalBytes(), r.Elapsed.Seconds(), r.BytesPerSec()})
+}
+
+func bytesPerSec(n int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / elapsed.Seconds()
+}
@@ -0,0 +1,36 @@
+package fetch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadReport(t *testing.T) {
+	report := &DownloadReport{
+		Files: []FileReport{
+			{FileName: "a", Source: "host1:13080", Bytes: 3000, Elapsed: 3 * time.Second},
+			{FileName: "b", Bytes: 1000, Elapsed: 500 * time.Millisecond},
+		},
+		Elapsed: 4 * time.Second,
+	}
+	assert.Equal(t, int64(4000), report.TotalBytes())
+	assert.Equal(t, float64(1000), report.BytesPerSec())
+	assert.Equal(t, float64(2000), report.Files[1].BytesPerSec())
+	assert.Equal(t, float64(0), FileReport{Bytes: 1}.BytesPerSec())
+
+	buf, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"files": [
+			{"file_name": "a", "source": "host1:13080", "bytes": 3000, "elapsed_seconds": 3, "bytes_per_sec": 1000},
+			{"file_name": "b", "bytes": 1000, "elapsed_seconds": 0.5, "bytes_per_sec": 2000}
+		],
+		"bytes": 4000,
+		"elapsed_seconds": 4,
+		"bytes_per_sec": 1000
+	}`, string(buf))
+}
@@ -0,0 +1,61 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	var lock sync.Mutex
+	var userAgents, requestIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		userAgents = append(userAgents, r.UserAgent())
+		requestIDs = append(requestIDs, r.Header.Get(RequestIDHeader))
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/v1/best_snapshots", "/v1/snapshots":
+			w.Header().Set("content-type", "application/json")
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader([]byte("AAAA")))
+	}))
+	defer server.Close()
+
+	requestID := NewRequestID()
+	assert.Len(t, requestID, 32)
+	assert.NotEqual(t, requestID, NewRequestID())
+	ctx := WithRequestID(context.Background(), requestID)
+	assert.Equal(t, requestID, RequestID(ctx))
+
+	_, err := NewTrackerClient(server.URL).GetBestSnapshots(ctx, -1)
+	require.NoError(t, err)
+	sidecar := NewSidecarClient(server.URL)
+	_, err = sidecar.ListSnapshots(ctx)
+	require.NoError(t, err)
+	require.NoError(t, sidecar.DownloadSnapshotFile(ctx, t.TempDir(), snapshotName))
+	_, err = sidecar.StatSnapshotFile(ctx, snapshotName)
+	require.NoError(t, err)
+
+	require.Len(t, userAgents, 4)
+	for i := range userAgents {
+		assert.True(t, strings.HasPrefix(userAgents[i], "solana-cluster/"), userAgents[i])
+		assert.Equal(t, requestID, requestIDs[i])
+	}
+
+	// Requests without a request ID don't send one.
+	_, err = sidecar.ListSnapshots(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, requestIDs[4])
+}
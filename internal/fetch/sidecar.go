@@ -17,16 +17,28 @@ package fetch
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/gagliardetto/solana-go/rpc"
+	"go.blockdaemon.com/solana/cluster-manager/internal/checksum"
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
 	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 	"gopkg.in/resty.v1"
 )
 
@@ -37,16 +49,86 @@ type SidecarClient struct {
 	resty           *resty.Client
 	log             *zap.Logger
 	proxyReaderFunc ProxyReaderFunc
+	queueFunc       QueueFunc
+	progressFunc    ProgressFunc
+	progressEvery   time.Duration
+	verifyDownload  bool
+	verifyAlgo      string
+	downloadSem     chan struct{}
+	rateLimiter     *rate.Limiter
+	retries         int
+	retryBaseDelay  time.Duration
+	decompress      bool
+	wireCompression bool
+	requestToken    string
 }
 
 type SidecarClientOpts struct {
 	Resty           *resty.Client
 	Log             *zap.Logger
 	ProxyReaderFunc ProxyReaderFunc
+	// PathPrefix is prepended to the paths of all requests,
+	// for sidecars behind a path-based reverse proxy, e.g. "/node-a/snapshots".
+	PathPrefix string
+	// QueueFunc is called for each file download before waiting for a download slot,
+	// e.g. to show queued downloads in a progress display.
+	QueueFunc QueueFunc
+	// ProgressFunc is called periodically while downloading a file, and when the transfer completes.
+	ProgressFunc ProgressFunc
+	// ProgressInterval is the min time between ProgressFunc calls for a file.
+	// Defaults to DefaultProgressInterval.
+	ProgressInterval time.Duration
+
+	// VerifyDownload checks downloads against the checksum provided by the sidecar,
+	// or checks snapshot archives using VerifySnapshotFile if there is none.
+	VerifyDownload bool
+	// VerifyAlgorithm is the checksum algorithm requested from the sidecar, see package checksum.
+	// Empty uses the default algorithm of the sidecar.
+	// If set and the sidecar provides no such checksum, only the size of downloads is checked.
+	VerifyAlgorithm string
+	// MaxConcurrent caps the number of simultaneous file downloads.
+	// Excess downloads wait for a free slot. Zero means unlimited.
+	MaxConcurrent int
+	// RateLimiter throttles downloads to a number of bytes per second.
+	// Share the limiter between clients to cap combined throughput.
+	RateLimiter *rate.Limiter
+	// Retries is the number of times a failed file download is retried.
+	Retries int
+	// RetryBaseDelay is the delay before the first retry, doubling with each attempt.
+	RetryBaseDelay time.Duration
+	// Decompress stores zstd, bzip2 and gzip compressed snapshots as uncompressed tar archives.
+	// Snapshots with other compression formats are stored as is.
+	Decompress bool
+	// WireCompression asks the sidecar to compress uncompressed snapshots with zstd for the transfer.
+	// Downloads are decompressed transparently, and progress is reported in transferred bytes.
+	WireCompression bool
+	// TLSConfig is used for HTTPS connections, e.g. to present a client certificate.
+	TLSConfig *tls.Config
+
+	// DialTimeout caps the time to establish a connection.
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout caps the time from sending a request to receiving the response headers.
+	// Reading the body is not affected, so large downloads may take as long as they need.
+	ResponseHeaderTimeout time.Duration
+	// IdleConnTimeout closes keep-alive connections that have been idle for this long.
+	IdleConnTimeout time.Duration
+	// MaxIdleConnsPerHost is the number of keep-alive connections reused for further downloads.
+	// Defaults to MaxConcurrent, so that each download slot keeps its connection.
+	MaxIdleConnsPerHost int
+	// DisableHTTP2 forces HTTP/1.1, for servers misbehaving under HTTP/2.
+	// HTTP/2 is only negotiated over TLS.
+	DisableHTTP2 bool
+
+	// RequestToken is the bearer token authorizing snapshot requests, see RequestSnapshot.
+	RequestToken string
 }
 
+// ProxyReaderFunc wraps the response body of a file download, e.g. to track progress.
+// The size is the number of bytes remaining, or -1 if unknown.
 type ProxyReaderFunc func(name string, size int64, rd io.Reader) io.ReadCloser
 
+type QueueFunc func(name string)
+
 func NewSidecarClient(sidecarURL string) *SidecarClient {
 	return NewSidecarClientWithOpts(sidecarURL, SidecarClientOpts{})
 }
@@ -54,8 +136,24 @@ func NewSidecarClient(sidecarURL string) *SidecarClient {
 func NewSidecarClientWithOpts(sidecarURL string, opts SidecarClientOpts) *SidecarClient {
 	if opts.Resty == nil {
 		opts.Resty = resty.New()
+		// Resty disables redirects, which sidecars backed by object storage use for downloads.
+		opts.Resty.GetClient().CheckRedirect = checkRedirect
+	}
+	opts.Resty.SetHostURL(joinURLPath(sidecarURL, opts.PathPrefix))
+	transport := transportOpts{
+		tlsConfig:             opts.TLSConfig,
+		dialTimeout:           opts.DialTimeout,
+		responseHeaderTimeout: opts.ResponseHeaderTimeout,
+		idleConnTimeout:       opts.IdleConnTimeout,
+		maxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		disableHTTP2:          opts.DisableHTTP2,
+	}
+	if transport != (transportOpts{}) {
+		if transport.maxIdleConnsPerHost <= 0 {
+			transport.maxIdleConnsPerHost = opts.MaxConcurrent
+		}
+		opts.Resty.SetTransport(newTransport(transport))
 	}
-	opts.Resty.SetHostURL(sidecarURL)
 	if opts.ProxyReaderFunc == nil {
 		opts.ProxyReaderFunc = func(_ string, _ int64, rd io.Reader) io.ReadCloser {
 			return io.NopCloser(rd)
@@ -64,21 +162,81 @@ func NewSidecarClientWithOpts(sidecarURL string, opts SidecarClientOpts) *Sideca
 	if opts.Log == nil {
 		opts.Log = zap.NewNop()
 	}
+	if opts.RetryBaseDelay <= 0 {
+		opts.RetryBaseDelay = time.Second
+	}
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = DefaultProgressInterval
+	}
+	var downloadSem chan struct{}
+	if opts.MaxConcurrent > 0 {
+		downloadSem = make(chan struct{}, opts.MaxConcurrent)
+	}
 	return &SidecarClient{
 		resty:           opts.Resty,
 		log:             opts.Log,
 		proxyReaderFunc: opts.ProxyReaderFunc,
+		queueFunc:       opts.QueueFunc,
+		progressFunc:    opts.ProgressFunc,
+		progressEvery:   opts.ProgressInterval,
+		verifyDownload:  opts.VerifyDownload,
+		verifyAlgo:      opts.VerifyAlgorithm,
+		downloadSem:     downloadSem,
+		rateLimiter:     opts.RateLimiter,
+		retries:         opts.Retries,
+		retryBaseDelay:  opts.RetryBaseDelay,
+		decompress:      opts.Decompress,
+		wireCompression: opts.WireCompression,
+		requestToken:    opts.RequestToken,
 	}
 }
 
-func (c *SidecarClient) ListSnapshots(ctx context.Context) (infos []*types.SnapshotInfo, err error) {
-	res, err := c.resty.R().
+// Host returns the address of the sidecar, e.g. to name the source of a download.
+func (c *SidecarClient) Host() string {
+	u, err := url.Parse(c.resty.HostURL)
+	if err != nil || u.Host == "" {
+		return c.resty.HostURL
+	}
+	return u.Host
+}
+
+// ReplacePort returns the host:port of a target with the port replaced, or added if it has none,
+// e.g. to reach the sidecar of a node discovered by its RPC address.
+func ReplacePort(target string, port string) string {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(target, "["), "]")
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// joinURLPath appends a path prefix to a base URL,
+// separated by a single slash and without a trailing slash.
+func joinURLPath(base string, prefix string) string {
+	base = strings.TrimRight(base, "/")
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return base
+	}
+	return base + "/" + prefix
+}
+
+// request starts an API request with the headers of ctx.
+func (c *SidecarClient) request(ctx context.Context) *resty.Request {
+	header := make(http.Header)
+	setRequestHeaders(ctx, header)
+	return c.resty.R().
 		SetContext(ctx).
+		SetHeaders(flattenHeader(header))
+}
+
+func (c *SidecarClient) ListSnapshots(ctx context.Context) (infos []*types.SnapshotInfo, err error) {
+	res, err := c.request(ctx).
 		SetHeader("accept", "application/json").
 		SetResult(&infos).
 		Get("/v1/snapshots")
 	if err != nil {
-		return nil, err
+		return nil, decodeError(err)
 	}
 	if err := expectOK(res.RawResponse, "list snapshots"); err != nil {
 		return nil, err
@@ -86,74 +244,666 @@ func (c *SidecarClient) ListSnapshots(ctx context.Context) (infos []*types.Snaps
 	return
 }
 
+// GetVersion returns the software version of the Solana node.
+func (c *SidecarClient) GetVersion(ctx context.Context) (version *rpc.GetVersionResult, err error) {
+	res, err := c.request(ctx).
+		SetHeader("accept", "application/json").
+		SetResult(&version).
+		Get("/v1/version")
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	if err := expectOK(res.RawResponse, "get version"); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// GetNodeStatus returns the current slot and health of the Solana node.
+func (c *SidecarClient) GetNodeStatus(ctx context.Context) (status *types.NodeStatus, err error) {
+	res, err := c.request(ctx).
+		SetHeader("accept", "application/json").
+		SetResult(&status).
+		Get("/v1/node_status")
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	if err := expectOK(res.RawResponse, "get node status"); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// GetFileChecksum returns the checksum of a snapshot file as precomputed by the sidecar,
+// formatted as "<algorithm>:<hex digest>".
+// Fails with ErrChecksumUnavailable if the sidecar has none (yet).
+func (c *SidecarClient) GetFileChecksum(ctx context.Context, name string) (string, error) {
+	return c.GetFileChecksumWithAlgorithm(ctx, name, "")
+}
+
+// GetFileChecksumWithAlgorithm is like GetFileChecksum, but requests the given algorithm.
+// Empty selects the default algorithm of the sidecar.
+func (c *SidecarClient) GetFileChecksumWithAlgorithm(ctx context.Context, name string, algo string) (string, error) {
+	req := c.request(ctx)
+	if algo != "" {
+		req.SetQueryParam("algo", algo)
+	}
+	res, err := req.
+		Get("/v1/snapshot/" + url.PathEscape(name) + "/checksum")
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode() == http.StatusNotFound {
+		return "", ErrChecksumUnavailable
+	}
+	if err := expectOK(res.RawResponse, "get checksum"); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res.String()), nil
+}
+
+// RequestSnapshot asks the sidecar to provide a snapshot at or after the given slot.
+// Poll the returned request using GetSnapshotRequest until it is no longer pending.
+//
+// Requires the sidecar to allow snapshot requests, and the client to set RequestToken.
+func (c *SidecarClient) RequestSnapshot(ctx context.Context, slot uint64) (req *types.SnapshotRequest, err error) {
+	res, err := c.request(ctx).
+		SetAuthToken(c.requestToken).
+		SetHeader("accept", "application/json").
+		SetQueryParam("slot", strconv.FormatUint(slot, 10)).
+		SetResult(&req).
+		Post("/v1/snapshot_requests")
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	if res.StatusCode() != http.StatusAccepted {
+		if err := expectOK(res.RawResponse, "request snapshot"); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// GetSnapshotRequest returns the current state of a snapshot request made by RequestSnapshot.
+func (c *SidecarClient) GetSnapshotRequest(ctx context.Context, id string) (req *types.SnapshotRequest, err error) {
+	res, err := c.request(ctx).
+		SetAuthToken(c.requestToken).
+		SetHeader("accept", "application/json").
+		SetResult(&req).
+		Get("/v1/snapshot_requests/" + url.PathEscape(id))
+	if err != nil {
+		return nil, decodeError(err)
+	}
+	if err := expectOK(res.RawResponse, "get snapshot request"); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// ErrChecksumUnavailable is returned when the sidecar provides no checksum for a file.
+var ErrChecksumUnavailable = errors.New("checksum not available")
+
+// ErrChecksumMismatch is returned when a downloaded file does not match the checksum provided by the sidecar.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// StatSnapshotFile returns the size of a snapshot file using a HEAD request.
+// Returns -1 if the server does not report the size.
+func (c *SidecarClient) StatSnapshotFile(ctx context.Context, name string) (size int64, err error) {
+	snapURL := c.resty.HostURL + "/v1/snapshot/" + url.PathEscape(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, snapURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	setRequestHeaders(ctx, req.Header)
+	res, err := c.resty.GetClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = res.Body.Close()
+	if err := expectSnapshotOK(res, "stat snapshot"); err != nil {
+		return 0, err
+	}
+	return res.ContentLength, nil
+}
+
 // StreamSnapshot starts a download of a snapshot file.
-// The returned response is guaranteed to have a valid ContentLength.
+// The returned response has a ContentLength of -1 if the server does not report the size.
 // The caller has the responsibility to close the response body even if the error is not nil.
 func (c *SidecarClient) StreamSnapshot(ctx context.Context, name string) (res *http.Response, err error) {
+	return c.StreamSnapshotFrom(ctx, name, 0)
+}
+
+// StreamSnapshotFrom is like StreamSnapshot, but requests the file contents starting at the given offset.
+//
+// If the server honors the range request, the status is 206 Partial Content
+// and the response body starts at the given offset.
+// Otherwise, the status is 200 OK and the response body contains the whole file.
+func (c *SidecarClient) StreamSnapshotFrom(ctx context.Context, name string, offset int64) (res *http.Response, err error) {
+	return c.streamSnapshot(ctx, name, offset, "")
+}
+
+// streamSnapshot is like StreamSnapshotFrom, but sends If-None-Match with the given ETag, if any.
+// Returns the response with status 304 Not Modified without error if the ETag matches.
+func (c *SidecarClient) streamSnapshot(ctx context.Context, name string, offset int64, etag string) (res *http.Response, err error) {
 	snapURL := c.resty.HostURL + "/v1/snapshot/" + url.PathEscape(name)
-	c.log.Debug("Downloading snapshot", zap.String("snapshot_url", snapURL))
+	c.log.Debug("Downloading snapshot",
+		zap.String("snapshot_url", snapURL),
+		zap.Int64("offset", offset),
+		zap.String("request_id", RequestID(ctx)))
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, snapURL, nil)
 	if err != nil {
 		return nil, err
 	}
+	if offset > 0 {
+		req.Header.Set("range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if etag != "" {
+		req.Header.Set("if-none-match", etag)
+	}
+	// Partial downloads resume at offsets in the uncompressed file.
+	if c.wireCompression && offset == 0 && compressionSuffix(name) == "" {
+		req.Header.Set("accept-encoding", "zstd")
+	}
+	setRequestHeaders(ctx, req.Header)
 	res, err = c.resty.GetClient().Do(req)
 	if err != nil {
 		return
 	}
-	if err = expectOK(res, "download snapshot"); err != nil {
+	if etag != "" && res.StatusCode == http.StatusNotModified {
 		return
 	}
-	if res.ContentLength < 0 {
-		err = fmt.Errorf("content length unknown")
+	if offset > 0 && res.StatusCode == http.StatusPartialContent {
+		if !strings.HasPrefix(res.Header.Get("content-range"), fmt.Sprintf("bytes %d-", offset)) {
+			err = fmt.Errorf("download snapshot: unexpected content range %q", res.Header.Get("content-range"))
+			return
+		}
+	} else if err = expectSnapshotOK(res, "download snapshot"); err != nil {
+		return
+	}
+	return
+}
+
+// StreamSnapshotRange requests the bytes from start to end (inclusive) of a snapshot file.
+//
+// Fails with ErrRangeUnsupported if the server does not honor the range request.
+// The caller has the responsibility to close the response body even if the error is not nil.
+func (c *SidecarClient) StreamSnapshotRange(ctx context.Context, name string, start, end int64) (res *http.Response, err error) {
+	snapURL := c.resty.HostURL + "/v1/snapshot/" + url.PathEscape(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, snapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("range", fmt.Sprintf("bytes=%d-%d", start, end))
+	setRequestHeaders(ctx, req.Header)
+	res, err = c.resty.GetClient().Do(req)
+	if err != nil {
+		return
+	}
+	if res.StatusCode == http.StatusOK {
+		err = ErrRangeUnsupported
+		return
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		err = newSnapshotStatusError(res, "download snapshot range")
+		return
+	}
+	if !strings.HasPrefix(res.Header.Get("content-range"), fmt.Sprintf("bytes %d-%d/", start, end)) {
+		err = fmt.Errorf("download snapshot range: unexpected content range %q", res.Header.Get("content-range"))
 	}
 	return
 }
 
+// ErrRangeUnsupported is returned when a server ignores a range request.
+var ErrRangeUnsupported = errors.New("server does not support range requests")
+
 // DownloadSnapshotFile downloads a snapshot to a file in the local file system.
+//
+// Data is written to a "<name>.part" file which gets renamed once the download completes.
+// If a partial file is left over from a previous attempt, the download resumes where it left off.
+// Falls back to a full download if the server does not support range requests.
+// If the file already exists in destDir, the download is skipped if the server reports it unchanged.
+//
+// Blocks until a download slot is available if the client limits concurrent downloads.
+// Transient errors are retried with exponential backoff if the client is configured to do so.
 func (c *SidecarClient) DownloadSnapshotFile(ctx context.Context, destDir string, name string) error {
-	res, err := c.StreamSnapshot(ctx, name)
+	_, err := c.DownloadSnapshotFileWithReport(ctx, destDir, name)
+	return err
+}
+
+// DownloadSnapshotFileWithReport is like DownloadSnapshotFile, but also reports how long the transfer took.
+func (c *SidecarClient) DownloadSnapshotFileWithReport(ctx context.Context, destDir string, name string) (report FileReport, err error) {
+	return c.downloadSnapshotFileWithReport(ctx, destDir, destDir, name)
+}
+
+// downloadSnapshotFileWithReport is like DownloadSnapshotFileWithReport,
+// but checks for an existing copy of the file in currentDir instead of destDir.
+// The report is marked unchanged if the server confirms that copy is current, leaving destDir untouched.
+func (c *SidecarClient) downloadSnapshotFileWithReport(ctx context.Context, destDir string, currentDir string, name string) (report FileReport, err error) {
+	report.FileName = name
+	report.Source = c.Host()
+	ctx, span := tracer.Start(ctx, "SidecarClient.DownloadSnapshotFile",
+		trace.WithAttributes(attribute.String("file_name", name)))
+	if file := ledger.ParseSnapshotFileName(name); file != nil {
+		span.SetAttributes(attribute.Int64("slot", int64(file.Slot)))
+	}
+	defer func() {
+		span.SetAttributes(attribute.Int64("bytes_transferred", report.Bytes))
+		endSpan(span, err)
+	}()
+
+	release, err := c.acquireSlot(ctx, name)
+	if err != nil {
+		return report, err
+	}
+	defer release()
+
+	start := time.Now()
+	defer func() { report.Elapsed = time.Since(start) }()
+	for attempt := 0; ; attempt++ {
+		var n int64
+		n, report.Unchanged, err = c.downloadSnapshotFile(ctx, destDir, currentDir, name)
+		report.Bytes += n
+		if err == nil || attempt >= c.retries || !isRetryable(err) {
+			return report, err
+		}
+		delay := retryDelay(c.retryBaseDelay, attempt, err)
+		c.log.Warn("Download failed, retrying",
+			zap.String("snapshot", name),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return report, err
+		}
+	}
+}
+
+// acquireSlot waits for a download slot if the client limits concurrent downloads.
+func (c *SidecarClient) acquireSlot(ctx context.Context, name string) (release func(), err error) {
+	if c.queueFunc != nil {
+		c.queueFunc(name)
+	}
+	if c.downloadSem == nil {
+		return func() {}, nil
+	}
+	select {
+	case c.downloadSem <- struct{}{}:
+		return func() { <-c.downloadSem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// LocalFileName returns the name under which a downloaded snapshot file is stored.
+// Differs from the remote name when decompressing on the fly.
+func (c *SidecarClient) LocalFileName(name string) string {
+	return LocalFileName(name, c.decompress)
+}
+
+// LocalFileName returns the name under which a downloaded snapshot file is stored,
+// depending on whether snapshots get decompressed.
+func LocalFileName(name string, decompress bool) string {
+	if compression := compressionSuffix(name); decompress && canDecompress(compression) {
+		return strings.TrimSuffix(name, compression)
+	}
+	return name
+}
+
+// downloadSnapshotFile makes a single download attempt, returning the number of bytes transferred
+// and whether the copy of the file in currentDir is still current.
+func (c *SidecarClient) downloadSnapshotFile(ctx context.Context, destDir string, currentDir string, name string) (transferred int64, unchanged bool, err error) {
+	localName := c.LocalFileName(name)
+	decompress := localName != name
+	partPath := filepath.Join(destDir, localName+".part")
+	if c.decompress && !decompress && compressionSuffix(name) != "" {
+		c.log.Warn("Unsupported compression, storing snapshot as is", zap.String("snapshot", name))
+	}
+
+	// Check for leftovers of an interrupted download.
+	// Decompressed files cannot be resumed, as offsets in the compressed stream are unknown.
+	var offset int64
+	if stat, err := os.Stat(partPath); err == nil && stat.Mode().IsRegular() && !decompress {
+		offset = stat.Size()
+	}
+
+	// Ask the server whether an existing file is still current.
+	destPath := filepath.Join(destDir, localName)
+	etag := currentETag(filepath.Join(currentDir, localName), name)
+
+	res, err := c.streamSnapshot(ctx, name, offset, etag)
+	if offset > 0 && res != nil && res.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// Partial file is bigger than the remote file, start over.
+		c.log.Debug("Discarding partial download", zap.String("snapshot", name))
+		_ = res.Body.Close()
+		offset = 0
+		res, err = c.streamSnapshot(ctx, name, 0, etag)
+	}
 	if res != nil {
 		defer res.Body.Close()
 	}
 	if err != nil {
-		return err
+		return 0, false, err
+	}
+	if res.StatusCode == http.StatusNotModified {
+		c.log.Debug("Snapshot file unchanged, skipping download", zap.String("snapshot", name))
+		_ = os.Remove(partPath)
+		return 0, true, nil
 	}
 
-	// Open temporary file. (Consider using O_TMPFILE)
-	f, err := os.Create(filepath.Join(destDir, ".tmp."+name))
+	flags := os.O_WRONLY | os.O_CREATE
+	if res.StatusCode == http.StatusPartialContent {
+		flags |= os.O_APPEND
+		c.log.Debug("Resuming partial download",
+			zap.String("snapshot", name),
+			zap.Int64("offset", offset))
+	} else {
+		flags |= os.O_TRUNC
+		offset = 0 // server sends the whole file
+	}
+	f, err := os.OpenFile(partPath, flags, 0666)
 	if err != nil {
-		return err
+		return 0, false, err
 	}
 	defer f.Close()
 
 	// Download
-	proxyRd := c.proxyReaderFunc(name, res.ContentLength, res.Body)
-	_, err = io.Copy(f, proxyRd)
+	counter := &byteCounter{rd: res.Body}
+	var body io.Reader = counter
+	if c.progressFunc != nil {
+		total := int64(-1)
+		if res.ContentLength >= 0 {
+			total = offset + res.ContentLength
+		}
+		body = newProgressReader(counter, c.progressFunc, c.progressEvery, name, offset, total)
+	}
+	proxyRd := c.proxyReaderFunc(name, res.ContentLength, newThrottledReader(ctx, body, c.rateLimiter))
+	defer proxyRd.Close()
+	var src io.Reader = proxyRd
+	// Undo compression for the transfer, the file is hashed and stored as served without it.
+	encoded := res.Header.Get("content-encoding") == "zstd"
+	if encoded {
+		dec, err := newDecompressor(".zst", src)
+		if err != nil {
+			return 0, false, err
+		}
+		defer dec.Close()
+		src = dec
+	}
+	// Hash the file as served while downloading, unless resuming.
+	// The sidecar default is unknown until asked, assume SHA-256.
+	sumAlgo := c.verifyAlgo
+	if sumAlgo == "" {
+		sumAlgo = checksum.SHA256
+	}
+	var sum hash.Hash
+	if c.verifyDownload && res.StatusCode != http.StatusPartialContent {
+		sum = checksum.New(sumAlgo)
+		src = io.TeeReader(src, sum)
+	}
+	compressed := src
+	if decompress {
+		dec, err := newDecompressor(compressionSuffix(name), src)
+		if err != nil {
+			return 0, false, err
+		}
+		defer dec.Close()
+		src = dec
+	}
+	_, err = io.Copy(f, src)
+	if err == nil && decompress && sum != nil {
+		// Hash any trailing bytes the decompressor did not consume.
+		_, err = io.Copy(io.Discard, compressed)
+	}
 	if err != nil {
-		_ = proxyRd.Close()
-		return fmt.Errorf("download failed: %w", err)
+		return counter.n, false, fmt.Errorf("download failed: %w", err)
+	}
+	if encoded && c.progressFunc != nil {
+		// Progress is in transferred bytes, whose total is known only now.
+		c.progressFunc(name, counter.n, counter.n)
+	}
+	if err := f.Close(); err != nil {
+		return counter.n, false, err
+	}
+
+	if c.verifyDownload {
+		// Size of decompressed file is unknown.
+		var size int64
+		if !decompress && !encoded && res.ContentLength >= 0 {
+			size = offset + res.ContentLength
+		}
+		if err := c.verifyPartFile(ctx, partPath, name, size, sum, sumAlgo); err != nil {
+			_ = os.Remove(partPath) // don't resume from a corrupt file
+			return counter.n, false, fmt.Errorf("download from %s: %w", c.Host(), err)
+		}
 	}
-	_ = proxyRd.Close()
 
-	// Promote temporary file.
-	destPath := filepath.Join(destDir, name)
-	err = os.Rename(f.Name(), destPath)
+	// Promote partial file.
+	err = os.Rename(partPath, destPath)
 	if err != nil {
-		return err
+		return counter.n, false, err
 	}
 
+	// Remember the ETag to check whether the file is still current later on.
+	storeETag(destPath, res.Header.Get("etag"))
+
 	// Change modification time to what server said.
 	modTime, err := time.Parse(http.TimeFormat, res.Header.Get("last-modified"))
 	if err == nil && !modTime.IsZero() {
 		_ = os.Chtimes(destPath, time.Now(), modTime)
 	}
 
+	return counter.n, false, nil
+}
+
+// verifyPartFile checks a downloaded file against the checksum provided by the sidecar.
+// Falls back to VerifySnapshotFile if the sidecar provides none,
+// or to checking the size only if a specific algorithm was requested.
+//
+// The sum is the hash of the file as served using sumAlgo,
+// or nil if it needs to be computed from the downloaded file.
+func (c *SidecarClient) verifyPartFile(ctx context.Context, partPath string, name string, size int64, sum hash.Hash, sumAlgo string) error {
+	localName := c.LocalFileName(name)
+	log := c.log.With(zap.String("snapshot", name))
+	sidecarSum, err := c.GetFileChecksumWithAlgorithm(ctx, name, c.verifyAlgo)
+	algo := checksum.Algorithm(sidecarSum)
+	if algo != sumAlgo {
+		sum = nil
+	}
+	if err == nil && checksum.Supported(algo) && (sum != nil || localName == name) {
+		log.Debug("Verifying snapshot checksum", zap.String("algorithm", algo))
+		return verifyChecksum(partPath, name, sidecarSum, sum)
+	}
+	if err != nil {
+		log.Debug("No checksum available", zap.Error(err))
+	} else {
+		log.Debug("Unsupported checksum", zap.String("checksum", sidecarSum))
+	}
+
+	if c.verifyAlgo != "" {
+		return verifySize(partPath, localName, size, log)
+	}
+	expected := ledger.ParseSnapshotFileName(localName)
+	if expected == nil {
+		return fmt.Errorf("cannot verify snapshot with unrecognized name: %s", localName)
+	}
+	expected.Size = uint64(size)
+	err = VerifySnapshotFile(partPath, expected)
+	if errors.Is(err, ErrUnsupportedCompression) {
+		log.Warn("Cannot check contents of snapshot with unsupported compression, only checked size")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("verify %s: %w", localName, err)
+	}
+	return nil
+}
+
+// verifySize checks the size of a downloaded file, if known.
+func verifySize(partPath string, localName string, size int64, log *zap.Logger) error {
+	log.Warn("Sidecar provides no checksum of requested algorithm, only checking size")
+	if size <= 0 {
+		return nil
+	}
+	stat, err := os.Stat(partPath)
+	if err != nil {
+		return err
+	}
+	if stat.Size() != size {
+		return fmt.Errorf("verify %s: expected %d bytes, got %d", localName, size, stat.Size())
+	}
+	return nil
+}
+
+// verifyChecksum compares the checksum of a downloaded file with the expected one.
+func verifyChecksum(partPath string, name string, expected string, sum hash.Hash) error {
+	algo := checksum.Algorithm(expected)
+	if sum == nil {
+		f, err := os.Open(partPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sum = checksum.New(algo)
+		if _, err := io.Copy(sum, f); err != nil {
+			return err
+		}
+	}
+	actual := checksum.Format(algo, sum.Sum(nil))
+	if actual != expected {
+		return fmt.Errorf("verify %s: %w: expected %s, got %s", name, ErrChecksumMismatch, expected, actual)
+	}
 	return nil
 }
 
+// maxRedirects is the max number of redirects followed by a request.
+const maxRedirects = 10
+
+// checkRedirect follows redirects, e.g. to presigned URLs of an object store.
+// Headers like Range carry over to the redirected request,
+// but credentials are dropped once the redirect leaves the origin of the first request.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !sameOrigin(req.URL, via[0].URL) {
+		req.Header.Del("authorization")
+		req.Header.Del("proxy-authorization")
+		req.Header.Del("cookie")
+	}
+	return nil
+}
+
+// sameOrigin returns whether two URLs share the scheme, host and port.
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host)
+}
+
+// transportOpts customizes an HTTP transport. Zero values keep the defaults.
+type transportOpts struct {
+	tlsConfig             *tls.Config
+	dialTimeout           time.Duration
+	responseHeaderTimeout time.Duration
+	idleConnTimeout       time.Duration
+	maxIdleConnsPerHost   int
+	disableHTTP2          bool
+}
+
+// newTransport returns a copy of the default HTTP transport with the given options applied.
+func newTransport(opts transportOpts) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.tlsConfig != nil {
+		transport.TLSClientConfig = opts.tlsConfig
+	}
+	if opts.dialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   opts.dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	if opts.responseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = opts.responseHeaderTimeout
+	}
+	if opts.idleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.idleConnTimeout
+	}
+	if opts.maxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.maxIdleConnsPerHost
+	}
+	if opts.disableHTTP2 {
+		// A non-nil empty map disables HTTP/2 upgrades.
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		if transport.TLSClientConfig != nil {
+			transport.TLSClientConfig = transport.TLSClientConfig.Clone()
+			transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+		}
+	}
+	return transport
+}
+
+// StatusError is returned when a server responds with an unexpected HTTP status.
+//
+// Unwraps to ErrUnauthorized or ErrSnapshotNotFound, depending on the status.
+type StatusError struct {
+	Op         string
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration // delay requested by the server, zero if none
+	Err        error         // sentinel error matching the status, if any
+}
+
+func (e *StatusError) Error() string {
+	return e.Op + ": " + e.Status
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
 func expectOK(res *http.Response, op string) error {
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("%s: %s", op, res.Status)
+		return newStatusError(res, op)
+	}
+	return nil
+}
+
+func newStatusError(res *http.Response, op string) *StatusError {
+	err := &StatusError{
+		Op:         op,
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		RetryAfter: parseRetryAfter(res.Header.Get("retry-after")),
+	}
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		err.Err = ErrUnauthorized
+	}
+	return err
+}
+
+// expectSnapshotOK is like expectOK for requests of a snapshot file.
+func expectSnapshotOK(res *http.Response, op string) error {
+	if res.StatusCode != http.StatusOK {
+		return newSnapshotStatusError(res, op)
 	}
 	return nil
 }
+
+// newSnapshotStatusError is like newStatusError, but unwraps to ErrSnapshotNotFound if the file is missing.
+func newSnapshotStatusError(res *http.Response, op string) *StatusError {
+	err := newStatusError(res, op)
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+		err.Err = ErrSnapshotNotFound
+	}
+	return err
+}
+
+// byteCounter counts the bytes read through it.
+type byteCounter struct {
+	rd io.Reader
+	n  int64
+}
+
+func (b *byteCounter) Read(p []byte) (int, error) {
+	n, err := b.rd.Read(p)
+	b.n += int64(n)
+	return n, err
+}
@@ -2,16 +2,24 @@ package fetch
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
@@ -103,3 +111,765 @@ func (m *mockReadCloser) Close() error {
 	m.closes.Add(1)
 	return nil
 }
+
+func TestSidecarClient_DownloadSnapshotFile_Resume(t *testing.T) {
+	const snapshotName = "bla.tar.zst"
+	content := append(bytes.Repeat([]byte{'A'}, 40), bytes.Repeat([]byte{'B'}, 60)...)
+
+	// Start server supporting range requests
+	var rangeHeader atomic.String
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader.Store(r.Header.Get("range"))
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	var proxySize atomic.Int64
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+		Resty: resty.NewWithClient(server.Client()),
+		ProxyReaderFunc: func(_ string, size int64, rd io.Reader) io.ReadCloser {
+			proxySize.Store(size)
+			return io.NopCloser(rd)
+		},
+	})
+
+	// Leave partial download in temp dir
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, snapshotName+".part"), content[:40], 0666))
+
+	err := client.DownloadSnapshotFile(context.TODO(), tmpDir, snapshotName)
+	require.NoError(t, err)
+
+	assert.Equal(t, "bytes=40-", rangeHeader.Load())
+	assert.Equal(t, int64(60), proxySize.Load())
+	actual, err := os.ReadFile(filepath.Join(tmpDir, snapshotName))
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+	_, err = os.Stat(filepath.Join(tmpDir, snapshotName+".part"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSidecarClient_DownloadSnapshotFile_Redirect(t *testing.T) {
+	const snapshotName = "bla.tar.zst"
+	content := append(bytes.Repeat([]byte{'A'}, 40), bytes.Repeat([]byte{'B'}, 60)...)
+
+	// Object store serving presigned URLs, on another origin than the sidecar.
+	var rangeHeader, authHeader atomic.String
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader.Store(r.Header.Get("range"))
+		authHeader.Store(r.Header.Get("authorization"))
+		if r.URL.Query().Get("signature") != "ok" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader(content))
+	}))
+	defer store.Close()
+	var sidecarAuth atomic.String
+	sidecar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/snapshot/" + snapshotName:
+			sidecarAuth.Store(r.Header.Get("authorization"))
+			http.Redirect(w, r, store.URL+"/bucket/"+snapshotName+"?signature=ok", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/v1/snapshot/"+snapshotName, http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer sidecar.Close()
+
+	t.Run("Resume", func(t *testing.T) {
+		client := NewSidecarClient(sidecar.URL)
+		tmpDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, snapshotName+".part"), content[:40], 0666))
+
+		err := client.DownloadSnapshotFile(context.TODO(), tmpDir, snapshotName)
+		require.NoError(t, err)
+		assert.Equal(t, "bytes=40-", rangeHeader.Load())
+		actual, err := os.ReadFile(filepath.Join(tmpDir, snapshotName))
+		require.NoError(t, err)
+		assert.Equal(t, content, actual)
+	})
+	t.Run("StripAuth", func(t *testing.T) {
+		client := NewSidecarClient(sidecar.URL)
+		req, err := http.NewRequest(http.MethodGet, sidecar.URL+"/moved", nil)
+		require.NoError(t, err)
+		req.Header.Set("authorization", "Bearer secret")
+		res, err := client.resty.GetClient().Do(req)
+		require.NoError(t, err)
+		_ = res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "Bearer secret", sidecarAuth.Load(), "kept on same origin")
+		assert.Empty(t, authHeader.Load(), "dropped on other origin")
+	})
+}
+
+func TestSidecarClient_DownloadSnapshotFile_NotModified(t *testing.T) {
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	const etag = `"0-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"`
+
+	var ifNoneMatch atomic.String
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch.Store(r.Header.Get("if-none-match"))
+		w.Header().Set("etag", etag)
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader([]byte("new")))
+	}))
+	defer server.Close()
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+		Resty: resty.NewWithClient(server.Client()),
+	})
+
+	tmpDir := t.TempDir()
+	err := client.DownloadSnapshotFile(context.TODO(), tmpDir, snapshotName)
+	require.NoError(t, err)
+	assert.Empty(t, ifNoneMatch.Load(), "no local file yet")
+
+	// Server reports the local file unchanged, so it is kept.
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, snapshotName), []byte("old"), 0666))
+	report, err := client.DownloadSnapshotFileWithReport(context.TODO(), tmpDir, snapshotName)
+	require.NoError(t, err)
+	assert.Equal(t, etag, ifNoneMatch.Load())
+	assert.Equal(t, int64(0), report.Bytes)
+	actual, err := os.ReadFile(filepath.Join(tmpDir, snapshotName))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(actual))
+}
+
+func TestSidecarClient_DownloadSnapshotFile_ResumeUnsupported(t *testing.T) {
+	const snapshotName = "bla.tar.zst"
+	content := bytes.Repeat([]byte{'A'}, 100)
+
+	// Start server ignoring range requests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("content-length", "100")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{Resty: resty.NewWithClient(server.Client())})
+
+	// Leave garbage partial download in temp dir
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, snapshotName+".part"), []byte("garbage"), 0666))
+
+	err := client.DownloadSnapshotFile(context.TODO(), tmpDir, snapshotName)
+	require.NoError(t, err)
+
+	actual, err := os.ReadFile(filepath.Join(tmpDir, snapshotName))
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+}
+
+func TestSidecarClient_DownloadSnapshotFile_MaxConcurrent(t *testing.T) {
+	const maxConcurrent = 2
+
+	// Start server tracking the number of concurrent requests
+	var active, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := active.Inc()
+		defer active.Dec()
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("content-length", "1")
+		_, _ = w.Write([]byte{'A'})
+	}))
+	defer server.Close()
+
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+		Resty:         resty.NewWithClient(server.Client()),
+		MaxConcurrent: maxConcurrent,
+	})
+
+	tmpDir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, client.DownloadSnapshotFile(context.TODO(), tmpDir, fmt.Sprintf("snap%d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(maxConcurrent), peak.Load())
+}
+
+func TestSidecarClient_DownloadSnapshotFile_Retry(t *testing.T) {
+	cases := []struct {
+		name     string
+		failures int32
+		status   int
+		requests int32
+		ok       bool
+	}{
+		{name: "Transient", failures: 2, status: http.StatusServiceUnavailable, requests: 3, ok: true},
+		{name: "TooManyFailures", failures: 5, status: http.StatusBadGateway, requests: 4, ok: false},
+		{name: "NotFound", failures: 5, status: http.StatusNotFound, requests: 1, ok: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if requests.Inc() <= tc.failures {
+					w.WriteHeader(tc.status)
+					return
+				}
+				w.Header().Set("content-length", "1")
+				_, _ = w.Write([]byte{'A'})
+			}))
+			defer server.Close()
+
+			client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+				Resty:          resty.NewWithClient(server.Client()),
+				Retries:        3,
+				RetryBaseDelay: time.Millisecond,
+			})
+			err := client.DownloadSnapshotFile(context.TODO(), t.TempDir(), "snap")
+			if tc.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			assert.Equal(t, tc.requests, requests.Load())
+		})
+	}
+}
+
+func TestSidecarClient_DownloadSnapshotFile_RetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Inc() == 1 {
+			w.Header().Set("retry-after", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("content-length", "1")
+		_, _ = w.Write([]byte{'A'})
+	}))
+	defer server.Close()
+
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+		Resty:          resty.NewWithClient(server.Client()),
+		Retries:        1,
+		RetryBaseDelay: time.Millisecond,
+	})
+	start := time.Now()
+	require.NoError(t, client.DownloadSnapshotFile(context.TODO(), t.TempDir(), "snap"))
+	assert.GreaterOrEqual(t, time.Since(start), time.Second, "waits as long as the server asked")
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-5"))
+	assert.Equal(t, 10*time.Second, parseRetryAfter("10"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+	delay := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, float64(time.Hour), float64(delay), float64(2*time.Second))
+}
+
+func TestSidecarClient_DownloadSnapshotFile_Decompress(t *testing.T) {
+	content := bytes.Repeat([]byte("snapshot"), 1000)
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	var gzipped bytes.Buffer
+	gzipWr := gzip.NewWriter(&gzipped)
+	_, err = gzipWr.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gzipWr.Close())
+	// The standard library has no bzip2 encoder.
+	bzipped, err := base64.StdEncoding.DecodeString("QlpoOTFBWSZTWWG6W3gADauBgCBBzAAgAFCGAE1UGjdSDKpBypBypBlSD1SD1SD4u5IpwoSDDdLbwA==")
+	require.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		compressed []byte
+		localName  string
+		expected   []byte
+	}{
+		{"bla.tar.zst", enc.EncodeAll(content, nil), "bla.tar", content},
+		{"bla.tar.gz", gzipped.Bytes(), "bla.tar", content},
+		{"bla.tar.bz2", bzipped, "bla.tar", content},
+		{"bla.tar.xz", []byte("opaque"), "bla.tar.xz", []byte("opaque")},
+		{"bla.tar", content, "bla.tar", content},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.ServeContent(w, r, tc.name, time.Time{}, bytes.NewReader(tc.compressed))
+			}))
+			defer server.Close()
+
+			var proxySize atomic.Int64
+			client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+				Resty: resty.NewWithClient(server.Client()),
+				ProxyReaderFunc: func(_ string, size int64, rd io.Reader) io.ReadCloser {
+					proxySize.Store(size)
+					return io.NopCloser(rd)
+				},
+				Decompress: true,
+			})
+			assert.Equal(t, tc.localName, client.LocalFileName(tc.name))
+
+			tmpDir := t.TempDir()
+			require.NoError(t, client.DownloadSnapshotFile(context.TODO(), tmpDir, tc.name))
+
+			assert.Equal(t, int64(len(tc.compressed)), proxySize.Load())
+			actual, err := os.ReadFile(filepath.Join(tmpDir, tc.localName))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+	assert.Equal(t, "bla.tar.zst", LocalFileName("bla.tar.zst", false))
+}
+
+func TestSidecarClient_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	// Without the server's CA, verification fails.
+	_, err := NewSidecarClient(server.URL).ListSnapshots(context.TODO())
+	assert.Error(t, err)
+
+	tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{TLSConfig: tlsConfig})
+	infos, err := client.ListSnapshots(context.TODO())
+	require.NoError(t, err)
+	assert.Empty(t, infos)
+}
+
+func TestSidecarClient_HTTP2(t *testing.T) {
+	var proto atomic.String
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto.Store(r.Proto)
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{TLSConfig: tlsConfig})
+	_, err := client.ListSnapshots(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", proto.Load())
+
+	client = NewSidecarClientWithOpts(server.URL, SidecarClientOpts{TLSConfig: tlsConfig, DisableHTTP2: true})
+	_, err = client.ListSnapshots(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", proto.Load())
+}
+
+func TestSidecarClient_DownloadSnapshotFile_QueueFunc(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "bla.tar.zst", time.Time{}, bytes.NewReader([]byte("A")))
+	}))
+	defer server.Close()
+
+	var events []string
+	var lock sync.Mutex
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+		Resty: resty.NewWithClient(server.Client()),
+		QueueFunc: func(name string) {
+			lock.Lock()
+			events = append(events, "queue "+name)
+			lock.Unlock()
+		},
+		ProxyReaderFunc: func(name string, _ int64, rd io.Reader) io.ReadCloser {
+			lock.Lock()
+			events = append(events, "start "+name)
+			lock.Unlock()
+			return io.NopCloser(rd)
+		},
+		MaxConcurrent: 1,
+	})
+	require.NoError(t, client.DownloadSnapshotFile(context.TODO(), t.TempDir(), "bla.tar.zst"))
+	assert.Equal(t, []string{"queue bla.tar.zst", "start bla.tar.zst"}, events)
+}
+
+func TestSidecarClient_StatSnapshotFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		if r.URL.Path != "/v1/snapshot/bla.tar.zst" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("content-length", "100")
+	}))
+	defer server.Close()
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{Resty: resty.NewWithClient(server.Client())})
+
+	size, err := client.StatSnapshotFile(context.TODO(), "bla.tar.zst")
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), size)
+
+	_, err = client.StatSnapshotFile(context.TODO(), "missing.tar.zst")
+	assert.EqualError(t, err, "stat snapshot: 404 Not Found")
+}
+
+func TestSidecarClient_DownloadSnapshotFile_UnknownSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// Flushing before the body is complete forces chunked encoding without a length.
+		_, _ = w.Write([]byte("AA"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("AA"))
+	}))
+	defer server.Close()
+
+	var reportedSize atomic.Int64
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+		Resty: resty.NewWithClient(server.Client()),
+		ProxyReaderFunc: func(_ string, size int64, rd io.Reader) io.ReadCloser {
+			reportedSize.Store(size)
+			return io.NopCloser(rd)
+		},
+	})
+	dir := t.TempDir()
+	require.NoError(t, client.DownloadSnapshotFile(context.TODO(), dir, "bla.tar.zst"))
+	assert.Equal(t, int64(-1), reportedSize.Load())
+	content, err := os.ReadFile(filepath.Join(dir, "bla.tar.zst"))
+	require.NoError(t, err)
+	assert.Equal(t, "AAAA", string(content))
+}
+
+func TestSidecarClient_DownloadSnapshotFile_WireCompression(t *testing.T) {
+	data := bytes.Repeat([]byte{'A'}, 10000)
+	var encoded bytes.Buffer
+	enc, err := zstd.NewWriter(&encoded)
+	require.NoError(t, err)
+	_, err = enc.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("accept-encoding") != "zstd" {
+			_, _ = w.Write(data)
+			return
+		}
+		w.Header().Set("content-encoding", "zstd")
+		_, _ = w.Write(encoded.Bytes()[:10])
+		w.(http.Flusher).Flush()
+		_, _ = w.Write(encoded.Bytes()[10:])
+	}))
+	defer server.Close()
+
+	var downloaded, total atomic.Int64
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+		Resty:           resty.NewWithClient(server.Client()),
+		WireCompression: true,
+		ProgressFunc: func(_ string, downloaded_, total_ int64) {
+			downloaded.Store(downloaded_)
+			total.Store(total_)
+		},
+	})
+	dir := t.TempDir()
+	require.NoError(t, client.DownloadSnapshotFile(context.TODO(), dir, "bla.tar"))
+	content, err := os.ReadFile(filepath.Join(dir, "bla.tar"))
+	require.NoError(t, err)
+	assert.Equal(t, data, content)
+	assert.Equal(t, int64(encoded.Len()), downloaded.Load(), "progress in transferred bytes")
+	assert.Equal(t, int64(encoded.Len()), total.Load())
+
+	// Compressed snapshots are requested as is.
+	require.NoError(t, client.DownloadSnapshotFile(context.TODO(), dir, "bla.tar.zst"))
+	content, err = os.ReadFile(filepath.Join(dir, "bla.tar.zst"))
+	require.NoError(t, err)
+	assert.Equal(t, data, content)
+}
+
+func TestSidecarClient_ResponseHeaderTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/snapshot/stalled.tar.zst" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		// Headers arrive in time, the body takes longer than the header timeout.
+		w.Header().Set("content-length", "2")
+		_, _ = w.Write([]byte("A"))
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		_, _ = w.Write([]byte("A"))
+	}))
+	defer server.Close()
+
+	client := NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+		ResponseHeaderTimeout: 100 * time.Millisecond,
+	})
+	dir := t.TempDir()
+	start := time.Now()
+	err := client.DownloadSnapshotFile(context.TODO(), dir, "stalled.tar.zst")
+	assert.ErrorContains(t, err, "timeout awaiting response headers")
+	assert.Less(t, time.Since(start), time.Second)
+
+	require.NoError(t, client.DownloadSnapshotFile(context.TODO(), dir, "slow.tar.zst"))
+}
+
+func TestSidecarClient_DownloadSnapshotFile_Checksum(t *testing.T) {
+	content := bytes.Repeat([]byte("snapshot"), 1000)
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	compressed := enc.EncodeAll(content, nil)
+	digest := sha256.Sum256(compressed)
+	checksum := "sha256:" + hex.EncodeToString(digest[:])
+
+	newClient := func(t *testing.T, checksum string, decompress bool) *SidecarClient {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/snapshot/bla.tar.zst", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "bla.tar.zst", time.Time{}, bytes.NewReader(compressed))
+		})
+		mux.HandleFunc("/v1/snapshot/bla.tar.zst/checksum", func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(checksum))
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+			Resty:          resty.NewWithClient(server.Client()),
+			VerifyDownload: true,
+			Decompress:     decompress,
+		})
+	}
+
+	t.Run("Match", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, newClient(t, checksum, false).DownloadSnapshotFile(context.TODO(), tmpDir, "bla.tar.zst"))
+		assert.FileExists(t, filepath.Join(tmpDir, "bla.tar.zst"))
+	})
+	t.Run("MatchDecompressed", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, newClient(t, checksum, true).DownloadSnapshotFile(context.TODO(), tmpDir, "bla.tar.zst"))
+		assert.FileExists(t, filepath.Join(tmpDir, "bla.tar"))
+	})
+	t.Run("MatchResumed", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "bla.tar.zst.part"), compressed[:100], 0666))
+		require.NoError(t, newClient(t, checksum, false).DownloadSnapshotFile(context.TODO(), tmpDir, "bla.tar.zst"))
+		assert.FileExists(t, filepath.Join(tmpDir, "bla.tar.zst"))
+	})
+	t.Run("Mismatch", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		client := newClient(t, "sha256:0000", false)
+		err := client.DownloadSnapshotFile(context.TODO(), tmpDir, "bla.tar.zst")
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+		assert.ErrorContains(t, err, "download from "+client.Host()+":", "names the source")
+		assert.False(t, isRetryable(err))
+		assert.NoFileExists(t, filepath.Join(tmpDir, "bla.tar.zst"))
+		assert.NoFileExists(t, filepath.Join(tmpDir, "bla.tar.zst.part"))
+	})
+}
+
+func TestSidecarClient_DownloadSnapshotFile_ChecksumAlgorithm(t *testing.T) {
+	// Not a valid archive, so falling back to checking contents fails.
+	content := []byte("hello")
+	newClient := func(t *testing.T, sums map[string]string, verifyAlgo string) (*SidecarClient, *[]string) {
+		var algos []string
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/snapshot/bla.tar.zst", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "bla.tar.zst", time.Time{}, bytes.NewReader(content))
+		})
+		mux.HandleFunc("/v1/snapshot/bla.tar.zst/checksum", func(w http.ResponseWriter, r *http.Request) {
+			algo := r.URL.Query().Get("algo")
+			algos = append(algos, algo)
+			sum, ok := sums[algo]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(sum))
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+			VerifyDownload:  true,
+			VerifyAlgorithm: verifyAlgo,
+		}), &algos
+	}
+	const (
+		xxh3Sum   = "xxh3:9555e8555c62dcfd"
+		blake3Sum = "blake3:ea8f163db38682925e4491c5e58d4bb3506ef8c14eb78a86e908c5624a67200f"
+	)
+
+	t.Run("Requested", func(t *testing.T) {
+		client, algos := newClient(t, map[string]string{"xxh3": xxh3Sum}, "xxh3")
+		require.NoError(t, client.DownloadSnapshotFile(context.TODO(), t.TempDir(), "bla.tar.zst"))
+		assert.Equal(t, []string{"xxh3"}, *algos)
+	})
+	t.Run("SidecarDefault", func(t *testing.T) {
+		client, algos := newClient(t, map[string]string{"": blake3Sum}, "")
+		require.NoError(t, client.DownloadSnapshotFile(context.TODO(), t.TempDir(), "bla.tar.zst"))
+		assert.Equal(t, []string{""}, *algos)
+	})
+	t.Run("Mismatch", func(t *testing.T) {
+		client, _ := newClient(t, map[string]string{"xxh3": "xxh3:0000000000000000"}, "xxh3")
+		err := client.DownloadSnapshotFile(context.TODO(), t.TempDir(), "bla.tar.zst")
+		assert.ErrorIs(t, err, ErrChecksumMismatch)
+	})
+	t.Run("SizeOnly", func(t *testing.T) {
+		client, _ := newClient(t, map[string]string{"": blake3Sum}, "xxh3")
+		tmpDir := t.TempDir()
+		require.NoError(t, client.DownloadSnapshotFile(context.TODO(), tmpDir, "bla.tar.zst"))
+		assert.FileExists(t, filepath.Join(tmpDir, "bla.tar.zst"))
+	})
+	t.Run("ContentsIfNoneRequested", func(t *testing.T) {
+		client, _ := newClient(t, nil, "")
+		assert.Error(t, client.DownloadSnapshotFile(context.TODO(), t.TempDir(), "bla.tar.zst"))
+	})
+}
+
+// BenchmarkSidecarClient_DownloadSnapshotFile_ManyFiles downloads a snapshot made of many small files over TLS,
+// reusing one client (and its connections) versus creating a client per file.
+func BenchmarkSidecarClient_DownloadSnapshotFile_ManyFiles(b *testing.B) {
+	const numFiles = 50
+	content := bytes.Repeat([]byte{'A'}, 1024)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "bla.tar.zst", time.Time{}, bytes.NewReader(content))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig
+	names := make([]string, numFiles)
+	for i := range names {
+		names[i] = fmt.Sprintf("incremental-snapshot-100-%d-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst", 101+i)
+	}
+	newClient := func(disableHTTP2 bool) *SidecarClient {
+		return NewSidecarClientWithOpts(server.URL, SidecarClientOpts{
+			TLSConfig:     tlsConfig,
+			MaxConcurrent: 4,
+			DisableHTTP2:  disableHTTP2,
+		})
+	}
+	download := func(b *testing.B, client func() *SidecarClient) {
+		for i := 0; i < b.N; i++ {
+			tmpDir := b.TempDir()
+			for _, name := range names {
+				if err := client().DownloadSnapshotFile(context.TODO(), tmpDir, name); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	b.Run("Reused", func(b *testing.B) {
+		client := newClient(false)
+		download(b, func() *SidecarClient { return client })
+	})
+	b.Run("ReusedHTTP1", func(b *testing.B) {
+		client := newClient(true)
+		download(b, func() *SidecarClient { return client })
+	})
+	b.Run("PerFile", func(b *testing.B) {
+		download(b, func() *SidecarClient { return newClient(false) })
+	})
+}
+
+func TestSidecarClient_PathPrefix(t *testing.T) {
+	for _, prefix := range []string{"node-a/snapshots", "/node-a/snapshots", "/node-a/snapshots/"} {
+		t.Run(prefix, func(t *testing.T) {
+			var requests []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/node-a/snapshots/", func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.Method+" "+r.URL.Path)
+				switch r.URL.Path {
+				case "/node-a/snapshots/v1/snapshots":
+					w.Header().Set("content-type", "application/json")
+					_, _ = w.Write([]byte(`[]`))
+				case "/node-a/snapshots/v1/snapshot/snap.tar/checksum":
+					_, _ = w.Write([]byte("sha256:00"))
+				case "/node-a/snapshots/v1/snapshot/snap.tar":
+					w.Header().Set("last-modified", "Wed, 01 Jan 2020 01:01:01 GMT")
+					_, _ = w.Write([]byte("data"))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			client := NewSidecarClientWithOpts(server.URL+"/", SidecarClientOpts{PathPrefix: prefix})
+			ctx := context.Background()
+			_, err := client.ListSnapshots(ctx)
+			require.NoError(t, err)
+			_, err = client.StatSnapshotFile(ctx, "snap.tar")
+			require.NoError(t, err)
+			_, err = client.GetFileChecksum(ctx, "snap.tar")
+			require.NoError(t, err)
+			require.NoError(t, client.DownloadSnapshotFile(ctx, t.TempDir(), "snap.tar"))
+			assert.Equal(t, []string{
+				"GET /node-a/snapshots/v1/snapshots",
+				"HEAD /node-a/snapshots/v1/snapshot/snap.tar",
+				"GET /node-a/snapshots/v1/snapshot/snap.tar/checksum",
+				"GET /node-a/snapshots/v1/snapshot/snap.tar",
+			}, requests)
+			assert.NotContains(t, client.Host(), "/")
+		})
+	}
+}
+
+func TestReplacePort(t *testing.T) {
+	for _, tc := range []struct{ target, want string }{
+		{"a:8899", "a:13080"},
+		{"a:13080", "a:13080"},
+		{"a", "a:13080"},
+		{"10.0.0.1:8899", "10.0.0.1:13080"},
+		{"[::1]:8899", "[::1]:13080"},
+		{"[::1]", "[::1]:13080"},
+		{"::1", "[::1]:13080"},
+		{"[2001:db8::1]:8899", "[2001:db8::1]:13080"},
+	} {
+		assert.Equal(t, tc.want, ReplacePort(tc.target, "13080"), tc.target)
+	}
+}
+
+func TestSidecarClient_IPv6(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback unavailable:", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/snapshots", r.URL.Path)
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	target := listener.Addr().String()
+	require.Equal(t, "[", target[:1])
+	for _, sidecarURL := range []string{
+		TargetURL(target),
+		TargetURL(server.URL),
+		joinURLPath(TargetURL(target), "/"),
+	} {
+		_, err := NewSidecarClient(sidecarURL).ListSnapshots(context.TODO())
+		assert.NoError(t, err, sidecarURL)
+	}
+}
+
+func TestJoinURLPath(t *testing.T) {
+	for _, tc := range []struct{ base, prefix, want string }{
+		{"http://a:1", "", "http://a:1"},
+		{"http://a:1/", "/", "http://a:1"},
+		{"http://a:1", "node-a", "http://a:1/node-a"},
+		{"http://a:1/", "/node-a/", "http://a:1/node-a"},
+		{"http://a:1/proxy/", "node-a/snapshots", "http://a:1/proxy/node-a/snapshots"},
+	} {
+		assert.Equal(t, tc.want, joinURLPath(tc.base, tc.prefix), "%q + %q", tc.base, tc.prefix)
+	}
+}
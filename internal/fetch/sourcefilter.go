@@ -0,0 +1,116 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"net"
+	"strings"
+
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// SourceFilter restricts the sidecars snapshots are downloaded from.
+//
+// Patterns are host names, IP addresses, or CIDR ranges (matching IP targets only).
+// A source matching any deny pattern is dropped.
+// If allow patterns are given, only sources matching one of them are kept.
+// Deny wins over allow.
+type SourceFilter struct {
+	allow []sourcePattern
+	deny  []sourcePattern
+}
+
+type sourcePattern struct {
+	host  string
+	ipNet *net.IPNet
+}
+
+// NewSourceFilter creates a filter from allow and deny patterns.
+// Empty lists allow all sources.
+func NewSourceFilter(allow, deny []string) (*SourceFilter, error) {
+	f := new(SourceFilter)
+	var err error
+	if f.allow, err = parseSourcePatterns(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parseSourcePatterns(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseSourcePatterns(patterns []string) ([]sourcePattern, error) {
+	parsed := make([]sourcePattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "/") {
+			_, ipNet, err := net.ParseCIDR(pattern)
+			if err != nil {
+				return nil, err
+			}
+			parsed = append(parsed, sourcePattern{ipNet: ipNet})
+			continue
+		}
+		parsed = append(parsed, sourcePattern{host: sourceHost(pattern)})
+	}
+	return parsed, nil
+}
+
+// sourceHost strips the port and IPv6 brackets of a target.
+func sourceHost(target string) string {
+	if host, _, err := net.SplitHostPort(target); err == nil {
+		target = host
+	}
+	return strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(target, "["), "]"))
+}
+
+func (p sourcePattern) match(host string) bool {
+	if p.ipNet != nil {
+		ip := net.ParseIP(host)
+		return ip != nil && p.ipNet.Contains(ip)
+	}
+	if ip := net.ParseIP(p.host); ip != nil {
+		return ip.Equal(net.ParseIP(host))
+	}
+	return p.host == host
+}
+
+func matchAny(patterns []sourcePattern, host string) bool {
+	for _, pattern := range patterns {
+		if pattern.match(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed returns whether snapshots may be downloaded from the given target.
+func (f *SourceFilter) Allowed(target string) bool {
+	host := sourceHost(target)
+	if matchAny(f.deny, host) {
+		return false
+	}
+	return len(f.allow) == 0 || matchAny(f.allow, host)
+}
+
+// Filter returns the sources that are allowed, keeping their order.
+func (f *SourceFilter) Filter(sources []types.SnapshotSource) []types.SnapshotSource {
+	var allowed []types.SnapshotSource
+	for _, source := range sources {
+		if f.Allowed(source.Target) {
+			allowed = append(allowed, source)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,74 @@
+package fetch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+func TestSourceFilter(t *testing.T) {
+	cases := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		allowed []string
+		denied  []string
+	}{
+		{
+			name:    "Empty",
+			allowed: []string{"node1:13080", "10.0.0.1:13080"},
+		},
+		{
+			name:    "DenyHost",
+			deny:    []string{"Node1"},
+			allowed: []string{"node2:13080", "10.0.0.1:13080"},
+			denied:  []string{"node1:13080", "node1"},
+		},
+		{
+			name:    "DenyCIDR",
+			deny:    []string{"10.0.0.0/8", "fd00::/8"},
+			allowed: []string{"11.0.0.1:13080", "node1:13080", "[fe80::1]:13080"},
+			denied:  []string{"10.1.2.3:13080", "[fd00::1]:13080"},
+		},
+		{
+			name:    "AllowRack",
+			allow:   []string{"192.168.1.0/24", "node1"},
+			allowed: []string{"192.168.1.7:13080", "node1:13080"},
+			denied:  []string{"192.168.2.7:13080", "node2:13080"},
+		},
+		{
+			name:    "DenyWins",
+			allow:   []string{"192.168.1.0/24"},
+			deny:    []string{"192.168.1.7"},
+			allowed: []string{"192.168.1.8:13080"},
+			denied:  []string{"192.168.1.7:13080"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := NewSourceFilter(tc.allow, tc.deny)
+			require.NoError(t, err)
+			for _, target := range tc.allowed {
+				assert.True(t, filter.Allowed(target), target)
+			}
+			for _, target := range tc.denied {
+				assert.False(t, filter.Allowed(target), target)
+			}
+		})
+	}
+
+	_, err := NewSourceFilter([]string{"10.0.0.0/99"}, nil)
+	assert.Error(t, err)
+}
+
+func TestSourceFilter_Filter(t *testing.T) {
+	filter, err := NewSourceFilter(nil, []string{"b"})
+	require.NoError(t, err)
+	sources := []types.SnapshotSource{{Target: "a:1"}, {Target: "b:1"}, {Target: "c:1"}}
+	filtered := filter.Filter(sources)
+	require.Len(t, filtered, 2)
+	assert.Equal(t, "a:1", filtered[0].Target)
+	assert.Equal(t, "c:1", filtered[1].Target)
+}
@@ -0,0 +1,60 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// NewByteRateLimiter returns a token bucket limiting throughput to the given number of bytes per second.
+//
+// The limiter can be shared by multiple readers to cap their combined throughput.
+func NewByteRateLimiter(bytesPerSec int64) *rate.Limiter {
+	burst := int(bytesPerSec)
+	if burst < 32*1024 {
+		burst = 32 * 1024
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), burst)
+}
+
+// throttledReader delays reads to stay within the rate of a token bucket counting bytes.
+type throttledReader struct {
+	ctx     context.Context
+	rd      io.Reader
+	limiter *rate.Limiter
+}
+
+func newThrottledReader(ctx context.Context, rd io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return rd
+	}
+	return &throttledReader{ctx: ctx, rd: rd, limiter: limiter}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if burst := t.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := t.rd.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,25 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestThrottledReader(t *testing.T) {
+	limiter := rate.NewLimiter(1000, 100)
+	rd := newThrottledReader(context.TODO(), bytes.NewReader(make([]byte, 300)), limiter)
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, rd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(300), n)
+	// First 100 bytes are covered by the burst, the rest takes 200ms.
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
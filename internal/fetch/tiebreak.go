@@ -0,0 +1,128 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// TieBreaker orders sources offering the identical snapshot,
+// so that not every client picks the same one.
+type TieBreaker interface {
+	// Order reorders tied sources in place.
+	Order(tied []types.SnapshotSource)
+}
+
+// NoTieBreak keeps tied sources in the order reported by the tracker.
+type NoTieBreak struct{}
+
+func (NoTieBreak) Order([]types.SnapshotSource) {}
+
+// RandomTieBreak shuffles tied sources.
+type RandomTieBreak struct {
+	Rand *rand.Rand // uses the global source if nil
+}
+
+func (r RandomTieBreak) Order(tied []types.SnapshotSource) {
+	swap := func(i, j int) { tied[i], tied[j] = tied[j], tied[i] }
+	if r.Rand != nil {
+		r.Rand.Shuffle(len(tied), swap)
+	} else {
+		rand.Shuffle(len(tied), swap)
+	}
+}
+
+// HostnameTieBreak rotates tied sources, ordered by target, by a hash of the local hostname.
+// Each host consistently picks the same source, while different hosts spread across sources.
+type HostnameTieBreak struct {
+	Hostname string
+}
+
+func (h HostnameTieBreak) Order(tied []types.SnapshotSource) {
+	if len(tied) < 2 {
+		return
+	}
+	sort.Slice(tied, func(i, j int) bool {
+		return tied[i].Target < tied[j].Target
+	})
+	sum := fnv.New32a()
+	_, _ = sum.Write([]byte(h.Hostname))
+	offset := int(sum.Sum32() % uint32(len(tied)))
+	rotated := append(append([]types.SnapshotSource(nil), tied[offset:]...), tied[:offset]...)
+	copy(tied, rotated)
+}
+
+// BreakTies reorders sources offering the identical snapshot (same slot, base slot and hash)
+// using the given tie breaker. Other snapshots keep their rank.
+func BreakTies(ranked []types.SnapshotSource, tb TieBreaker) []types.SnapshotSource {
+	type snapshotKey struct {
+		slot     uint64
+		baseSlot uint64
+		hash     [32]byte
+	}
+	var keys []snapshotKey
+	positions := make(map[snapshotKey][]int)
+	for i := range ranked {
+		key := snapshotKey{slot: ranked[i].Slot, hash: ranked[i].Hash}
+		if len(ranked[i].Files) > 0 {
+			key.baseSlot = ranked[i].Files[0].BaseSlot
+		}
+		if _, ok := positions[key]; !ok {
+			keys = append(keys, key)
+		}
+		positions[key] = append(positions[key], i)
+	}
+
+	result := make([]types.SnapshotSource, len(ranked))
+	copy(result, ranked)
+	for _, key := range keys {
+		idx := positions[key]
+		if len(idx) < 2 {
+			continue
+		}
+		tied := make([]types.SnapshotSource, len(idx))
+		for i, pos := range idx {
+			tied[i] = ranked[pos]
+		}
+		tb.Order(tied)
+		for i, pos := range idx {
+			result[pos] = tied[i]
+		}
+	}
+	return result
+}
+
+// TieBreakNames lists the names accepted by ParseTieBreak.
+var TieBreakNames = []string{"hostname", "random", "none"}
+
+// ParseTieBreak returns the tie breaker with the given name.
+// The hostname strategy hashes the given hostname.
+func ParseTieBreak(name string, hostname string) (TieBreaker, error) {
+	switch name {
+	case "hostname", "":
+		return HostnameTieBreak{Hostname: hostname}, nil
+	case "random":
+		return RandomTieBreak{}, nil
+	case "none":
+		return NoTieBreak{}, nil
+	default:
+		return nil, fmt.Errorf("unknown tie break strategy %q", name)
+	}
+}
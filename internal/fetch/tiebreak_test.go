@@ -0,0 +1,79 @@
+package fetch
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+func TestBreakTies(t *testing.T) {
+	snap := func(target string, slot uint64) types.SnapshotSource {
+		return types.SnapshotSource{
+			SnapshotInfo: types.SnapshotInfo{
+				Slot:  slot,
+				Hash:  solana.Hash{byte(slot)},
+				Files: []*types.SnapshotFile{{Slot: slot}},
+			},
+			Target: target,
+		}
+	}
+	ranked := []types.SnapshotSource{
+		snap("c", 120),
+		snap("a", 120),
+		snap("b", 120),
+		snap("d", 100),
+		snap("f", 90),
+		snap("e", 90),
+	}
+	targets := func(snaps []types.SnapshotSource) (targets []string) {
+		for _, snap := range snaps {
+			targets = append(targets, snap.Target)
+		}
+		return
+	}
+
+	t.Run("None", func(t *testing.T) {
+		assert.Equal(t, targets(ranked), targets(BreakTies(ranked, NoTieBreak{})))
+	})
+
+	t.Run("Hostname", func(t *testing.T) {
+		first := make(map[string]bool)
+		for _, hostname := range []string{"node-1", "node-2", "node-3", "node-4", "node-5", "node-6"} {
+			result := BreakTies(ranked, HostnameTieBreak{Hostname: hostname})
+			assert.Equal(t, targets(result), targets(BreakTies(ranked, HostnameTieBreak{Hostname: hostname})),
+				"should be deterministic")
+			assert.ElementsMatch(t, []string{"a", "b", "c"}, targets(result[:3]))
+			assert.Equal(t, "d", result[3].Target)
+			assert.ElementsMatch(t, []string{"e", "f"}, targets(result[4:]))
+			first[result[0].Target] = true
+		}
+		assert.Greater(t, len(first), 1, "should spread across sources")
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		result := BreakTies(ranked, RandomTieBreak{Rand: rand.New(rand.NewSource(1))})
+		assert.ElementsMatch(t, []string{"a", "b", "c"}, targets(result[:3]))
+		assert.Equal(t, "d", result[3].Target)
+		assert.Equal(t, []string{"c", "a", "b", "d", "f", "e"}, targets(ranked), "must not modify input")
+	})
+
+	t.Run("DifferentBase", func(t *testing.T) {
+		inc := snap("b", 120)
+		inc.Files = []*types.SnapshotFile{{Slot: 120, BaseSlot: 100}}
+		result := BreakTies([]types.SnapshotSource{snap("a", 120), inc}, HostnameTieBreak{Hostname: "node-1"})
+		assert.Equal(t, []string{"a", "b"}, targets(result))
+	})
+}
+
+func TestParseTieBreak(t *testing.T) {
+	for _, name := range TieBreakNames {
+		_, err := ParseTieBreak(name, "node-1")
+		require.NoError(t, err, name)
+	}
+	_, err := ParseTieBreak("foo", "node-1")
+	assert.EqualError(t, err, `unknown tie break strategy "foo"`)
+}
@@ -0,0 +1,61 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	const snapshotName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	var traceparents atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("traceparent") != "" {
+			traceparents.Inc()
+		}
+		if r.URL.Path == "/v1/best_snapshots" {
+			w.Header().Set("content-type", "application/json")
+			_, _ = w.Write([]byte(`[{"slot":100,"target":"a"}]`))
+			return
+		}
+		http.ServeContent(w, r, snapshotName, time.Time{}, bytes.NewReader([]byte("AAAA")))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	_, err := NewTrackerClient(server.URL).GetBestSnapshots(ctx, -1)
+	require.NoError(t, err)
+	require.NoError(t, NewSidecarClient(server.URL).DownloadSnapshotFile(ctx, t.TempDir(), snapshotName))
+	assert.Equal(t, int32(2), traceparents.Load())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "TrackerClient.GetBestSnapshots", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attribute.Int64("slot", 100))
+	assert.Equal(t, "SidecarClient.DownloadSnapshotFile", spans[1].Name())
+	assert.Contains(t, spans[1].Attributes(), attribute.String("file_name", snapshotName))
+	assert.Contains(t, spans[1].Attributes(), attribute.Int64("slot", 100))
+	assert.Contains(t, spans[1].Attributes(), attribute.Int64("bytes_transferred", 4))
+}
@@ -17,39 +17,315 @@ package fetch
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gagliardetto/solana-go"
 	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/atomic"
 	"gopkg.in/resty.v1"
 )
 
 // TrackerClient accesses the tracker API.
+//
+// If multiple tracker URLs are given, requests fail over to the next tracker on error.
+// The last tracker that responded successfully is tried first on subsequent requests.
 type TrackerClient struct {
-	resty *resty.Client
+	resty     *resty.Client
+	urls      []string
+	lastGood  atomic.Int32
+	transport transportOpts
+	maxAge    time.Duration
+
+	manifestKey []byte
+
+	retries        int
+	retryBaseDelay time.Duration
+}
+
+type TrackerClientOpts struct {
+	Resty *resty.Client
+
+	// DialTimeout caps the time to establish a connection.
+	DialTimeout time.Duration
+	// ResponseHeaderTimeout caps the time from sending a request to receiving the response headers.
+	ResponseHeaderTimeout time.Duration
+	// Timeout caps the total time of a request, including reading the response.
+	Timeout time.Duration
+
+	// Retries is the number of times a failed request is retried, after failing over through all trackers.
+	// Retries stop early once the context deadline would pass.
+	Retries int
+	// RetryBaseDelay is the delay before the first retry, doubling with each attempt.
+	RetryBaseDelay time.Duration
+
+	// ManifestKey is the key manifests must be signed with, if set.
+	ManifestKey []byte
+}
+
+func NewTrackerClient(trackerURLs ...string) *TrackerClient {
+	return NewTrackerClientWithResty(resty.New(), trackerURLs...)
+}
+
+// NewTrackerClientWithResty creates a tracker client using the given resty client.
+// If no tracker URLs are given, the host URL of the resty client is used.
+func NewTrackerClientWithResty(client *resty.Client, trackerURLs ...string) *TrackerClient {
+	return NewTrackerClientWithOpts(TrackerClientOpts{Resty: client}, trackerURLs...)
+}
+
+// NewTrackerClientWithOpts creates a tracker client with the given options.
+// If no tracker URLs are given, the host URL of the resty client is used.
+func NewTrackerClientWithOpts(opts TrackerClientOpts, trackerURLs ...string) *TrackerClient {
+	if opts.Resty == nil {
+		opts.Resty = resty.New()
+	}
+	if opts.Timeout > 0 {
+		opts.Resty.SetTimeout(opts.Timeout)
+	}
+	if opts.RetryBaseDelay <= 0 {
+		opts.RetryBaseDelay = time.Second
+	}
+	urls := make([]string, len(trackerURLs))
+	for i, trackerURL := range trackerURLs {
+		urls[i] = strings.TrimSuffix(trackerURL, "/")
+	}
+	c := &TrackerClient{
+		resty: opts.Resty,
+		urls:  urls,
+		transport: transportOpts{
+			dialTimeout:           opts.DialTimeout,
+			responseHeaderTimeout: opts.ResponseHeaderTimeout,
+		},
+		manifestKey:    opts.ManifestKey,
+		retries:        opts.Retries,
+		retryBaseDelay: opts.RetryBaseDelay,
+	}
+	if c.transport != (transportOpts{}) {
+		c.resty.SetTransport(newTransport(c.transport))
+	}
+	return c
+}
+
+// SetTLSConfig sets the TLS config used for HTTPS connections, e.g. to present a client certificate.
+func (c *TrackerClient) SetTLSConfig(config *tls.Config) *TrackerClient {
+	c.transport.tlsConfig = config
+	c.resty.SetTransport(newTransport(c.transport))
+	return c
+}
+
+// SetAuthToken sends the given bearer token with every request.
+func (c *TrackerClient) SetAuthToken(token string) *TrackerClient {
+	c.resty.SetAuthToken(token)
+	return c
+}
+
+// SetMaxAge asks the tracker to skip snapshots it hasn't seen in a scrape within the given duration.
+func (c *TrackerClient) SetMaxAge(maxAge time.Duration) *TrackerClient {
+	c.maxAge = maxAge
+	return c
 }
 
-func NewTrackerClient(trackerURL string) *TrackerClient {
-	return NewTrackerClientWithResty(resty.New().SetHostURL(trackerURL))
+// GetBestSnapshots returns up to count of the best snapshots known to the tracker, best first.
+// The tracker caps the count, -1 returns as many as it allows.
+// Cancelling ctx aborts the pending HTTP request.
+func (c *TrackerClient) GetBestSnapshots(ctx context.Context, count int) ([]types.SnapshotSource, error) {
+	return c.getBestSnapshots(ctx, map[string]string{
+		"max": strconv.Itoa(count),
+	})
 }
 
-func NewTrackerClientWithResty(client *resty.Client) *TrackerClient {
-	return &TrackerClient{resty: client}
+// GetBestSnapshotsInRange is like GetBestSnapshots,
+// but only returns snapshots with a slot number between minSlot and maxSlot (inclusive).
+// Returns an empty list if no snapshot is in range.
+func (c *TrackerClient) GetBestSnapshotsInRange(ctx context.Context, count int, minSlot, maxSlot uint64) ([]types.SnapshotSource, error) {
+	return c.getBestSnapshots(ctx, map[string]string{
+		"max":      strconv.Itoa(count),
+		"min_slot": strconv.FormatUint(minSlot, 10),
+		"max_slot": strconv.FormatUint(maxSlot, 10),
+	})
 }
 
-func (c *TrackerClient) GetBestSnapshots(ctx context.Context, count int) (sources []types.SnapshotSource, err error) {
-	res, err := c.resty.R().
-		SetContext(ctx).
-		SetHeader("accept", "application/json").
-		SetQueryParam("max", strconv.Itoa(count)).
-		SetResult(&sources).
-		Get("/v1/best_snapshots")
-	if err != nil {
-		return nil, err
+// GetSnapshotsForBase returns the incremental snapshots based on the full snapshot at baseSlot, best first.
+// Returns an empty list if there are none.
+func (c *TrackerClient) GetSnapshotsForBase(ctx context.Context, baseSlot uint64) ([]types.SnapshotSource, error) {
+	return c.getBestSnapshots(ctx, map[string]string{
+		"max":       "-1",
+		"base_slot": strconv.FormatUint(baseSlot, 10),
+	})
+}
+
+func (c *TrackerClient) getBestSnapshots(ctx context.Context, params map[string]string) (sources []types.SnapshotSource, err error) {
+	ctx, span := tracer.Start(ctx, "TrackerClient.GetBestSnapshots")
+	defer func() {
+		span.SetAttributes(attribute.Int("num_snapshots", len(sources)))
+		if len(sources) > 0 {
+			span.SetAttributes(attribute.Int64("slot", int64(sources[0].Slot)))
+		}
+		endSpan(span, err)
+	}()
+	header := make(http.Header)
+	setRequestHeaders(ctx, header)
+	if c.maxAge > 0 {
+		params["max_age"] = c.maxAge.String()
+	}
+
+	err = c.retry(ctx, func(baseURL string) error {
+		res, err := c.resty.R().
+			SetContext(ctx).
+			SetHeaders(flattenHeader(header)).
+			SetHeader("accept", "application/json").
+			SetQueryParams(params).
+			SetResult(&sources).
+			Get(baseURL + "/v1/best_snapshots")
+		if err != nil {
+			return decodeError(err)
+		}
+		return expectOK(res.RawResponse, "get best snapshots")
+	})
+	if err != nil && ctx.Err() == nil && isRetryable(err) {
+		err = withKind(ErrTrackerUnavailable, err)
+	}
+	return
+}
+
+// GetManifest returns the manifest of all snapshots known to the tracker.
+// Returns nil if the manifest is still at generation sinceGen, 0 always returns the manifest.
+// If a manifest key is set, manifests without a valid signature are rejected.
+func (c *TrackerClient) GetManifest(ctx context.Context, sinceGen uint64) (manifest *types.Manifest, err error) {
+	ctx, span := tracer.Start(ctx, "TrackerClient.GetManifest")
+	defer func() {
+		span.SetAttributes(attribute.Bool("changed", manifest != nil))
+		endSpan(span, err)
+	}()
+	header := make(http.Header)
+	setRequestHeaders(ctx, header)
+
+	err = c.retry(ctx, func(baseURL string) error {
+		manifest = nil
+		result := new(types.Manifest)
+		req := c.resty.R().
+			SetContext(ctx).
+			SetHeaders(flattenHeader(header)).
+			SetHeader("accept", "application/json").
+			SetResult(result)
+		if sinceGen != 0 {
+			req.SetQueryParam("since", strconv.FormatUint(sinceGen, 10))
+		}
+		res, err := req.Get(baseURL + "/v1/manifest")
+		if err != nil {
+			return decodeError(err)
+		}
+		if res.StatusCode() == http.StatusNotModified {
+			return nil
+		}
+		if err := expectOK(res.RawResponse, "get manifest"); err != nil {
+			return err
+		}
+		if c.manifestKey != nil {
+			if err := result.Verify(c.manifestKey); err != nil {
+				return withKind(ErrBadResponse, err)
+			}
+		}
+		manifest = result
+		return nil
+	})
+	if err != nil && ctx.Err() == nil && isRetryable(err) {
+		err = withKind(ErrTrackerUnavailable, err)
+	}
+	return
+}
+
+// GetSources returns the targets of all sources currently offering the snapshot with the given slot and hash.
+// Unlike GetBestSnapshots, the number of sources is not capped.
+// Returns an empty list if no source offers the snapshot.
+func (c *TrackerClient) GetSources(ctx context.Context, slot uint64, hash solana.Hash) (targets []string, err error) {
+	ctx, span := tracer.Start(ctx, "TrackerClient.GetSources")
+	defer func() {
+		span.SetAttributes(
+			attribute.Int64("slot", int64(slot)),
+			attribute.Int("num_sources", len(targets)))
+		endSpan(span, err)
+	}()
+	header := make(http.Header)
+	setRequestHeaders(ctx, header)
+	params := map[string]string{
+		"slot": strconv.FormatUint(slot, 10),
+		"hash": hash.String(),
 	}
-	if res.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("get best snapshots: %s", res.Status())
+	if c.maxAge > 0 {
+		params["max_age"] = c.maxAge.String()
+	}
+
+	err = c.retry(ctx, func(baseURL string) error {
+		targets = nil
+		res, err := c.resty.R().
+			SetContext(ctx).
+			SetHeaders(flattenHeader(header)).
+			SetHeader("accept", "application/json").
+			SetQueryParams(params).
+			SetResult(&targets).
+			Get(baseURL + "/v1/sources")
+		if err != nil {
+			return decodeError(err)
+		}
+		return expectOK(res.RawResponse, "get sources")
+	})
+	if err != nil && ctx.Err() == nil && isRetryable(err) {
+		err = withKind(ErrTrackerUnavailable, err)
 	}
 	return
 }
+
+// retry runs the request with failover, retrying with exponential backoff on transient errors.
+func (c *TrackerClient) retry(ctx context.Context, do func(baseURL string) error) error {
+	for attempt := 0; ; attempt++ {
+		err := c.failover(ctx, do)
+		if err == nil || attempt >= c.retries || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+		delay := retryDelay(c.retryBaseDelay, attempt, err)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// failover runs the request against each tracker, starting with the last good one, until one succeeds.
+func (c *TrackerClient) failover(ctx context.Context, do func(baseURL string) error) error {
+	if len(c.urls) == 0 {
+		return do("")
+	}
+	start := int(c.lastGood.Load())
+	var err error
+	for i := range c.urls {
+		index := (start + i) % len(c.urls)
+		if err = do(c.urls[index]); err == nil {
+			c.lastGood.Store(int32(index))
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	if len(c.urls) > 1 {
+		return fmt.Errorf("all %d trackers failed, last error: %w", len(c.urls), err)
+	}
+	return err
+}
+
+// flattenHeader converts HTTP headers to the format used by resty.
+func flattenHeader(header http.Header) map[string]string {
+	flat := make(map[string]string, len(header))
+	for key := range header {
+		flat[key] = header.Get(key)
+	}
+	return flat
+}
@@ -0,0 +1,196 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/atomic"
+)
+
+func TestTrackerClient_Failover(t *testing.T) {
+	var brokenHits, workingHits atomic.Int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		brokenHits.Inc()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		workingHits.Inc()
+		assert.Equal(t, "/v1/best_snapshots", r.URL.Path)
+		w.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(w).Encode([]types.SnapshotSource{{Target: "node1"}})
+	}))
+	defer working.Close()
+
+	client := NewTrackerClient(broken.URL, working.URL)
+
+	sources, err := client.GetBestSnapshots(context.TODO(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, []types.SnapshotSource{{Target: "node1"}}, sources)
+	assert.Equal(t, int32(1), brokenHits.Load())
+	assert.Equal(t, int32(1), workingHits.Load())
+
+	// Last good tracker is remembered.
+	_, err = client.GetBestSnapshots(context.TODO(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), brokenHits.Load())
+	assert.Equal(t, int32(2), workingHits.Load())
+
+	// Fails if all trackers are down.
+	working.Close()
+	_, err = client.GetBestSnapshots(context.TODO(), 1)
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), brokenHits.Load())
+}
+
+func TestTrackerClient_SetAuthToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	client := NewTrackerClient(server.URL)
+	_, err := client.GetBestSnapshots(context.TODO(), 1)
+	assert.EqualError(t, err, "get best snapshots: 401 Unauthorized")
+
+	client.SetAuthToken("secret")
+	_, err = client.GetBestSnapshots(context.TODO(), 1)
+	assert.NoError(t, err)
+}
+
+func TestTrackerClient_GetBestSnapshots_Deadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	client := NewTrackerClient(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetBestSnapshots(ctx, -1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestTrackerClient_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	client := NewTrackerClientWithOpts(TrackerClientOpts{Timeout: 50 * time.Millisecond}, server.URL)
+
+	start := time.Now()
+	_, err := client.GetBestSnapshots(context.TODO(), -1)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestTrackerClient_Retry(t *testing.T) {
+	// flaky fails with the given status until it has been hit failures times.
+	flaky := func(status int, failures int32, hits *atomic.Int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			if hits.Inc() <= failures {
+				w.WriteHeader(status)
+				return
+			}
+			w.Header().Set("content-type", "application/json")
+			_ = json.NewEncoder(w).Encode([]types.SnapshotSource{{Target: "node1"}})
+		}))
+	}
+	opts := TrackerClientOpts{Retries: 3, RetryBaseDelay: time.Millisecond}
+
+	t.Run("Transient", func(t *testing.T) {
+		var hits atomic.Int32
+		server := flaky(http.StatusServiceUnavailable, 2, &hits)
+		defer server.Close()
+		sources, err := NewTrackerClientWithOpts(opts, server.URL).GetBestSnapshots(context.TODO(), -1)
+		require.NoError(t, err)
+		assert.Len(t, sources, 1)
+		assert.Equal(t, int32(3), hits.Load())
+	})
+	t.Run("TooManyRequests", func(t *testing.T) {
+		var hits atomic.Int32
+		server := flaky(http.StatusTooManyRequests, 1, &hits)
+		defer server.Close()
+		_, err := NewTrackerClientWithOpts(opts, server.URL).GetBestSnapshots(context.TODO(), -1)
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), hits.Load())
+	})
+	t.Run("Exhausted", func(t *testing.T) {
+		var hits atomic.Int32
+		server := flaky(http.StatusBadGateway, 10, &hits)
+		defer server.Close()
+		_, err := NewTrackerClientWithOpts(opts, server.URL).GetBestSnapshots(context.TODO(), -1)
+		assert.EqualError(t, err, "get best snapshots: 502 Bad Gateway")
+		assert.ErrorIs(t, err, ErrTrackerUnavailable)
+		assert.Equal(t, int32(4), hits.Load())
+	})
+	t.Run("NotRetryable", func(t *testing.T) {
+		var hits atomic.Int32
+		server := flaky(http.StatusBadRequest, 10, &hits)
+		defer server.Close()
+		_, err := NewTrackerClientWithOpts(opts, server.URL).GetBestSnapshots(context.TODO(), -1)
+		assert.EqualError(t, err, "get best snapshots: 400 Bad Request")
+		assert.NotErrorIs(t, err, ErrTrackerUnavailable)
+		assert.Equal(t, int32(1), hits.Load())
+	})
+	t.Run("Deadline", func(t *testing.T) {
+		var hits atomic.Int32
+		server := flaky(http.StatusBadGateway, 10, &hits)
+		defer server.Close()
+		client := NewTrackerClientWithOpts(TrackerClientOpts{Retries: 3, RetryBaseDelay: time.Minute}, server.URL)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		start := time.Now()
+		_, err := client.GetBestSnapshots(ctx, -1)
+		assert.EqualError(t, err, "get best snapshots: 502 Bad Gateway")
+		assert.Equal(t, int32(1), hits.Load())
+		assert.Less(t, time.Since(start), 500*time.Millisecond, "gives up without waiting for the deadline")
+	})
+}
+
+func TestTrackerClient_ErrorKinds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte(`{"not": "a list"}`))
+	}))
+	defer server.Close()
+	client := NewTrackerClientWithOpts(TrackerClientOpts{Retries: 3, RetryBaseDelay: time.Millisecond}, server.URL)
+
+	_, err := client.GetBestSnapshots(context.TODO(), -1)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+	var statusErr *StatusError
+	assert.ErrorAs(t, err, &statusErr)
+
+	client.SetAuthToken("token")
+	_, err = client.GetBestSnapshots(context.TODO(), -1)
+	assert.ErrorIs(t, err, ErrBadResponse)
+	assert.NotErrorIs(t, err, ErrTrackerUnavailable)
+
+	server.Close()
+	_, err = client.GetBestSnapshots(context.TODO(), -1)
+	assert.ErrorIs(t, err, ErrTrackerUnavailable)
+}
@@ -0,0 +1,95 @@
+package fetch
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+func TestVerifySnapshotFile(t *testing.T) {
+	archive := fakeSnapshotArchive(t, "version", "snapshots/100/100", "accounts/100.1")
+
+	cases := []struct {
+		name     string
+		contents []byte
+		expected types.SnapshotFile
+		ok       bool
+	}{
+		{
+			name:     "Valid",
+			contents: archive,
+			expected: types.SnapshotFile{Slot: 100, Ext: ".tar.gz", Size: uint64(len(archive))},
+			ok:       true,
+		},
+		{
+			name:     "UnknownSize",
+			contents: archive,
+			expected: types.SnapshotFile{Slot: 100, Ext: ".tar.gz"},
+			ok:       true,
+		},
+		{
+			name:     "WrongSize",
+			contents: archive,
+			expected: types.SnapshotFile{Slot: 100, Ext: ".tar.gz", Size: uint64(len(archive)) + 1},
+		},
+		{
+			name:     "WrongSlot",
+			contents: archive,
+			expected: types.SnapshotFile{Slot: 101, Ext: ".tar.gz"},
+		},
+		{
+			name:     "Truncated",
+			contents: archive[:len(archive)/2],
+			expected: types.SnapshotFile{Slot: 100, Ext: ".tar.gz"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+			require.NoError(t, os.WriteFile(filePath, tc.contents, 0666))
+			err := VerifySnapshotFile(filePath, &tc.expected)
+			if tc.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrHashMismatch)
+			}
+		})
+	}
+}
+
+func TestVerifySnapshotFile_UnsupportedCompression(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "snapshot.tar.xz")
+	require.NoError(t, os.WriteFile(filePath, []byte("opaque"), 0666))
+
+	err := VerifySnapshotFile(filePath, &types.SnapshotFile{Slot: 100, Ext: ".tar.xz", Size: 6})
+	assert.ErrorIs(t, err, ErrUnsupportedCompression)
+	err = VerifySnapshotFile(filePath, &types.SnapshotFile{Slot: 100, Ext: ".tar.xz", Size: 7})
+	assert.ErrorIs(t, err, ErrHashMismatch, "size is checked regardless")
+}
+
+// fakeSnapshotArchive creates a .tar.gz archive containing empty files.
+func fakeSnapshotArchive(t *testing.T, names ...string) []byte {
+	var buf bytes.Buffer
+	gzipWr := gzip.NewWriter(&buf)
+	tarWr := tar.NewWriter(gzipWr)
+	for _, name := range names {
+		require.NoError(t, tarWr.WriteHeader(&tar.Header{
+			Name: name,
+			Mode: 0644,
+			Size: 64,
+		}))
+		_, err := tarWr.Write(make([]byte, 64))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWr.Close())
+	require.NoError(t, gzipWr.Close())
+	return buf.Bytes()
+}
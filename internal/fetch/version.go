@@ -0,0 +1,65 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetch
+
+import (
+	"strconv"
+	"strings"
+
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// CompareVersions compares two dotted version numbers like "1.10.32".
+// Returns -1 if a < b, 0 if a == b, and +1 if a > b.
+// Non-numeric suffixes like "-rc1" are ignored.
+func CompareVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var x, y uint64
+		if i < len(aParts) {
+			x = parseVersionPart(aParts[i])
+		}
+		if i < len(bParts) {
+			y = parseVersionPart(bParts[i])
+		}
+		if x < y {
+			return -1
+		} else if x > y {
+			return +1
+		}
+	}
+	return 0
+}
+
+func parseVersionPart(part string) uint64 {
+	end := 0
+	for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.ParseUint(part[:end], 10, 64)
+	return n
+}
+
+// HasMinVersion returns whether all files of a snapshot were served by a node running at least minVersion.
+// Files with unknown version do not qualify.
+func HasMinVersion(snap *types.SnapshotInfo, minVersion string) bool {
+	for _, file := range snap.Files {
+		if file.Version == "" || CompareVersions(file.Version, minVersion) < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package fetch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		res  int
+	}{
+		{"1.10.32", "1.10.32", 0},
+		{"1.10.32", "1.10.31", +1},
+		{"1.9.29", "1.10.0", -1},
+		{"1.10", "1.10.0", 0},
+		{"1.10.1", "1.10", +1},
+		{"1.14.0-rc1", "1.14.0", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.a+"_"+tc.b, func(t *testing.T) {
+			assert.Equal(t, tc.res, CompareVersions(tc.a, tc.b))
+		})
+	}
+}
+
+func TestHasMinVersion(t *testing.T) {
+	snap := &types.SnapshotInfo{
+		Files: []*types.SnapshotFile{
+			{Version: "1.10.32"},
+			{Version: "1.10.30"},
+		},
+	}
+	assert.True(t, HasMinVersion(snap, "1.10.30"))
+	assert.False(t, HasMinVersion(snap, "1.10.31"))
+
+	snap.Files[1].Version = ""
+	assert.False(t, HasMinVersion(snap, "1.0.0"))
+}
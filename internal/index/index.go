@@ -16,13 +16,26 @@
 package index
 
 import (
+	"math"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-memdb"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
 )
 
 type DB struct {
-	DB *memdb.MemDB
+	DB  *memdb.MemDB // modified only through DB methods, which keep the sorted view current
+	Log *zap.Logger
+
+	store *bolt.DB // optional persistence
+
+	sortedLock  sync.RWMutex
+	sorted      []*SnapshotEntry // all entries best first, shared by queries
+	sortedValid bool             // false if sorted needs to be rebuilt after a change
 }
 
 // NewDB creates a new, empty in-memory database.
@@ -32,7 +45,8 @@ func NewDB() *DB {
 		panic("failed to create memDB: " + err.Error()) // unreachable
 	}
 	return &DB{
-		DB: db,
+		DB:  db,
+		Log: zap.NewNop(),
 	}
 }
 
@@ -48,6 +62,8 @@ func (d *DB) UpsertSnapshots(entries ...*SnapshotEntry) {
 		insertSnapshotEntry(txn, entry)
 	}
 	txn.Commit()
+	d.invalidateSorted()
+	d.persistUpsert(entries)
 }
 
 // GetSnapshotsByTarget returns all snapshots served by a host
@@ -87,18 +103,92 @@ func (d *DB) GetAllSnapshots() (entries []*SnapshotEntry) {
 // The `max` argument controls the max number of snapshots to return.
 // If max is negative, it returns all snapshots.
 func (d *DB) GetBestSnapshots(max int) (entries []*SnapshotEntry) {
+	return d.GetBestSnapshotsInRange(max, 0, math.MaxUint64)
+}
+
+// GetBestSnapshotsInRange is like GetBestSnapshots,
+// but only returns snapshots with a slot number between minSlot and maxSlot (inclusive).
+func (d *DB) GetBestSnapshotsInRange(max int, minSlot, maxSlot uint64) (entries []*SnapshotEntry) {
+	return d.QueryBestSnapshots(BestSnapshotsQuery{Max: max, MinSlot: minSlot, MaxSlot: maxSlot})
+}
+
+// BestSnapshotsQuery selects snapshots returned by QueryBestSnapshots.
+type BestSnapshotsQuery struct {
+	Max          int       // max number of snapshots, negative for all
+	MinSlot      uint64    // lowest slot number (inclusive)
+	MaxSlot      uint64    // highest slot number (inclusive)
+	UpdatedAfter time.Time // if set, skip snapshots not seen since
+	BaseSlot     uint64    // if set, only incremental snapshots based on the full snapshot at this slot
+}
+
+// QueryBestSnapshots returns the best snapshots matching the query, best first.
+//
+// Queries read a cached view of all entries in slot order, which is rebuilt on the first query after a change.
+// The view is never modified in place, so concurrent queries share it without copying.
+func (d *DB) QueryBestSnapshots(query BestSnapshotsQuery) (entries []*SnapshotEntry) {
+	sorted := d.sortedSnapshots()
+	// Skip entries newer than the range.
+	start := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i].Slot() <= query.MaxSlot
+	})
+	for _, entry := range sorted[start:] {
+		if query.Max >= 0 && len(entries) >= query.Max {
+			break
+		}
+		if entry.Slot() < query.MinSlot {
+			break
+		}
+		// Incremental snapshots are always newer than their base.
+		if query.BaseSlot != 0 && entry.Slot() <= query.BaseSlot {
+			break
+		}
+		if !query.UpdatedAfter.IsZero() && !entry.UpdatedAt.After(query.UpdatedAfter) {
+			continue
+		}
+		if query.BaseSlot != 0 && !isBasedOn(entry.Info, query.BaseSlot) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// sortedSnapshots returns all entries best first, rebuilding the cached view if the index changed.
+func (d *DB) sortedSnapshots() []*SnapshotEntry {
+	d.sortedLock.RLock()
+	sorted, valid := d.sorted, d.sortedValid
+	d.sortedLock.RUnlock()
+	if valid {
+		return sorted
+	}
+
+	d.sortedLock.Lock()
+	defer d.sortedLock.Unlock()
+	if d.sortedValid {
+		return d.sorted // rebuilt by a concurrent query
+	}
 	res, err := d.DB.Txn(false).Get(tableSnapshotEntry, "slot")
 	if err != nil {
 		panic("getting best snapshots failed: " + err.Error())
 	}
-	for max < 0 || len(entries) <= max {
-		entry := res.Next()
-		if entry == nil {
-			break
-		}
-		entries = append(entries, entry.(*SnapshotEntry))
+	sorted = make([]*SnapshotEntry, 0, len(d.sorted))
+	for obj := res.Next(); obj != nil; obj = res.Next() {
+		sorted = append(sorted, obj.(*SnapshotEntry))
 	}
-	return
+	d.sorted, d.sortedValid = sorted, true
+	return sorted
+}
+
+// invalidateSorted marks the cached view stale after a change to the index.
+func (d *DB) invalidateSorted() {
+	d.sortedLock.Lock()
+	d.sortedValid = false
+	d.sortedLock.Unlock()
+}
+
+// isBasedOn returns whether info is an incremental snapshot based on the full snapshot at baseSlot.
+func isBasedOn(info *types.SnapshotInfo, baseSlot uint64) bool {
+	return info != nil && len(info.Files) > 0 && info.Files[0].BaseSlot == baseSlot
 }
 
 // DeleteOldSnapshots delete snapshot entry older than the given timestamp.
@@ -109,6 +199,7 @@ func (d *DB) DeleteOldSnapshots(minTime time.Time) (n int) {
 	if err != nil {
 		panic("failed to range over all snapshots: " + err.Error())
 	}
+	var deleted []SnapshotKey
 	for {
 		entry := res.Next()
 		if entry == nil {
@@ -118,10 +209,13 @@ func (d *DB) DeleteOldSnapshots(minTime time.Time) (n int) {
 			if err := txn.Delete(tableSnapshotEntry, entry); err != nil {
 				panic("failed to delete expired snapshot: " + err.Error())
 			}
+			deleted = append(deleted, entry.(*SnapshotEntry).SnapshotKey)
 			n++
 		}
 	}
 	txn.Commit()
+	d.invalidateSorted()
+	d.persistDelete(deleted)
 	return
 }
 
@@ -135,6 +229,8 @@ func (d *DB) DeleteSnapshotsByTarget(target string) int {
 		panic("failed to delete snapshots by target: " + err.Error())
 	}
 	txn.Commit()
+	d.invalidateSorted()
+	d.persistDeleteTarget(target)
 	return n
 }
 
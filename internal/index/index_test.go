@@ -15,11 +15,16 @@
 package index
 
 import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.blockdaemon.com/solana/cluster-manager/types"
 )
 
@@ -93,6 +98,35 @@ func TestDB(t *testing.T) {
 			snapshotEntry2,
 		},
 		db.GetBestSnapshots(-1))
+	assert.Equal(t,
+		[]*SnapshotEntry{
+			snapshotEntry1,
+			snapshotEntry3,
+		},
+		db.GetBestSnapshots(2))
+	assert.Len(t, db.GetBestSnapshots(0), 0)
+	assert.Equal(t,
+		[]*SnapshotEntry{
+			snapshotEntry2,
+		},
+		db.GetBestSnapshotsInRange(-1, 0, 99))
+	assert.Equal(t,
+		[]*SnapshotEntry{
+			snapshotEntry1,
+			snapshotEntry3,
+		},
+		db.GetBestSnapshotsInRange(-1, 100, 200))
+	assert.Len(t, db.GetBestSnapshotsInRange(-1, 101, 200), 0)
+	assert.Equal(t,
+		[]*SnapshotEntry{
+			snapshotEntry1,
+			snapshotEntry3,
+		},
+		db.QueryBestSnapshots(BestSnapshotsQuery{
+			Max:          -1,
+			MaxSlot:      200,
+			UpdatedAfter: snapshotEntry2.UpdatedAt,
+		}))
 
 	assert.Equal(t, 2, db.DeleteSnapshotsByTarget("host1"))
 	assert.Len(t, db.GetSnapshotsByTarget("host1"), 0)
@@ -115,3 +149,99 @@ func TestDB(t *testing.T) {
 		},
 		db.GetBestSnapshots(-1))
 }
+
+func TestDB_QueryBestSnapshots_BaseSlot(t *testing.T) {
+	db := NewDB()
+	incremental := func(target string, slot, baseSlot uint64) *SnapshotEntry {
+		return &SnapshotEntry{
+			SnapshotKey: NewSnapshotKey(target, slot),
+			UpdatedAt:   dummyTime1,
+			Info: &types.SnapshotInfo{
+				Slot:  slot,
+				Files: []*types.SnapshotFile{{Slot: slot, BaseSlot: baseSlot}},
+			},
+		}
+	}
+	entry1 := incremental("host1", 150, 100)
+	entry2 := incremental("host2", 140, 100)
+	entry3 := incremental("host3", 250, 200)
+	db.UpsertSnapshots(snapshotEntry1, entry1, entry2, entry3)
+
+	assert.Equal(t,
+		[]*SnapshotEntry{entry1, entry2},
+		db.QueryBestSnapshots(BestSnapshotsQuery{Max: -1, MaxSlot: math.MaxUint64, BaseSlot: 100}))
+	assert.Equal(t,
+		[]*SnapshotEntry{entry3},
+		db.QueryBestSnapshots(BestSnapshotsQuery{Max: -1, MaxSlot: math.MaxUint64, BaseSlot: 200}))
+	assert.Len(t, db.QueryBestSnapshots(BestSnapshotsQuery{Max: -1, MaxSlot: math.MaxUint64, BaseSlot: 300}), 0)
+}
+
+func TestDB_QueryBestSnapshots_Concurrent(t *testing.T) {
+	db := NewDB()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for slot := uint64(1); slot <= 100; slot++ {
+			db.UpsertSnapshots(&SnapshotEntry{
+				SnapshotKey: NewSnapshotKey("host1", slot),
+				UpdatedAt:   dummyTime1,
+				Info:        &types.SnapshotInfo{Slot: slot},
+			})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			entries := db.GetBestSnapshots(-1)
+			assert.True(t, sort.SliceIsSorted(entries, func(i, j int) bool {
+				return entries[i].Slot() > entries[j].Slot()
+			}))
+		}
+	}()
+	wg.Wait()
+
+	entries := db.GetBestSnapshots(2)
+	require.Len(t, entries, 2)
+	assert.Equal(t, uint64(100), entries[0].Slot())
+	assert.Equal(t, uint64(99), entries[1].Slot())
+}
+
+// BenchmarkDB_GetBestSnapshots compares sorting all snapshots per request
+// against reading the best ones from the cached view, with concurrent requests.
+func BenchmarkDB_GetBestSnapshots(b *testing.B) {
+	const numTargets = 1000
+	db := NewDB()
+	for i := 0; i < numTargets; i++ {
+		target := fmt.Sprintf("host%d", i)
+		var entries []*SnapshotEntry
+		for j := uint64(0); j < 4; j++ {
+			slot := 1000 + uint64(i)*4 + j
+			entries = append(entries, &SnapshotEntry{
+				SnapshotKey: NewSnapshotKey(target, slot),
+				UpdatedAt:   dummyTime1,
+				Info:        &types.SnapshotInfo{Slot: slot},
+			})
+		}
+		db.UpsertSnapshots(entries...)
+	}
+
+	b.Run("Sort", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				entries := db.GetAllSnapshots()
+				sort.Slice(entries, func(i, j int) bool {
+					return entries[i].Slot() > entries[j].Slot()
+				})
+				_ = entries[:10]
+			}
+		})
+	})
+	b.Run("Cached", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_ = db.GetBestSnapshots(10)
+			}
+		})
+	})
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+var bucketSnapshots = []byte("snapshots")
+
+// OpenDB creates an in-memory database backed by a BoltDB file at the given path.
+//
+// Entries persisted by a previous run get loaded into memory,
+// except those older than maxAge, which are deleted.
+// Changes are written through to the file.
+func OpenDB(path string, maxAge time.Duration) (*DB, error) {
+	store, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index file: %w", err)
+	}
+	d := NewDB()
+	d.store = store
+	if err := d.load(time.Now().Add(-maxAge)); err != nil {
+		_ = store.Close()
+		return nil, fmt.Errorf("failed to load index file: %w", err)
+	}
+	return d, nil
+}
+
+// Close closes the backing file, if any.
+func (d *DB) Close() error {
+	if d.store == nil {
+		return nil
+	}
+	return d.store.Close()
+}
+
+func (d *DB) load(minTime time.Time) error {
+	var entries []*SnapshotEntry
+	err := d.store.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(bucketSnapshots)
+		if err != nil {
+			return err
+		}
+		var staleKeys [][]byte
+		err = bucket.ForEach(func(key, value []byte) error {
+			entry := new(SnapshotEntry)
+			if err := json.Unmarshal(value, entry); err != nil {
+				return fmt.Errorf("invalid entry %q: %w", key, err)
+			}
+			if entry.UpdatedAt.Before(minTime) {
+				staleKeys = append(staleKeys, key)
+			} else {
+				entries = append(entries, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range staleKeys {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	txn := d.DB.Txn(true)
+	defer txn.Abort()
+	for _, entry := range entries {
+		insertSnapshotEntry(txn, entry)
+	}
+	txn.Commit()
+	d.invalidateSorted()
+	return nil
+}
+
+// persistKey returns the BoltDB key of an entry.
+// Keys of the same target share a common prefix.
+func persistKey(target string, slot uint64) []byte {
+	key := append(persistPrefix(target), make([]byte, 8)...)
+	binary.BigEndian.PutUint64(key[len(key)-8:], slot)
+	return key
+}
+
+func persistPrefix(target string) []byte {
+	return append([]byte(target), 0)
+}
+
+// persistUpsert writes entries to the backing file.
+func (d *DB) persistUpsert(entries []*SnapshotEntry) {
+	if d.store == nil {
+		return
+	}
+	err := d.store.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketSnapshots)
+		for _, entry := range entries {
+			value, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(persistKey(entry.Target, entry.Slot()), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		d.Log.Error("Failed to persist snapshot entries", zap.Error(err))
+	}
+}
+
+// persistDelete deletes entries from the backing file.
+func (d *DB) persistDelete(keys []SnapshotKey) {
+	if d.store == nil || len(keys) == 0 {
+		return
+	}
+	err := d.store.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketSnapshots)
+		for _, key := range keys {
+			if err := bucket.Delete(persistKey(key.Target, key.Slot())); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		d.Log.Error("Failed to delete persisted snapshot entries", zap.Error(err))
+	}
+}
+
+// persistDeleteTarget deletes all entries of a target from the backing file.
+func (d *DB) persistDeleteTarget(target string) {
+	if d.store == nil {
+		return
+	}
+	prefix := persistPrefix(target)
+	err := d.store.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketSnapshots)
+		var keys [][]byte
+		cursor := bucket.Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			keys = append(keys, append([]byte(nil), key...))
+		}
+		for _, key := range keys {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		d.Log.Error("Failed to delete persisted snapshot entries", zap.Error(err))
+	}
+}
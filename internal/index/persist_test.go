@@ -0,0 +1,58 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenDB(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+	maxAge := time.Since(dummyTime1) + time.Minute
+
+	db, err := OpenDB(dbPath, maxAge)
+	require.NoError(t, err)
+	db.UpsertSnapshots(snapshotEntry1, snapshotEntry2, snapshotEntry3)
+	assert.Equal(t, 1, db.DeleteSnapshotsByTarget("host2"))
+	require.NoError(t, db.Close())
+
+	// Entries survive restart.
+	db, err = OpenDB(dbPath, maxAge)
+	require.NoError(t, err)
+	assert.Equal(t,
+		[]*SnapshotEntry{
+			snapshotEntry1,
+			snapshotEntry2,
+		},
+		db.GetBestSnapshots(-1))
+	assert.Equal(t, 1, db.DeleteOldSnapshots(snapshotEntry2.UpdatedAt.Add(time.Second)))
+	require.NoError(t, db.Close())
+
+	db, err = OpenDB(dbPath, maxAge)
+	require.NoError(t, err)
+	assert.Equal(t, []*SnapshotEntry{snapshotEntry1}, db.GetBestSnapshots(-1))
+	require.NoError(t, db.Close())
+
+	// Stale entries are pruned on load.
+	db, err = OpenDB(dbPath, time.Second)
+	require.NoError(t, err)
+	assert.Len(t, db.GetBestSnapshots(-1), 0)
+	require.NoError(t, db.Close())
+}
@@ -24,6 +24,7 @@ type SnapshotEntry struct {
 	SnapshotKey
 	Info      *types.SnapshotInfo `json:"info"`
 	UpdatedAt time.Time           `json:"updated_at"`
+	Node      *types.NodeStatus   `json:"node,omitempty"` // status of the serving node at UpdatedAt, if known
 }
 
 type SnapshotKey struct {
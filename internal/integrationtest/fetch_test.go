@@ -0,0 +1,74 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package integrationtest
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/internal/fetch"
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledgertest"
+	"go.blockdaemon.com/solana/cluster-manager/internal/sidecar"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/zap/zaptest"
+	"gopkg.in/resty.v1"
+)
+
+// TestFetchIncremental downloads an incremental snapshot
+// together with the full snapshot it is based on.
+func TestFetchIncremental(t *testing.T) {
+	const fullName = "snapshot-100-7jMmeXZSNcWPrB2RsTdeXfXrsyW5c1BfPjqoLW2X5T7V.tar.bz2"
+	const incName = "incremental-snapshot-100-200-7jMmeXZSNcWPrB2RsTdeXfXrsyW5c1BfPjqoLW2X5T7V.tar.bz2"
+
+	root := ledgertest.NewFS(t)
+	root.AddFakeFile(t, fullName)
+	root.AddFakeFile(t, incName)
+	handler := &sidecar.SnapshotHandler{
+		Store: &sidecar.FSStore{FS: root.GetLedgerDir(t)},
+		Log:   zaptest.NewLogger(t),
+	}
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	handler.RegisterHandlers(engine.Group("/v1"))
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	// Sidecar lists the incremental snapshot along with its base.
+	client := fetch.NewSidecarClientWithOpts(server.URL,
+		fetch.SidecarClientOpts{Resty: resty.NewWithClient(server.Client())})
+	infos, err := client.ListSnapshots(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	require.Len(t, infos[0].Files, 2)
+	assert.Equal(t, incName, infos[0].Files[0].FileName)
+	assert.Equal(t, fullName, infos[0].Files[1].FileName)
+
+	// Downloading into an empty ledger dir installs both files.
+	ledgerDir := t.TempDir()
+	downloader := fetch.NewDownloader()
+	downloader.Log = zaptest.NewLogger(t)
+	snap := &types.SnapshotSource{SnapshotInfo: *infos[0], Target: server.URL}
+	require.NoError(t, downloader.DownloadSnapshot(context.TODO(), snap, ledgerDir))
+	for _, name := range []string{fullName, incName} {
+		_, err := os.Stat(filepath.Join(ledgerDir, name))
+		assert.NoError(t, err, name)
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 
@@ -77,6 +79,48 @@ func TestSidecar(t *testing.T) {
 	})
 }
 
+// TestSidecar_Range requests a byte range of a snapshot,
+// as done by clients resuming a download.
+func TestSidecar_Range(t *testing.T) {
+	const name = "snapshot-100-7jMmeXZSNcWPrB2RsTdeXfXrsyW5c1BfPjqoLW2X5T7V.tar.bz2"
+	root := ledgertest.NewFS(t)
+	root.AddFile(t, name, []byte("0123456789"))
+	handler := &sidecar.SnapshotHandler{
+		Store: &sidecar.FSStore{FS: root.GetLedgerDir(t)},
+		Log:   zaptest.NewLogger(t),
+	}
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	handler.RegisterHandlers(engine.Group("/v1"))
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/snapshot/"+name, nil)
+	require.NoError(t, err)
+	req.Header.Set("range", "bytes=2-5")
+	res, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+	assert.Equal(t, "bytes 2-5/10", res.Header.Get("content-range"))
+	assert.Equal(t, "bytes", res.Header.Get("accept-ranges"))
+	assert.Equal(t, "2345", string(body))
+
+	// Resuming from an offset returns the rest of the file.
+	client := fetch.NewSidecarClientWithOpts(server.URL,
+		fetch.SidecarClientOpts{Resty: resty.NewWithClient(server.Client())})
+	rest, err := client.StreamSnapshotFrom(context.TODO(), name, 7)
+	require.NoError(t, err)
+	defer rest.Body.Close()
+	body, err = io.ReadAll(rest.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, rest.StatusCode)
+	assert.Equal(t, "789", string(body))
+}
+
 func newSidecar(t *testing.T, slots ...uint64) (server *httptest.Server, root *ledgertest.FS) {
 	root = ledgertest.NewFS(t)
 	for _, slot := range slots {
@@ -87,8 +131,8 @@ func newSidecar(t *testing.T, slots ...uint64) (server *httptest.Server, root *l
 	ledgerDir := root.GetLedgerDir(t)
 
 	handler := &sidecar.SnapshotHandler{
-		LedgerDir: ledgerDir,
-		Log:       zaptest.NewLogger(t),
+		Store: &sidecar.FSStore{FS: ledgerDir},
+		Log:   zaptest.NewLogger(t),
 	}
 
 	gin.SetMode(gin.ReleaseMode)
@@ -97,3 +141,57 @@ func newSidecar(t *testing.T, slots ...uint64) (server *httptest.Server, root *l
 	server = httptest.NewServer(engine)
 	return
 }
+
+// TestSidecar_RequestSnapshot requests a snapshot newer than the sidecar has,
+// and polls until the triggered snapshot appears.
+func TestSidecar_RequestSnapshot(t *testing.T) {
+	root := ledgertest.NewFS(t)
+	root.AddFakeFile(t, "snapshot-100-7jMmeXZSNcWPrB2RsTdeXfXrsyW5c1BfPjqoLW2X5T7V.tar.bz2")
+	handler := sidecar.NewSnapshotRequestHandler(&sidecar.FSStore{FS: root.GetLedgerDir(t)}, "secret", zaptest.NewLogger(t))
+	triggered := make(chan uint64, 1)
+	handler.Trigger = func(_ context.Context, slot uint64) error {
+		triggered <- slot
+		return nil
+	}
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	handler.RegisterHandlers(engine.Group("/v1"))
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	ctx := context.TODO()
+	client := fetch.NewSidecarClientWithOpts(server.URL, fetch.SidecarClientOpts{RequestToken: "secret"})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		_, err := fetch.NewSidecarClient(server.URL).RequestSnapshot(ctx, 200)
+		assert.ErrorIs(t, err, fetch.ErrUnauthorized)
+	})
+	t.Run("Available", func(t *testing.T) {
+		req, err := client.RequestSnapshot(ctx, 100)
+		require.NoError(t, err)
+		assert.Equal(t, types.SnapshotRequestReady, req.Status)
+		assert.Equal(t, uint64(100), req.File.Slot)
+	})
+	t.Run("Triggered", func(t *testing.T) {
+		req, err := client.RequestSnapshot(ctx, 200)
+		require.NoError(t, err)
+		assert.Equal(t, types.SnapshotRequestPending, req.Status)
+		assert.Equal(t, uint64(200), <-triggered)
+
+		req, err = client.GetSnapshotRequest(ctx, req.ID)
+		require.NoError(t, err)
+		assert.Equal(t, types.SnapshotRequestPending, req.Status)
+
+		root.AddFakeFile(t, "snapshot-200-7jMmeXZSNcWPrB2RsTdeXfXrsyW5c1BfPjqoLW2X5T7V.tar.bz2")
+		req, err = client.GetSnapshotRequest(ctx, req.ID)
+		require.NoError(t, err)
+		assert.Equal(t, types.SnapshotRequestReady, req.Status)
+		assert.Equal(t, uint64(200), req.File.Slot)
+	})
+	t.Run("Unknown", func(t *testing.T) {
+		_, err := client.GetSnapshotRequest(ctx, "nope")
+		var statusErr *fetch.StatusError
+		require.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	})
+}
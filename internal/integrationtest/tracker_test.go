@@ -16,6 +16,8 @@ package integrationtest
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
@@ -30,6 +32,7 @@ import (
 	"go.blockdaemon.com/solana/cluster-manager/internal/scraper"
 	"go.blockdaemon.com/solana/cluster-manager/internal/tracker"
 	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/atomic"
 	"go.uber.org/zap/zaptest"
 	"gopkg.in/resty.v1"
 )
@@ -169,6 +172,38 @@ func TestTracker(t *testing.T) {
 			},
 		},
 		snaps)
+
+	// Limit number of results, keeping the best.
+	snaps, err = client.GetBestSnapshots(context.TODO(), 2)
+	require.NoError(t, err)
+	require.Len(t, snaps, 2)
+	assert.Equal(t, uint64(103), snaps[0].Slot)
+	assert.Equal(t, uint64(102), snaps[1].Slot)
+
+	// Filter by slot range.
+	snaps, err = client.GetBestSnapshotsInRange(context.TODO(), -1, 101, 102)
+	require.NoError(t, err)
+	require.Len(t, snaps, 2)
+	assert.Equal(t, uint64(102), snaps[0].Slot)
+	assert.Equal(t, uint64(101), snaps[1].Slot)
+
+	snaps, err = client.GetBestSnapshotsInRange(context.TODO(), -1, 200, 300)
+	require.NoError(t, err)
+	assert.Empty(t, snaps)
+
+	// Only full snapshots are available, so no incrementals exist for any base.
+	snaps, err = client.GetSnapshotsForBase(context.TODO(), 100)
+	require.NoError(t, err)
+	assert.Empty(t, snaps)
+
+	// Filter by time since last scrape.
+	snaps, err = client.SetMaxAge(time.Hour).GetBestSnapshots(context.TODO(), -1)
+	require.NoError(t, err)
+	assert.Len(t, snaps, sidecarCount)
+	time.Sleep(10 * time.Millisecond)
+	snaps, err = client.SetMaxAge(time.Millisecond).GetBestSnapshots(context.TODO(), -1)
+	require.NoError(t, err)
+	assert.Empty(t, snaps)
 }
 
 func newTracker(db *index.DB) *httptest.Server {
@@ -178,3 +213,139 @@ func newTracker(db *index.DB) *httptest.Server {
 	handler.RegisterHandlers(engine.Group("/v1"))
 	return httptest.NewServer(engine)
 }
+
+func TestTrackerHealth(t *testing.T) {
+	var lastScrape atomic.Time
+	health := &tracker.HealthHandler{
+		DB:           index.NewDB(),
+		LastScrape:   lastScrape.Load,
+		MaxScrapeAge: time.Minute,
+	}
+	mux := http.NewServeMux()
+	health.RegisterHandlers(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) int {
+		res, err := server.Client().Get(server.URL + path)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		return res.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, get("/healthz"))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz"), "no scrape yet")
+	lastScrape.Store(time.Now())
+	assert.Equal(t, http.StatusOK, get("/readyz"))
+	lastScrape.Store(time.Now().Add(-2 * time.Minute))
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz"), "stale scrape")
+}
+
+func TestTrackerManifest(t *testing.T) {
+	db := index.NewDB()
+	snap := func(target string, slot uint64, hash solana.Hash) *index.SnapshotEntry {
+		return &index.SnapshotEntry{
+			SnapshotKey: index.NewSnapshotKey(target, slot),
+			Info: &types.SnapshotInfo{
+				Slot: slot,
+				Hash: hash,
+				Files: []*types.SnapshotFile{
+					{Slot: 100, Hash: solana.Hash{1}, Size: 10},
+					{Slot: slot, BaseSlot: 100, Hash: hash, Size: 1},
+				},
+				TotalSize: 11,
+			},
+			UpdatedAt: time.Now(),
+		}
+	}
+	db.UpsertSnapshots(
+		snap("10.0.0.1:13080", 110, solana.Hash{2}),
+		snap("10.0.0.2:13080", 110, solana.Hash{2}),
+		snap("10.0.0.3:13080", 120, solana.Hash{3}),
+	)
+
+	handler := tracker.NewHandler(db)
+	handler.ManifestKey = []byte("key")
+	gin.SetMode(gin.ReleaseMode)
+	engine := gin.New()
+	handler.RegisterHandlers(engine.Group("/v1"))
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	client := fetch.NewTrackerClientWithOpts(fetch.TrackerClientOpts{
+		Resty:       resty.NewWithClient(server.Client()).SetHostURL(server.URL),
+		ManifestKey: []byte("key"),
+	})
+	manifest, err := client.GetManifest(context.TODO(), 0)
+	require.NoError(t, err)
+	require.NotNil(t, manifest)
+	assert.NotZero(t, manifest.Generation)
+	assert.Equal(t, []types.ManifestSnapshot{
+		{Slot: 120, BaseSlot: 100, Hash: solana.Hash{3}, Size: 11, Sources: []string{"10.0.0.3:13080"}},
+		{Slot: 110, BaseSlot: 100, Hash: solana.Hash{2}, Size: 11, Sources: []string{"10.0.0.1:13080", "10.0.0.2:13080"}},
+	}, manifest.Snapshots)
+
+	// Scrapes refreshing the same snapshots don't advance the generation.
+	db.UpsertSnapshots(snap("10.0.0.1:13080", 110, solana.Hash{2}))
+	unchanged, err := client.GetManifest(context.TODO(), manifest.Generation)
+	require.NoError(t, err)
+	assert.Nil(t, unchanged)
+
+	// New snapshots do.
+	db.UpsertSnapshots(snap("10.0.0.1:13080", 130, solana.Hash{4}))
+	changed, err := client.GetManifest(context.TODO(), manifest.Generation)
+	require.NoError(t, err)
+	require.NotNil(t, changed)
+	assert.Equal(t, manifest.Generation+1, changed.Generation)
+	assert.Len(t, changed.Snapshots, 3)
+
+	// Manifests signed with another key are rejected.
+	handler.ManifestKey = []byte("other")
+	_, err = client.GetManifest(context.TODO(), 0)
+	assert.ErrorIs(t, err, fetch.ErrBadResponse)
+	assert.ErrorIs(t, err, types.ErrManifestSignature)
+}
+
+func TestTrackerSources(t *testing.T) {
+	db := index.NewDB()
+	snap := func(target string, slot uint64, hash solana.Hash) *index.SnapshotEntry {
+		return &index.SnapshotEntry{
+			SnapshotKey: index.NewSnapshotKey(target, slot),
+			Info: &types.SnapshotInfo{
+				Slot:  slot,
+				Hash:  hash,
+				Files: []*types.SnapshotFile{{Slot: slot, Hash: hash, Size: 1}},
+			},
+			UpdatedAt: time.Now(),
+		}
+	}
+	// More sources than GetBestSnapshots returns.
+	var want []string
+	for i := 0; i < tracker.MaxBestSnapshots+5; i++ {
+		target := fmt.Sprintf("10.0.0.%d:13080", 100+i)
+		db.UpsertSnapshots(snap(target, 110, solana.Hash{2}))
+		want = append(want, target)
+	}
+	// Same slot on a fork, and another slot.
+	db.UpsertSnapshots(snap("10.0.1.1:13080", 110, solana.Hash{3}))
+	db.UpsertSnapshots(snap("10.0.1.2:13080", 120, solana.Hash{2}))
+
+	server := newTracker(db)
+	defer server.Close()
+	client := fetch.NewTrackerClientWithResty(resty.NewWithClient(server.Client()).SetHostURL(server.URL))
+
+	targets, err := client.GetSources(context.TODO(), 110, solana.Hash{2})
+	require.NoError(t, err)
+	assert.Equal(t, want, targets)
+	targets, err = client.GetSources(context.TODO(), 110, solana.Hash{3})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.1.1:13080"}, targets)
+	targets, err = client.GetSources(context.TODO(), 130, solana.Hash{2})
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	// Filter by time since last scrape.
+	time.Sleep(10 * time.Millisecond)
+	targets, err = client.SetMaxAge(time.Millisecond).GetSources(context.TODO(), 110, solana.Hash{2})
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+}
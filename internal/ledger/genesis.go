@@ -0,0 +1,45 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"crypto/sha256"
+	"io"
+	"io/fs"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// GenesisFileName is the name of the genesis config in the ledger dir.
+const GenesisFileName = "genesis.bin"
+
+// GenesisHash returns the genesis hash of the cluster the ledger dir belongs to.
+//
+// The genesis hash is the SHA-256 hash of the serialized genesis config stored in genesis.bin.
+// Fails with fs.ErrNotExist if the ledger dir has no genesis config.
+func GenesisHash(ledgerDir fs.FS) (solana.Hash, error) {
+	f, err := ledgerDir.Open(GenesisFileName)
+	if err != nil {
+		return solana.Hash{}, err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return solana.Hash{}, err
+	}
+	var hash solana.Hash
+	copy(hash[:], sum.Sum(nil))
+	return hash, nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenesisHash(t *testing.T) {
+	ledgerDir := fstest.MapFS{GenesisFileName: &fstest.MapFile{Data: []byte("hello")}}
+	hash, err := GenesisHash(ledgerDir)
+	require.NoError(t, err)
+	// SHA-256 of "hello"
+	assert.Equal(t, solana.MustHashFromBase58("42TEXg1vFAbcJ65y7qdYG9iCPvYfy3NDdVLd75akX2P5"), hash)
+
+	_, err = GenesisHash(fstest.MapFS{})
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -16,145 +16,223 @@
 package ledger
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"path/filepath"
-	"sort"
 	"strings"
 
-	"github.com/gagliardetto/solana-go"
 	"go.blockdaemon.com/solana/cluster-manager/types"
 )
 
-// ListSnapshotFiles returns all snapshot files in a ledger dir.
-func ListSnapshotFiles(ledgerDir fs.FS) ([]*types.SnapshotFile, error) {
-	dirEntries, err := fs.ReadDir(ledgerDir, ".")
+// SnapshotDir returns the dir holding snapshot archives, given their subdir within the ledger dir.
+// An empty subdir selects the flat layout, with archives directly in the ledger dir.
+func SnapshotDir(ledgerDir string, subdir string) (string, error) {
+	if subdir == "" {
+		return ledgerDir, nil
+	}
+	subdir = filepath.Clean(subdir)
+	if filepath.IsAbs(subdir) || subdir == ".." || strings.HasPrefix(subdir, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("snapshot subdir must be within the ledger dir: %s", subdir)
+	}
+	return filepath.Join(ledgerDir, subdir), nil
+}
+
+// ErrStopWalk can be returned by a WalkSnapshots callback to stop walking without error.
+var ErrStopWalk = errors.New("stop walking snapshots")
+
+// walkBatchSize is the number of directory entries read at once by WalkSnapshots.
+const walkBatchSize = 256
+
+// WalkSnapshots calls fn for each snapshot file in a ledger dir, in directory order.
+//
+// Unlike ListSnapshotFiles, directory entries are read in batches rather than all at once.
+// Stops at the first error returned by fn, which is returned unless it is ErrStopWalk.
+func WalkSnapshots(ledgerDir fs.FS, fn func(file *types.SnapshotFile) error) error {
+	return WalkSnapshotsContext(context.Background(), ledgerDir, fn)
+}
+
+// WalkSnapshotsContext is like WalkSnapshots, but stops with the context error once ctx is done.
+// The context is checked before each file system access.
+func WalkSnapshotsContext(ctx context.Context, ledgerDir fs.FS, fn func(file *types.SnapshotFile) error) error {
+	dir, err := ledgerDir.Open(".")
 	if err != nil {
-		return nil, fmt.Errorf("failed to list ledger dir: %w", err)
+		return fmt.Errorf("failed to list ledger dir: %w", err)
 	}
-	var files []*types.SnapshotFile
-	for _, dirEntry := range dirEntries {
-		if !dirEntry.Type().IsRegular() {
-			continue
+	defer dir.Close()
+	readDir, ok := dir.(fs.ReadDirFile)
+	if !ok {
+		return fmt.Errorf("failed to list ledger dir: not a directory")
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
-		info := ParseSnapshotFileName(dirEntry.Name())
-		if info == nil {
-			continue
+		dirEntries, err := readDir.ReadDir(walkBatchSize)
+		for _, dirEntry := range dirEntries {
+			if !dirEntry.Type().IsRegular() {
+				continue
+			}
+			file := ParseSnapshotFileName(dirEntry.Name())
+			if file == nil {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if InProgress(ledgerDir, file.FileName) {
+				continue
+			}
+			if err := SnapshotStat(ledgerDir, file); err != nil {
+				continue
+			}
+			if err := fn(file); errors.Is(err, ErrStopWalk) {
+				return nil
+			} else if err != nil {
+				return err
+			}
 		}
-		if err := SnapshotStat(ledgerDir, info); err != nil {
-			continue
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to list ledger dir: %w", err)
 		}
-		files = append(files, info)
 	}
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].Compare(files[j]) > 0
+}
+
+// ListSnapshotFiles returns all snapshot files in a ledger dir, sorted best-to-worst.
+func ListSnapshotFiles(ledgerDir fs.FS) ([]*types.SnapshotFile, error) {
+	return ListSnapshotFilesContext(context.Background(), ledgerDir)
+}
+
+// ListSnapshotFilesContext is like ListSnapshotFiles, but stops with the context error once ctx is done.
+func ListSnapshotFilesContext(ctx context.Context, ledgerDir fs.FS) ([]*types.SnapshotFile, error) {
+	var files []*types.SnapshotFile
+	err := WalkSnapshotsContext(ctx, ledgerDir, func(file *types.SnapshotFile) error {
+		files = append(files, file)
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	types.SortSnapshots(files)
 	return files, nil
 }
 
 // ListSnapshots shows all available snapshots of a ledger dir in the specified FS.
 // Result is sorted by best-to-worst.
 func ListSnapshots(ledgerDir fs.FS) ([]*types.SnapshotInfo, error) {
-	// List and stat snapshot files.
-	files, err := ListSnapshotFiles(ledgerDir)
-	if err != nil {
-		return nil, err
+	return ListSnapshotsContext(context.Background(), ledgerDir)
+}
+
+// ListSnapshotsContext is like ListSnapshots, but returns the context error as soon as ctx is done,
+// even while blocked on a slow file system. The abandoned walk stops at its next file system access.
+func ListSnapshotsContext(ctx context.Context, ledgerDir fs.FS) ([]*types.SnapshotInfo, error) {
+	type result struct {
+		files []*types.SnapshotFile
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// List and stat snapshot files.
+		files, err := ListSnapshotFilesContext(ctx, ledgerDir)
+		done <- result{files, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		return BuildSnapshotInfos(res.files), nil
 	}
-	// Reconstruct snapshot chains for all available snapshots.
+}
+
+// BuildSnapshotInfos reconstructs snapshot chains for all given snapshot files.
+// Files must be sorted best-to-worst, snapshots with incomplete chains are skipped.
+func BuildSnapshotInfos(files []*types.SnapshotFile) []*types.SnapshotInfo {
 	infos := make([]*types.SnapshotInfo, 0, len(files))
 	for _, file := range files {
 		if info := buildSnapshotInfo(files, file); info != nil {
 			infos = append(infos, info)
 		}
 	}
-	return infos, nil
+	return infos
 }
 
 // buildSnapshotInfo builds a snapshot info object against the target snapshot file.
-// The files array must be sorted.
 func buildSnapshotInfo(files []*types.SnapshotFile, target *types.SnapshotFile) *types.SnapshotInfo {
-	// Start at target snapshot and reconstruct chain of snapshots.
+	chain, err := ResolveChain(files, target)
+	if err != nil {
+		return nil // incomplete chain
+	}
+	var totalSize uint64
+	for _, file := range chain {
+		totalSize += file.Size
+	}
+	return &types.SnapshotInfo{
+		Slot:      target.Slot,
+		Hash:      target.Hash,
+		Files:     chain,
+		TotalSize: totalSize,
+	}
+}
+
+// ErrMissingBase is returned when the base snapshot of an incremental snapshot is not available.
+var ErrMissingBase = errors.New("missing base snapshot")
+
+// ResolveChain returns the snapshot files needed to restore the target snapshot,
+// starting at the target and ending at the full snapshot everything is based on.
+//
+// Fails with ErrMissingBase if files doesn't contain a required base snapshot.
+func ResolveChain(files []*types.SnapshotFile, target *types.SnapshotFile) ([]*types.SnapshotFile, error) {
 	chain := []*types.SnapshotFile{target}
-	totalSize := target.Size
 	for {
 		base := chain[len(chain)-1].BaseSlot
 		if base == 0 {
-			break // complete chain
+			return chain, nil // complete chain
 		}
-		// Find snapshot matching base slot number.
-		index := sort.Search(len(files), func(i int) bool {
-			return files[i].Slot <= base
-		})
-		if index >= len(files) || files[index].Slot != base {
-			return nil // incomplete chain
+		// Find snapshot matching base slot number, preferring full snapshots.
+		var match *types.SnapshotFile
+		for _, file := range files {
+			if file.Slot == base && file.BaseSlot < file.Slot && (match == nil || file.IsFull()) {
+				match = file
+			}
+		}
+		if match == nil {
+			return nil, fmt.Errorf("%w at slot %d for snapshot at slot %d", ErrMissingBase, base, target.Slot)
 		}
 		// Extend snapshot chain.
-		chain = append(chain, files[index])
-		totalSize += files[index].Size
-	}
-	return &types.SnapshotInfo{
-		Slot:      target.Slot,
-		Hash:      target.Hash,
-		Files:     chain,
-		TotalSize: totalSize,
+		chain = append(chain, match)
 	}
 }
 
 // ParseSnapshotFileName parses a snapshot's name.
+//
+// Returns nil if the name is not a valid snapshot file name.
+// See types.ParseSnapshotFileName for the error details.
 func ParseSnapshotFileName(name string) *types.SnapshotFile {
-	// Split file name into base and stem.
-	stem := name
-	var ext string
-	for i := 0; i < 2; i++ {
-		extPart := filepath.Ext(stem)
-		stem = strings.TrimSuffix(stem, extPart)
-		ext = extPart + ext
-	}
-	if strings.ContainsAny(stem, "\\/ \t\n") {
+	file, err := types.ParseSnapshotFileName(name)
+	if err != nil {
 		return nil
 	}
-	// Parse file name fields.
-	if strings.HasPrefix(stem, "snapshot-") {
-		var slot uint64
-		var hashStr string
-		n, err := fmt.Sscanf(stem, "snapshot-%d-%s", &slot, &hashStr)
-		if n != 2 || err != nil {
-			return nil
-		}
-		hash, err := solana.HashFromBase58(hashStr)
-		if err != nil {
-			return nil
-		}
-		return &types.SnapshotFile{
-			FileName: name,
-			Slot:     slot,
-			Hash:     hash,
-			Ext:      ext,
-		}
+	return file
+}
+
+// InProgress returns whether a snapshot file is still being written, see types.InProgressSuffixes.
+func InProgress(fs_ fs.FS, name string) bool {
+	if types.IsInProgressName(name) {
+		return true
 	}
-	if strings.HasPrefix(stem, "incremental-snapshot-") {
-		var baseSlot, incrementalSlot uint64
-		var hashStr string
-		n, err := fmt.Sscanf(stem, "incremental-snapshot-%d-%d-%s", &baseSlot, &incrementalSlot, &hashStr)
-		if n != 3 || err != nil {
-			return nil
-		}
-		hash, err := solana.HashFromBase58(hashStr)
-		if err != nil {
-			return nil
-		}
-		if incrementalSlot <= baseSlot {
-			return nil
-		}
-		return &types.SnapshotFile{
-			FileName: name,
-			Slot:     incrementalSlot,
-			BaseSlot: baseSlot,
-			Hash:     hash,
-			Ext:      ext,
+	for _, suffix := range types.InProgressSuffixes {
+		if _, err := fs.Stat(fs_, name+suffix); err == nil {
+			return true
 		}
 	}
-	return nil
+	return false
 }
 
 // SnapshotStat fills stat info into the snapshot file.
@@ -15,8 +15,14 @@
 package ledger
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/stretchr/testify/assert"
@@ -165,6 +171,46 @@ func TestListSnapshots(t *testing.T) {
 	)
 }
 
+func TestWalkSnapshots(t *testing.T) {
+	// More files than read in a single batch.
+	ledgerDir := fstest.MapFS{
+		"genesis.bin":     &fstest.MapFile{Data: []byte("A")},
+		"snapshot-1-dir":  &fstest.MapFile{Mode: fs.ModeDir},
+		"rocksdb/LOCK":    &fstest.MapFile{},
+		"snapshot-x.zst":  &fstest.MapFile{Data: []byte("A")},
+		"tower-1_9.bin":   &fstest.MapFile{Data: []byte("A")},
+		"accounts/1.1234": &fstest.MapFile{Data: []byte("A")},
+	}
+	const count = walkBatchSize + 10
+	for slot := 1; slot <= count; slot++ {
+		name := fmt.Sprintf("snapshot-%d-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst", slot)
+		ledgerDir[name] = &fstest.MapFile{Data: []byte("A")}
+	}
+
+	slots := make(map[uint64]bool)
+	err := WalkSnapshots(ledgerDir, func(file *types.SnapshotFile) error {
+		assert.Equal(t, uint64(1), file.Size)
+		slots[file.Slot] = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, slots, count)
+
+	var visited int
+	err = WalkSnapshots(ledgerDir, func(*types.SnapshotFile) error {
+		visited++
+		return ErrStopWalk
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, visited)
+
+	failure := errors.New("fail")
+	err = WalkSnapshots(ledgerDir, func(*types.SnapshotFile) error {
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+}
+
 func TestParseSnapshotFileName(t *testing.T) {
 	cases := []struct {
 		name string
@@ -241,3 +287,106 @@ func TestParseSnapshotFileName(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveChain(t *testing.T) {
+	full := &types.SnapshotFile{Slot: 100}
+	inc1 := &types.SnapshotFile{Slot: 200, BaseSlot: 100}
+	inc2 := &types.SnapshotFile{Slot: 300, BaseSlot: 200}
+	orphan := &types.SnapshotFile{Slot: 500, BaseSlot: 400}
+	files := []*types.SnapshotFile{orphan, inc2, inc1, full}
+
+	t.Run("Full", func(t *testing.T) {
+		chain, err := ResolveChain(files, full)
+		require.NoError(t, err)
+		assert.Equal(t, []*types.SnapshotFile{full}, chain)
+	})
+	t.Run("Incremental", func(t *testing.T) {
+		chain, err := ResolveChain(files, inc1)
+		require.NoError(t, err)
+		assert.Equal(t, []*types.SnapshotFile{inc1, full}, chain)
+	})
+	t.Run("Nested", func(t *testing.T) {
+		chain, err := ResolveChain(files, inc2)
+		require.NoError(t, err)
+		assert.Equal(t, []*types.SnapshotFile{inc2, inc1, full}, chain)
+	})
+	t.Run("MissingBase", func(t *testing.T) {
+		_, err := ResolveChain(files, orphan)
+		assert.ErrorIs(t, err, ErrMissingBase)
+		assert.EqualError(t, err, "missing base snapshot at slot 400 for snapshot at slot 500")
+	})
+}
+
+func TestSnapshotDir(t *testing.T) {
+	cases := []struct {
+		subdir string
+		dir    string
+		ok     bool
+	}{
+		{"", "/ledger", true},
+		{"snapshots", "/ledger/snapshots", true},
+		{"snapshots/", "/ledger/snapshots", true},
+		{"./a/../snapshots", "/ledger/snapshots", true},
+		{"..", "", false},
+		{"../snapshots", "", false},
+		{"/snapshots", "", false},
+	}
+	for _, tc := range cases {
+		dir, err := SnapshotDir("/ledger", tc.subdir)
+		if tc.ok {
+			assert.NoError(t, err, tc.subdir)
+		} else {
+			assert.Error(t, err, tc.subdir)
+		}
+		assert.Equal(t, tc.dir, dir, tc.subdir)
+	}
+}
+
+func TestListSnapshots_InProgress(t *testing.T) {
+	const complete = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	const marked = "snapshot-200-7jMmeXZSNcWPrB2RsTdeXfXrsyW5c1BfPjqoLW2X5T7V.tar.zst"
+	ledgerDir := fstest.MapFS{
+		complete:        &fstest.MapFile{Data: []byte("A")},
+		marked:          &fstest.MapFile{Data: []byte("B")},
+		marked + ".tmp": &fstest.MapFile{},
+		"snapshot-300-7jMmeXZSNcWPrB2RsTdeXfXrsyW5c1BfPjqoLW2X5T7V.part": &fstest.MapFile{Data: []byte("C")},
+	}
+	files, err := ListSnapshotFiles(ledgerDir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, complete, files[0].FileName)
+
+	assert.False(t, InProgress(ledgerDir, complete))
+	assert.True(t, InProgress(ledgerDir, marked))
+}
+
+// blockingFS blocks on stat until released.
+type blockingFS struct {
+	fs.FS
+	release chan struct{}
+}
+
+func (b blockingFS) Stat(name string) (fs.FileInfo, error) {
+	<-b.release
+	return fs.Stat(b.FS, name)
+}
+
+func TestListSnapshotsContext(t *testing.T) {
+	ledgerDir := blockingFS{
+		FS: fstest.MapFS{
+			"snapshot-1-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst": &fstest.MapFile{Data: []byte("A")},
+		},
+		release: make(chan struct{}),
+	}
+	defer close(ledgerDir.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := ListSnapshotsContext(ctx, ledgerDir)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ListSnapshotFilesContext(cancelled, ledgerDir.FS)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -55,6 +55,14 @@ func (f *FS) AddFakeFile(t *testing.T, name string) {
 	require.NoError(t, f.Root.Chtimes(filePath, f.DummyTime, f.DummyTime))
 }
 
+// AddFile adds a file with the given content to the fake ledger dir.
+func (f *FS) AddFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	filePath := filepath.Join(ledgerPath, name)
+	require.NoError(t, afero.WriteFile(f.Root, filePath, data, 0644))
+	require.NoError(t, f.Root.Chtimes(filePath, f.DummyTime, f.DummyTime))
+}
+
 // GetLedgerDir returns the ledger dir as a standard library fs.FS.
 func (f *FS) GetLedgerDir(t *testing.T) fs.FS {
 	t.Helper()
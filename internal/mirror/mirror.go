@@ -80,7 +80,7 @@ func (w *Worker) tick(ctx context.Context) {
 		for _, file := range src.Files {
 			if _, ok := files[file.Slot]; !ok {
 				files[file.Slot] = fileSource{
-					target: "http://" + src.Target, // TODO don't hardcode protocol scheme
+					target: fetch.TargetURL(src.Target),
 					file:   file,
 				}
 			}
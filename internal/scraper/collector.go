@@ -16,10 +16,8 @@ package scraper
 
 import (
 	"sync/atomic"
-	"time"
 
 	"go.blockdaemon.com/solana/cluster-manager/internal/index"
-	"go.blockdaemon.com/solana/cluster-manager/types"
 	"go.uber.org/zap"
 )
 
@@ -29,7 +27,8 @@ type Collector struct {
 	DB      *index.DB
 	Log     *zap.Logger
 
-	closed uint32
+	closed   uint32
+	bestSlot uint64 // slot of the best snapshot seen so far
 }
 
 func NewCollector(db *index.DB) *Collector {
@@ -67,6 +66,7 @@ func (c *Collector) run() {
 		}
 		c.Log.Debug("Scrape success",
 			zap.String("target", res.Target),
+			zap.Stringer("status", res.Status),
 			zap.Int("num_snapshots", len(res.Infos)))
 		c.DB.DeleteSnapshotsByTarget(res.Target)
 		entries := make([]*index.SnapshotEntry, len(res.Infos))
@@ -75,15 +75,25 @@ func (c *Collector) run() {
 				SnapshotKey: index.NewSnapshotKey(res.Target, info.Slot),
 				Info:        info,
 				UpdatedAt:   res.Time,
+				Node:        res.Node,
 			}
 		}
 		c.DB.UpsertSnapshots(entries...)
+		c.checkBestSnapshot()
 	}
 }
 
-type ProbeResult struct {
-	Time   time.Time
-	Target string
-	Infos  []*types.SnapshotInfo
-	Err    error
+// checkBestSnapshot reports when the slot of the best snapshot in the cluster increases.
+func (c *Collector) checkBestSnapshot() {
+	best := c.DB.GetBestSnapshots(1)
+	if len(best) == 0 || best[0].Info.Slot <= c.bestSlot {
+		return
+	}
+	metricBestSnapshotChanges.WithLabelValues(best[0].Target).Inc()
+	metricBestSnapshotSlot.Set(float64(best[0].Info.Slot))
+	c.Log.Info("Best snapshot advanced",
+		zap.Uint64("slot", best[0].Info.Slot),
+		zap.Uint64("previous_slot", c.bestSlot),
+		zap.String("target", best[0].Target))
+	c.bestSlot = best[0].Info.Slot
 }
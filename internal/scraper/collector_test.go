@@ -0,0 +1,58 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.blockdaemon.com/solana/cluster-manager/internal/index"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestCollector_BestSnapshotAdvanced(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	collector := NewCollector(index.NewDB())
+	collector.Log = zap.New(core)
+	collector.Start()
+
+	probe := func(target string, slot uint64) {
+		collector.Probes() <- ProbeResult{
+			Time:   time.Now(),
+			Target: target,
+			Status: ProbeSnapshots,
+			Infos:  []*types.SnapshotInfo{{Slot: slot}},
+		}
+	}
+	before := testutil.ToFloat64(metricBestSnapshotChanges.WithLabelValues("collector-b:8899"))
+	probe("collector-a:8899", 100)
+	probe("collector-b:8899", 200)
+	probe("collector-a:8899", 150) // not the best
+	probe("collector-b:8899", 200) // unchanged
+	collector.Close()
+
+	assert.Eventually(t, func() bool {
+		return logs.FilterMessage("Best snapshot advanced").Len() == 2
+	}, time.Second, 10*time.Millisecond)
+	entry := logs.FilterMessage("Best snapshot advanced").All()[1]
+	assert.Equal(t, "collector-b:8899", entry.ContextMap()["target"])
+	assert.Equal(t, uint64(200), entry.ContextMap()["slot"])
+	assert.Equal(t, before+1, testutil.ToFloat64(metricBestSnapshotChanges.WithLabelValues("collector-b:8899")))
+	assert.Equal(t, float64(200), testutil.ToFloat64(metricBestSnapshotSlot))
+}
@@ -15,7 +15,9 @@
 package scraper
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"go.blockdaemon.com/solana/cluster-manager/internal/discovery"
 	"go.blockdaemon.com/solana/cluster-manager/types"
@@ -24,8 +26,11 @@ import (
 
 // Manager maintains a group of scrapers.
 type Manager struct {
-	res      chan<- ProbeResult
-	scrapers []*Scraper
+	res chan<- ProbeResult
+
+	lock        sync.Mutex
+	scrapers    []*Scraper
+	lastSuccess time.Time // of scrapers that were shut down
 
 	Log *zap.Logger
 }
@@ -40,45 +45,98 @@ func NewManager(results chan<- ProbeResult) *Manager {
 
 // Reset shuts down all scrapers.
 func (m *Manager) Reset() {
+	m.closeAll().Wait()
+}
+
+// Shutdown shuts down all scrapers, waiting for in-flight probes until ctx is done.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	wg := m.closeAll()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeAll closes all scrapers in the background.
+func (m *Manager) closeAll() *sync.WaitGroup {
+	m.lock.Lock()
+	scrapers := m.scrapers
+	m.lastSuccess = m.lastSuccessLocked()
+	m.scrapers = nil
+	m.lock.Unlock()
+
 	var wg sync.WaitGroup
-	wg.Add(len(m.scrapers))
-	for _, scraper := range m.scrapers {
+	wg.Add(len(scrapers))
+	for _, scraper := range scrapers {
 		go func(scraper *Scraper) {
 			defer wg.Done()
 			scraper.Close()
 		}(scraper)
 	}
-	m.scrapers = nil
+	return &wg
+}
+
+// LastSuccess returns when any scraper last completed a scrape with at least one successful probe.
+func (m *Manager) LastSuccess() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.lastSuccessLocked()
+}
+
+func (m *Manager) lastSuccessLocked() time.Time {
+	last := m.lastSuccess
+	for _, scraper := range m.scrapers {
+		if t := scraper.LastSuccess(); t.After(last) {
+			last = t
+		}
+	}
+	return last
 }
 
 // Update shuts down and reloads all scrapers from config.
 func (m *Manager) Update(conf *types.Config) {
 	m.Reset()
+	var scrapers []*Scraper
 	for _, group := range conf.TargetGroups {
 		log := m.Log.With(zap.String("group", group.Group))
-		if err := m.loadGroup(group, log); err != nil {
+		scraper, err := m.loadGroup(group, log)
+		if err != nil {
 			log.Error("Failed to load group", zap.Error(err))
+			continue
 		}
+		scrapers = append(scrapers, scraper)
 	}
-	for _, scraper := range m.scrapers {
+	for _, scraper := range scrapers {
+		scraper.SetJitter(conf.ScrapeJitter)
 		scraper.Start(m.res, conf.ScrapeInterval)
 	}
+	m.lock.Lock()
+	m.scrapers = scrapers
+	m.lock.Unlock()
 }
 
-func (m *Manager) loadGroup(group *types.TargetGroup, log *zap.Logger) error {
+func (m *Manager) loadGroup(group *types.TargetGroup, log *zap.Logger) (*Scraper, error) {
 	disc, err := discovery.NewFromConfig(group)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	discovery.SetLogger(disc, log)
 
 	prober, err := NewProber(group)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	scraper := NewScraper(prober, disc)
+	scraper.SetConcurrency(group.MaxConcurrency)
+	scraper.Group = group.Group
 	scraper.Log = log
-	m.scrapers = append(m.scrapers, scraper)
-
-	return nil
+	return scraper, nil
 }
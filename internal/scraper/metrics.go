@@ -0,0 +1,66 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricProbes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "solana_cluster",
+		Subsystem: "scraper",
+		Name:      "probes_total",
+		Help:      "Number of probes by target and result",
+	}, []string{"target", "result"})
+	metricProbeDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "solana_cluster",
+		Subsystem: "scraper",
+		Name:      "probe_duration_seconds",
+		Help:      "Time taken to probe a target",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	})
+	metricTargets = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "solana_cluster",
+		Subsystem: "scraper",
+		Name:      "targets",
+		Help:      "Number of targets found by the last service discovery",
+	}, []string{"group"})
+	metricTargetsByStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "solana_cluster",
+		Subsystem: "scraper",
+		Name:      "targets_by_status",
+		Help:      "Number of targets by outcome of the last scrape (snapshots, empty, unreachable)",
+	}, []string{"group", "status"})
+	metricLastScrape = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "solana_cluster",
+		Subsystem: "scraper",
+		Name:      "last_scrape_timestamp_seconds",
+		Help:      "Unix time of the last completed scrape",
+	}, []string{"group"})
+	metricBestSnapshotChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "solana_cluster",
+		Subsystem: "scraper",
+		Name:      "best_snapshot_changes_total",
+		Help:      "Number of times the slot of the best snapshot increased, by target providing the new snapshot",
+	}, []string{"target"})
+	metricBestSnapshotSlot = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "solana_cluster",
+		Subsystem: "scraper",
+		Name:      "best_snapshot_slot",
+		Help:      "Slot of the best snapshot available in the cluster",
+	})
+)
@@ -17,21 +17,35 @@ package scraper
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.blockdaemon.com/solana/cluster-manager/internal/fetch"
 	"go.blockdaemon.com/solana/cluster-manager/types"
+	"gopkg.in/resty.v1"
 )
 
+// DefaultProbeTimeout is the max time a single probe may take by default.
+const DefaultProbeTimeout = 10 * time.Second
+
+// ErrProbeTimeout is returned when a target does not respond within the probe timeout.
+var ErrProbeTimeout = errors.New("probe timed out")
+
 // Prober checks snapshot info from Solana nodes.
 type Prober struct {
-	client  *http.Client
-	scheme  string
-	apiPath string
-	header  http.Header
+	client       *http.Client
+	scheme       string
+	apiPath      string
+	header       http.Header
+	probeTimeout time.Duration
+	defaultPort  string
+	sidecarPort  string // replaces the port of all targets if set
 }
 
 func NewProber(group *types.TargetGroup) (*Prober, error) {
@@ -52,6 +66,8 @@ func NewProber(group *types.TargetGroup) (*Prober, error) {
 		group.BearerAuth.Apply(header)
 	}
 
+	// The client is shared by all probes so connections are kept alive across scrapes.
+	// Connections to targets that are no longer discovered expire after IdleConnTimeout.
 	client := &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -60,6 +76,7 @@ func NewProber(group *types.TargetGroup) (*Prober, error) {
 				KeepAlive: 5 * time.Second,
 			}).DialContext,
 			TLSClientConfig:       tlsConfig,
+			MaxIdleConns:          0, // unlimited, keeps one idle connection per target
 			MaxIdleConnsPerHost:   1,
 			MaxConnsPerHost:       3,
 			IdleConnTimeout:       90 * time.Second,
@@ -67,7 +84,6 @@ func NewProber(group *types.TargetGroup) (*Prober, error) {
 			ExpectContinueTimeout: 1 * time.Second,
 			ForceAttemptHTTP2:     true,
 		},
-		Timeout: 10 * time.Second,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) == 1 {
 				return nil
@@ -76,20 +92,236 @@ func NewProber(group *types.TargetGroup) (*Prober, error) {
 		},
 	}
 
+	probeTimeout := group.ProbeTimeout
+	if probeTimeout <= 0 {
+		probeTimeout = DefaultProbeTimeout
+	}
+
 	return &Prober{
-		client:  client,
-		scheme:  group.Scheme,
-		apiPath: group.APIPath,
-		header:  header,
+		client:       client,
+		scheme:       group.Scheme,
+		apiPath:      group.APIPath,
+		header:       header,
+		probeTimeout: probeTimeout,
+		defaultPort:  defaultPort(group),
+		sidecarPort:  sidecarPort(group),
 	}, nil
 }
 
-// Probe fetches the snapshots of a single target.
-func (p *Prober) Probe(ctx context.Context, target string) ([]*types.SnapshotInfo, error) {
+// defaultPort returns the port probed for targets that don't specify one.
+func defaultPort(group *types.TargetGroup) string {
+	if group.DefaultPort != 0 {
+		return strconv.Itoa(int(group.DefaultPort))
+	}
+	if group.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// sidecarPort returns the port probed on all targets, replacing discovered ports.
+func sidecarPort(group *types.TargetGroup) string {
+	if group.SidecarPort == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(group.SidecarPort))
+}
+
+// sidecarTargets returns the targets with their ports replaced by the sidecar port, if set.
+func (p *Prober) sidecarTargets(targets []string) []string {
+	if p.sidecarPort == "" {
+		return targets
+	}
+	// Don't modify the discoverer's slice.
+	replaced := make([]string, len(targets))
+	for i, target := range targets {
+		replaced[i] = fetch.ReplacePort(target, p.sidecarPort)
+	}
+	return replaced
+}
+
+// withPort adds the given port to a target lacking one.
+func withPort(target string, port string) string {
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(target, "["), "]"), port)
+}
+
+// SetProbeTimeout sets the max time a single probe may take.
+func (p *Prober) SetProbeTimeout(timeout time.Duration) {
+	p.probeTimeout = timeout
+}
+
+// ProbeStatus tells apart the outcomes of a probe.
+type ProbeStatus int
+
+const (
+	// ProbeUnreachable means the target could not be queried.
+	ProbeUnreachable ProbeStatus = iota
+	// ProbeEmpty means the target responded but offers no snapshots.
+	ProbeEmpty
+	// ProbeSnapshots means the target responded with at least one snapshot.
+	ProbeSnapshots
+)
+
+func (s ProbeStatus) String() string {
+	switch s {
+	case ProbeUnreachable:
+		return "unreachable"
+	case ProbeEmpty:
+		return "empty"
+	case ProbeSnapshots:
+		return "snapshots"
+	default:
+		return "unknown"
+	}
+}
+
+// ProbeResult is the outcome of probing a single target.
+type ProbeResult struct {
+	Time   time.Time
+	Target string
+	Status ProbeStatus
+	Infos  []*types.SnapshotInfo
+	Node   *types.NodeStatus // nil if the sidecar doesn't report it
+	Err    error             // set if the target is unreachable
+}
+
+// Probe fetches the snapshots of a single target from its sidecar's snapshot list.
+//
+// Snapshot files are annotated with the node's software version, if the sidecar reports it.
+// The result includes the current slot and health of the node, if the sidecar reports them.
+// Unreachable targets carry the error in the result,
+// ErrProbeTimeout if the target does not respond within the probe timeout.
+func (p *Prober) Probe(ctx context.Context, target string) ProbeResult {
+	start := time.Now()
+	probeCtx, cancel := context.WithTimeout(ctx, p.probeTimeout)
+	defer cancel()
+	infos, node, err := p.probe(probeCtx, target)
+	metricProbeDuration.Observe(time.Since(start).Seconds())
+	res := ProbeResult{
+		Time:   time.Now(),
+		Target: target,
+	}
+	if err != nil {
+		metricProbes.WithLabelValues(target, "failure").Inc()
+		if ctx.Err() == nil && errors.Is(probeCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %s", ErrProbeTimeout, p.probeTimeout)
+		}
+		res.Status = ProbeUnreachable
+		res.Err = err
+		return res
+	}
+	metricProbes.WithLabelValues(target, "success").Inc()
+	res.Infos = infos
+	res.Node = node
+	if len(infos) == 0 {
+		res.Status = ProbeEmpty
+	} else {
+		res.Status = ProbeSnapshots
+	}
+	return res
+}
+
+func (p *Prober) probe(ctx context.Context, target string) ([]*types.SnapshotInfo, *types.NodeStatus, error) {
 	u := url.URL{
 		Scheme: p.scheme,
-		Host:   target,
+		Host:   withPort(target, p.defaultPort),
 		Path:   p.apiPath,
 	}
-	return fetch.NewSidecarClient(u.String()).ListSnapshots(ctx)
+	client := fetch.NewSidecarClientWithOpts(u.String(), fetch.SidecarClientOpts{
+		Resty: p.newResty(),
+	})
+	infos, err := client.ListSnapshots(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	infos = completeSnapshotInfos(infos)
+	// Older sidecars and nodes with RPC disabled don't report a version.
+	if version, err := client.GetVersion(ctx); err == nil && version != nil {
+		for _, info := range infos {
+			for _, file := range info.Files {
+				file.Version = version.SolanaCore
+			}
+		}
+	}
+	// Older sidecars don't report the node status, and empty sidecars need none.
+	var node *types.NodeStatus
+	if len(infos) > 0 {
+		if node, err = client.GetNodeStatus(ctx); err != nil {
+			node = nil
+		}
+	}
+	return infos, node, nil
+}
+
+// newResty returns a resty client sending the group's auth headers over the shared HTTP client.
+func (p *Prober) newResty() *resty.Client {
+	// Resty overwrites the redirect policy of the client it's given,
+	// so each probe gets a shallow copy sharing the transport.
+	httpClient := *p.client
+	client := resty.NewWithClient(&httpClient)
+	httpClient.CheckRedirect = p.client.CheckRedirect
+	for key, values := range p.header {
+		client.Header[key] = values
+	}
+	return client
+}
+
+// completeSnapshotInfos fills in snapshot file details older sidecars leave out,
+// so that each entry fully describes the files to download.
+//
+// Details are derived from file names. Entries with unparseable file names or zero hashes are dropped.
+func completeSnapshotInfos(infos []*types.SnapshotInfo) []*types.SnapshotInfo {
+	complete := infos[:0]
+	for _, info := range infos {
+		if completeSnapshotInfo(info) {
+			complete = append(complete, info)
+		}
+	}
+	return complete
+}
+
+func completeSnapshotInfo(info *types.SnapshotInfo) bool {
+	if info == nil || len(info.Files) == 0 {
+		return false
+	}
+	var totalSize uint64
+	for _, file := range info.Files {
+		if file == nil {
+			return false
+		}
+		parsed, err := types.ParseSnapshotFileName(file.FileName)
+		if err != nil {
+			return false
+		}
+		if file.Slot == 0 {
+			file.Slot = parsed.Slot
+		}
+		if file.BaseSlot == 0 {
+			file.BaseSlot = parsed.BaseSlot
+		}
+		if file.Hash.IsZero() {
+			file.Hash = parsed.Hash
+		}
+		if file.Ext == "" {
+			file.Ext = parsed.Ext
+		}
+		if file.Validate() != nil {
+			return false
+		}
+		totalSize += file.Size
+	}
+	// The first file is the snapshot itself, the rest are its bases.
+	if info.Slot == 0 {
+		info.Slot = info.Files[0].Slot
+	}
+	if info.Hash.IsZero() {
+		info.Hash = info.Files[0].Hash
+	}
+	if info.TotalSize == 0 {
+		info.TotalSize = totalSize
+	}
+	return true
 }
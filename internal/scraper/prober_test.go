@@ -0,0 +1,238 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/atomic"
+)
+
+func TestProber_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	prober, err := NewProber(&types.TargetGroup{Scheme: "http"})
+	require.NoError(t, err)
+	prober.SetProbeTimeout(50 * time.Millisecond)
+
+	res := prober.Probe(context.Background(), u.Host)
+	assert.Equal(t, ProbeUnreachable, res.Status)
+	assert.ErrorIs(t, res.Err, ErrProbeTimeout)
+}
+
+func TestProber_Probe_Empty(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	prober, err := NewProber(&types.TargetGroup{Scheme: "http"})
+	require.NoError(t, err)
+	res := prober.Probe(context.Background(), u.Host)
+	assert.NoError(t, res.Err)
+	assert.Equal(t, ProbeEmpty, res.Status)
+	assert.Equal(t, u.Host, res.Target)
+	assert.Empty(t, res.Infos)
+}
+
+func TestProber_Probe(t *testing.T) {
+	const (
+		fullName = "snapshot-100-7jMmeXZSNcWPrB2RsTdeXfXrsyW5c1BfPjqoLW2X5T7V.tar.zst"
+		incName  = "incremental-snapshot-100-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	)
+	fullHash := solana.MustHashFromBase58("7jMmeXZSNcWPrB2RsTdeXfXrsyW5c1BfPjqoLW2X5T7V")
+	incHash := solana.MustHashFromBase58("AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr")
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("content-type", "application/json")
+		switch r.URL.Path {
+		case "/v1/snapshots":
+			// Older sidecars only report file names and sizes.
+			_ = json.NewEncoder(w).Encode([]json.RawMessage{
+				json.RawMessage(`{"slot":200,"hash":"` + incHash.String() + `","size":3,"files":[` +
+					`{"file_name":"` + incName + `","slot":200,"base_slot":100,"hash":"` + incHash.String() + `","ext":".tar.zst","size":1},` +
+					`{"file_name":"` + fullName + `","slot":100,"hash":"` + fullHash.String() + `","ext":".tar.zst","size":2}]}`),
+				json.RawMessage(`{"files":[{"file_name":"` + fullName + `","size":2}]}`),
+				json.RawMessage(`{"files":[{"file_name":"not-a-snapshot","size":2}]}`),
+				json.RawMessage(`{"files":[{"file_name":"snapshot-50-11111111111111111111111111111111.tar.zst","size":2}]}`),
+				json.RawMessage(`{"files":[{"file_name":"snapshot-300-` + fullHash.String() + `.tmp","size":2}]}`),
+			})
+		case "/v1/version":
+			_, _ = w.Write([]byte(`{"solana-core":"1.14.1","feature-set":1}`))
+		case "/v1/node_status":
+			_, _ = w.Write([]byte(`{"slot":250,"healthy":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	prober, err := NewProber(&types.TargetGroup{Scheme: "http"})
+	require.NoError(t, err)
+	res := prober.Probe(context.Background(), u.Host)
+	require.NoError(t, res.Err)
+	assert.Equal(t, ProbeSnapshots, res.Status)
+
+	full := &types.SnapshotFile{
+		FileName: fullName,
+		Slot:     100,
+		Hash:     fullHash,
+		Ext:      ".tar.zst",
+		Size:     2,
+		Version:  "1.14.1",
+	}
+	assert.Equal(t, []*types.SnapshotInfo{
+		{
+			Slot:      200,
+			Hash:      incHash,
+			TotalSize: 3,
+			Files: []*types.SnapshotFile{
+				{
+					FileName: incName,
+					Slot:     200,
+					BaseSlot: 100,
+					Hash:     incHash,
+					Ext:      ".tar.zst",
+					Size:     1,
+					Version:  "1.14.1",
+				},
+				full,
+			},
+		},
+		{
+			Slot:      100,
+			Hash:      fullHash,
+			TotalSize: 2,
+			Files:     []*types.SnapshotFile{full},
+		},
+	}, res.Infos)
+	assert.Equal(t, &types.NodeStatus{Slot: 250, Healthy: true}, res.Node)
+	assert.Equal(t, []string{"GET /v1/snapshots", "GET /v1/version", "GET /v1/node_status"}, requests)
+}
+
+func TestProber_Probe_ReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("authorization"))
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Inc()
+		}
+	}
+	server.Start()
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	prober, err := NewProber(&types.TargetGroup{
+		Scheme:     "http",
+		BearerAuth: &types.BearerAuth{Token: "secret"},
+	})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		res := prober.Probe(context.Background(), u.Host)
+		require.NoError(t, res.Err)
+	}
+	assert.Equal(t, int32(1), conns.Load())
+}
+
+// BenchmarkProber_Probe re-probes the same TLS targets, comparing a persistent prober
+// against one created per scrape cycle.
+func BenchmarkProber_Probe(b *testing.B) {
+	const numTargets = 16
+	var targets []string
+	var tlsConfig *tls.Config
+	for i := 0; i < numTargets; i++ {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("content-type", "application/json")
+			_, _ = w.Write([]byte(`[]`))
+		}))
+		defer server.Close()
+		u, err := url.Parse(server.URL)
+		require.NoError(b, err)
+		targets = append(targets, u.Host)
+		// All test servers share the same certificate.
+		tlsConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	}
+
+	newProber := func() *Prober {
+		prober, err := NewProber(&types.TargetGroup{Scheme: "https"})
+		require.NoError(b, err)
+		prober.client.Transport.(*http.Transport).TLSClientConfig = tlsConfig
+		return prober
+	}
+	probeAll := func(prober *Prober) {
+		var wg sync.WaitGroup
+		for _, target := range targets {
+			wg.Add(1)
+			go func(target string) {
+				defer wg.Done()
+				if res := prober.Probe(context.Background(), target); res.Err != nil {
+					b.Error(res.Err)
+				}
+			}(target)
+		}
+		wg.Wait()
+	}
+
+	b.Run("Persistent", func(b *testing.B) {
+		prober := newProber()
+		probeAll(prober)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			probeAll(prober)
+		}
+	})
+	b.Run("PerCycle", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			prober := newProber()
+			probeAll(prober)
+			prober.client.CloseIdleConnections()
+		}
+	})
+}
@@ -16,21 +16,30 @@ package scraper
 
 import (
 	"context"
+	"math/rand"
+	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"go.blockdaemon.com/solana/cluster-manager/internal/discovery"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
 type Scraper struct {
-	prober     *Prober
-	discoverer discovery.Discoverer
-	rootCtx    context.Context
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
+	prober         *Prober
+	discoverer     discovery.Discoverer
+	rootCtx        context.Context
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+	maxConcurrency int
+	jitter         float64
+	rand           *rand.Rand
+	lastSuccess    atomic.Time
 
-	Log *zap.Logger
+	Group string // name of the target group, used in metrics
+	Log   *zap.Logger
 }
 
 func NewScraper(prober *Prober, discoverer discovery.Discoverer) *Scraper {
@@ -40,15 +49,41 @@ func NewScraper(prober *Prober, discoverer discovery.Discoverer) *Scraper {
 		discoverer: discoverer,
 		rootCtx:    ctx,
 		cancel:     cancel,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
 		Log:        zap.NewNop(),
 	}
 }
 
+// SetConcurrency caps the number of targets probed at once.
+// Zero means unlimited. Must be called before Start.
+func (s *Scraper) SetConcurrency(n int) {
+	s.maxConcurrency = n
+}
+
+// SetJitter randomizes the scrape interval by up to ±fraction of the interval,
+// to spread out load when many scrapers probe the same targets.
+// Zero disables jitter. Must be called before Start.
+func (s *Scraper) SetJitter(fraction float64) {
+	if fraction < 0 {
+		fraction = 0
+	} else if fraction > 1 {
+		fraction = 1
+	}
+	s.jitter = fraction
+}
+
 func (s *Scraper) Start(results chan<- ProbeResult, interval time.Duration) {
 	s.wg.Add(1)
 	go s.run(results, interval)
 }
 
+// LastSuccess returns when the last scrape with at least one successful probe finished.
+// Returns the zero time if there was none yet.
+func (s *Scraper) LastSuccess() time.Time {
+	return s.lastSuccess.Load()
+}
+
+// Close stops the scraper and waits for in-flight probes to finish.
 func (s *Scraper) Close() {
 	s.cancel()
 	s.wg.Wait()
@@ -59,22 +94,36 @@ func (s *Scraper) run(results chan<- ProbeResult, interval time.Duration) {
 	defer s.Log.Info("Stopping scraper")
 
 	defer s.wg.Done()
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
 	for {
 		ctx, cancel := context.WithCancel(s.rootCtx)
-		go s.scrape(ctx, results)
+		// Tracked by the wait group so Close waits for in-flight probes.
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.scrape(ctx, results)
+		}()
 
+		timer := time.NewTimer(s.nextInterval(interval))
 		select {
 		case <-s.rootCtx.Done():
+			timer.Stop()
 			cancel()
 			return
-		case <-ticker.C:
+		case <-timer.C:
 			cancel()
 		}
 	}
 }
 
+// nextInterval returns the time to wait until the next scrape.
+func (s *Scraper) nextInterval(interval time.Duration) time.Duration {
+	if s.jitter <= 0 {
+		return interval
+	}
+	offset := (s.rand.Float64()*2 - 1) * s.jitter * float64(interval)
+	return interval + time.Duration(offset)
+}
+
 func (s *Scraper) scrape(ctx context.Context, results chan<- ProbeResult) {
 	discoveryStart := time.Now()
 	targets, err := s.discoverer.DiscoverTargets(ctx)
@@ -83,27 +132,83 @@ func (s *Scraper) scrape(ctx context.Context, results chan<- ProbeResult) {
 		return
 	}
 
+	targets, numDuplicates := dedupeTargets(s.prober.sidecarTargets(targets), s.prober.defaultPort)
+	if numDuplicates > 0 {
+		s.Log.Debug("Dropped duplicate targets", zap.Int("num_duplicates", numDuplicates))
+	}
+	metricTargets.WithLabelValues(s.Group).Set(float64(len(targets)))
+
 	scrapeStart := time.Now()
 	s.Log.Debug("Scrape starting",
 		zap.Duration("discovery_duration", time.Since(discoveryStart)),
 		zap.Int("num_targets", len(targets)))
 
+	var sem chan struct{}
+	if s.maxConcurrency > 0 {
+		sem = make(chan struct{}, s.maxConcurrency)
+	}
 	var wg sync.WaitGroup
+	var numSuccess atomic.Int32
+	var numByStatus [ProbeSnapshots + 1]atomic.Int32
 	wg.Add(len(targets))
 	for _, target := range targets {
+		if sem != nil {
+			sem <- struct{}{}
+		}
 		go func(target string) {
 			defer wg.Done()
-			infos, err := s.prober.Probe(ctx, target)
-			results <- ProbeResult{
-				Time:   time.Now(),
-				Target: target,
-				Infos:  infos,
-				Err:    err,
+			if sem != nil {
+				defer func() { <-sem }()
 			}
+			res := s.prober.Probe(ctx, target)
+			if res.Status != ProbeUnreachable {
+				numSuccess.Inc()
+			}
+			numByStatus[res.Status].Inc()
+			results <- res
 		}(target)
 	}
 	wg.Wait()
+	metricLastScrape.WithLabelValues(s.Group).SetToCurrentTime()
+	for status := range numByStatus {
+		metricTargetsByStatus.WithLabelValues(s.Group, ProbeStatus(status).String()).
+			Set(float64(numByStatus[status].Load()))
+	}
+	if numSuccess.Load() > 0 {
+		s.lastSuccess.Store(time.Now())
+	}
 
 	s.Log.Debug("Scrape finished",
 		zap.Duration("scrape_duration", time.Since(scrapeStart)))
 }
+
+// dedupeTargets removes targets referring to the same host:port, keeping the first occurrence.
+// Targets without a port are assumed to use the default port.
+// Returns the remaining targets and the number of duplicates removed.
+func dedupeTargets(targets []string, defaultPort string) ([]string, int) {
+	seen := make(map[string]bool, len(targets))
+	unique := make([]string, 0, len(targets))
+	for _, target := range targets {
+		key := normalizeTarget(target, defaultPort)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, target)
+	}
+	return unique, len(targets) - len(unique)
+}
+
+// normalizeTarget returns the canonical host:port form of a target.
+func normalizeTarget(target string, defaultPort string) string {
+	host, port, err := net.SplitHostPort(withPort(target, defaultPort))
+	if err != nil {
+		return target
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		host = ip.String()
+	} else {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+	}
+	return net.JoinHostPort(host, port)
+}
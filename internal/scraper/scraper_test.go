@@ -0,0 +1,182 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/atomic"
+)
+
+func TestScraper_Concurrency(t *testing.T) {
+	const numTargets = 10
+	const maxConcurrency = 3
+
+	var inFlight, maxInFlight atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/snapshots" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		n := inFlight.Inc()
+		defer inFlight.Dec()
+		for {
+			max := maxInFlight.Load()
+			if n <= max || maxInFlight.CAS(max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	})
+
+	// Each target is a separate server.
+	targets := make([]string, numTargets)
+	for i := range targets {
+		server := httptest.NewServer(handler)
+		defer server.Close()
+		u, err := url.Parse(server.URL)
+		require.NoError(t, err)
+		targets[i] = u.Host
+	}
+	prober, err := NewProber(&types.TargetGroup{Scheme: "http"})
+	require.NoError(t, err)
+	scraper := NewScraper(prober, &types.StaticTargets{Targets: targets})
+	scraper.SetConcurrency(maxConcurrency)
+
+	results := make(chan ProbeResult)
+	scraper.Start(results, time.Minute)
+	defer scraper.Close()
+	for i := 0; i < numTargets; i++ {
+		res := <-results
+		assert.NoError(t, res.Err)
+	}
+	assert.Greater(t, maxInFlight.Load(), int32(1))
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(maxConcurrency))
+}
+
+func TestScraper_NextInterval(t *testing.T) {
+	scraper := NewScraper(nil, &types.StaticTargets{})
+	assert.Equal(t, time.Second, scraper.nextInterval(time.Second))
+
+	scraper.SetJitter(0.2)
+	for i := 0; i < 100; i++ {
+		d := scraper.nextInterval(time.Second)
+		assert.GreaterOrEqual(t, d, 800*time.Millisecond)
+		assert.LessOrEqual(t, d, 1200*time.Millisecond)
+	}
+}
+
+func TestDedupeTargets(t *testing.T) {
+	targets, numDuplicates := dedupeTargets([]string{
+		"1.2.3.4",
+		"1.2.3.4:8899",
+		"1.2.3.4:80",
+		"[2001:db8::1]:8899",
+		"[2001:db8:0:0::1]:8899",
+		"2001:db8::1",
+		"[2001:db8::1]",
+		"Node1.example.org.:8899",
+		"node1.example.org",
+	}, "8899")
+	assert.Equal(t, []string{
+		"1.2.3.4",
+		"1.2.3.4:80",
+		"[2001:db8::1]:8899",
+		"Node1.example.org.:8899",
+	}, targets)
+	assert.Equal(t, 5, numDuplicates)
+}
+
+func TestNormalizeTarget(t *testing.T) {
+	for _, tc := range []struct{ target, want string }{
+		{"1.2.3.4", "1.2.3.4:8899"},
+		{"[2001:db8::1]:8899", "[2001:db8::1]:8899"},
+		{"[2001:DB8:0::1]:80", "[2001:db8::1]:80"},
+		{"[2001:db8::1]", "[2001:db8::1]:8899"},
+		{"2001:db8::1", "[2001:db8::1]:8899"},
+		{"[::ffff:1.2.3.4]:8899", "1.2.3.4:8899"},
+	} {
+		assert.Equal(t, tc.want, normalizeTarget(tc.target, "8899"), tc.target)
+	}
+}
+
+func TestProber_DefaultPort(t *testing.T) {
+	assert.Equal(t, "80", defaultPort(&types.TargetGroup{Scheme: "http"}))
+	assert.Equal(t, "443", defaultPort(&types.TargetGroup{Scheme: "https"}))
+	assert.Equal(t, "8899", defaultPort(&types.TargetGroup{Scheme: "https", DefaultPort: 8899}))
+	assert.Equal(t, "1.2.3.4:8899", withPort("1.2.3.4", "8899"))
+	assert.Equal(t, "1.2.3.4:80", withPort("1.2.3.4:80", "8899"))
+	assert.Equal(t, "[2001:db8::1]:8899", withPort("2001:db8::1", "8899"))
+}
+
+func TestProber_SidecarPort(t *testing.T) {
+	prober, err := NewProber(&types.TargetGroup{Scheme: "http"})
+	require.NoError(t, err)
+	targets := []string{"a:8899", "b"}
+	assert.Equal(t, targets, prober.sidecarTargets(targets))
+
+	prober, err = NewProber(&types.TargetGroup{Scheme: "http", SidecarPort: 13080})
+	require.NoError(t, err)
+	assert.Equal(t,
+		[]string{"a:13080", "b:13080", "c:13080", "[2001:db8::1]:13080"},
+		prober.sidecarTargets([]string{"a:8899", "b", "c:13080", "[2001:db8::1]:8899"}))
+	assert.Equal(t, []string{"a:8899", "b"}, targets, "input unchanged")
+}
+
+func TestManager_Shutdown(t *testing.T) {
+	// Target hangs until the probe is cancelled.
+	var started atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		started.Store(true)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	results := make(chan ProbeResult, 1)
+	manager := NewManager(results)
+	manager.Update(&types.Config{
+		ScrapeInterval: time.Hour,
+		TargetGroups: []*types.TargetGroup{{
+			Group:         "test",
+			Scheme:        "http",
+			ProbeTimeout:  time.Hour,
+			StaticTargets: &types.StaticTargets{Targets: []string{u.Host}},
+		}},
+	})
+	require.Eventually(t, started.Load, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, manager.Shutdown(ctx))
+	// In-flight probe was aborted and reported before shutdown completed.
+	select {
+	case res := <-results:
+		assert.Error(t, res.Err)
+	default:
+		t.Fatal("no probe result")
+	}
+}
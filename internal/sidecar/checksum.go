@@ -0,0 +1,111 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"context"
+	"hash"
+	"io"
+	"sync"
+	"time"
+
+	"go.blockdaemon.com/solana/cluster-manager/internal/checksum"
+	"go.uber.org/zap"
+)
+
+// checksumCache computes checksums of snapshot files in the background and remembers them.
+//
+// Hashing a multi-GB file takes a while, so requests never wait for it.
+// Files are hashed one at a time to limit the disk load on the node,
+// computing all algorithms in a single pass.
+type checksumCache struct {
+	lock      sync.Mutex
+	entries   map[string]*checksumEntry
+	computing sync.Mutex
+}
+
+type checksumEntry struct {
+	size    int64
+	modTime time.Time
+	sums    map[string]string // by algorithm, nil until computed
+}
+
+// get returns the checksums of a file by algorithm if already computed.
+// Otherwise, starts computing them in the background.
+func (c *checksumCache) get(store SnapshotStore, name string, size int64, modTime time.Time, algos []string, log *zap.Logger) (map[string]string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*checksumEntry)
+	}
+	entry := c.entries[name]
+	if entry != nil && entry.size == size && entry.modTime.Equal(modTime) {
+		return entry.sums, entry.sums != nil
+	}
+	entry = &checksumEntry{size: size, modTime: modTime}
+	c.entries[name] = entry
+	go c.compute(store, name, entry, algos, log)
+	return nil, false
+}
+
+// retain forgets the checksums of files not in the given set.
+func (c *checksumCache) retain(names map[string]bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for name := range c.entries {
+		if !names[name] {
+			delete(c.entries, name)
+		}
+	}
+}
+
+func (c *checksumCache) compute(store SnapshotStore, name string, entry *checksumEntry, algos []string, log *zap.Logger) {
+	c.computing.Lock()
+	defer c.computing.Unlock()
+	sums, err := fileChecksums(store, name, algos)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err != nil {
+		log.Warn("Failed to compute snapshot checksum", zap.String("snapshot", name), zap.Error(err))
+		if c.entries[name] == entry {
+			delete(c.entries, name) // try again on next request
+		}
+		return
+	}
+	entry.sums = sums
+}
+
+// fileChecksums returns the digests of a file by algorithm, prefixed with the algorithm name.
+func fileChecksums(store SnapshotStore, name string, algos []string) (map[string]string, error) {
+	f, err := store.Open(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hashes := make([]hash.Hash, len(algos))
+	writers := make([]io.Writer, len(algos))
+	for i, algo := range algos {
+		hashes[i] = checksum.New(algo)
+		writers[i] = hashes[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string, len(algos))
+	for i, algo := range algos {
+		sums[algo] = checksum.Format(algo, hashes[i].Sum(nil))
+	}
+	return sums, nil
+}
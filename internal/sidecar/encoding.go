@@ -0,0 +1,95 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+)
+
+// wireCompression returns whether to compress a snapshot file for transfer.
+//
+// Only uncompressed archives are compressed, and only when the whole file is requested unconditionally,
+// as offsets of Range and validators of conditional requests refer to the file as stored.
+func (s *SnapshotHandler) wireCompression(c *gin.Context, name string) bool {
+	if !s.WireCompression || !strings.HasSuffix(name, ".tar") {
+		return false
+	}
+	c.Header("vary", "Accept-Encoding")
+	if c.GetHeader("range") != "" || c.GetHeader("if-none-match") != "" || c.GetHeader("if-modified-since") != "" {
+		return false
+	}
+	return acceptsEncoding(c.GetHeader("accept-encoding"), "zstd")
+}
+
+// acceptsEncoding returns whether an Accept-Encoding header lists the content coding
+// without disallowing it using a zero quality value.
+func acceptsEncoding(header string, coding string) bool {
+	for _, item := range strings.Split(header, ",") {
+		params := strings.Split(item, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), coding) {
+			continue
+		}
+		for _, param := range params[1:] {
+			if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "q" {
+				if strings.Trim(strings.TrimSpace(value), "0.") == "" {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// serveZstd sends a file compressed with zstd as the content coding.
+// The compressed size is unknown upfront, so the response has no Content-Length.
+func serveZstd(c *gin.Context, name string, modTime time.Time, rd io.Reader, log *zap.Logger) {
+	header := c.Writer.Header()
+	header.Set("content-encoding", "zstd")
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		header.Set("content-type", contentType)
+	}
+	if !modTime.IsZero() {
+		header.Set("last-modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusOK)
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+
+	enc, err := zstd.NewWriter(c.Writer)
+	if err != nil {
+		log.Error("Failed to create zstd encoder", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	_, err = io.Copy(enc, rd)
+	if closeErr := enc.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Headers are sent already, the client notices the truncated stream.
+		log.Warn("Failed to send compressed snapshot", zap.Error(err))
+	}
+}
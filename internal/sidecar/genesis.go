@@ -0,0 +1,57 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
+	"go.uber.org/zap"
+)
+
+// genesisCache remembers the genesis hash of the node until genesis.bin changes.
+type genesisCache struct {
+	lock    sync.Mutex
+	size    int64
+	modTime time.Time
+	hash    *solana.Hash
+}
+
+// get returns the genesis hash, or nil if the ledger dir has no genesis config.
+func (g *genesisCache) get(fsys fs.FS, log *zap.Logger) *solana.Hash {
+	info, err := fs.Stat(fsys, ledger.GenesisFileName)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warn("Stat failed on genesis config", zap.Error(err))
+		}
+		return nil
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.hash != nil && g.size == info.Size() && g.modTime.Equal(info.ModTime()) {
+		return g.hash
+	}
+	hash, err := ledger.GenesisHash(fsys)
+	if err != nil {
+		log.Warn("Failed to hash genesis config", zap.Error(err))
+		return nil
+	}
+	g.size, g.modTime, g.hash = info.Size(), info.ModTime(), &hash
+	return g.hash
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
+	"go.uber.org/zap"
+)
+
+var (
+	descNewestSlot = prometheus.NewDesc("solana_snapshot_newest_slot",
+		"Slot of the newest local snapshot by kind (full, incremental)",
+		[]string{"kind"}, nil)
+	descAgeSlots = prometheus.NewDesc("solana_snapshot_age_slots",
+		"Number of slots the newest local snapshot is behind the current slot of the node, by kind",
+		[]string{"kind"}, nil)
+)
+
+// SnapshotCollector exports the freshness of the newest local snapshots as Prometheus metrics.
+//
+// Metrics are computed on every scrape. Age is omitted if the current slot is not available.
+type SnapshotCollector struct {
+	LedgerDir fs.FS
+	// GetSlot returns the current slot of the node.
+	GetSlot func(ctx context.Context) (uint64, error)
+	// Timeout caps the time to get the current slot.
+	Timeout time.Duration
+	Log     *zap.Logger
+}
+
+// NewSnapshotCollector creates a collector for the snapshots in the given dir,
+// comparing them against the processed slot reported by the given HTTP RPC.
+func NewSnapshotCollector(ledgerDir string, rpcUrl string, log *zap.Logger) *SnapshotCollector {
+	client := rpc.New(rpcUrl)
+	return &SnapshotCollector{
+		LedgerDir: os.DirFS(ledgerDir),
+		GetSlot: func(ctx context.Context) (uint64, error) {
+			return client.GetSlot(ctx, rpc.CommitmentProcessed)
+		},
+		Timeout: 3 * time.Second,
+		Log:     log,
+	}
+}
+
+func (s *SnapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- descNewestSlot
+	ch <- descAgeSlots
+}
+
+func (s *SnapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	infos, err := ledger.ListSnapshots(s.LedgerDir)
+	if err != nil {
+		s.Log.Warn("Failed to list snapshots for metrics", zap.Error(err))
+		return
+	}
+	newest := make(map[string]uint64)
+	for _, info := range infos {
+		kind := "incremental"
+		if len(info.Files) > 0 && info.Files[0].IsFull() {
+			kind = "full"
+		}
+		if _, ok := newest[kind]; !ok {
+			newest[kind] = info.Slot // best first
+		}
+	}
+	if len(newest) == 0 {
+		return
+	}
+
+	var currentSlot uint64
+	if s.GetSlot != nil {
+		ctx := context.Background()
+		if s.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+			defer cancel()
+		}
+		if currentSlot, err = s.GetSlot(ctx); err != nil {
+			s.Log.Warn("Failed to get current slot for metrics", zap.Error(err))
+			currentSlot = 0
+		}
+	}
+
+	for kind, slot := range newest {
+		ch <- prometheus.MustNewConstMetric(descNewestSlot, prometheus.GaugeValue, float64(slot), kind)
+		if currentSlot == 0 {
+			continue
+		}
+		var age uint64
+		if currentSlot > slot {
+			age = currentSlot - slot
+		}
+		ch <- prometheus.MustNewConstMetric(descAgeSlots, prometheus.GaugeValue, float64(age), kind)
+	}
+}
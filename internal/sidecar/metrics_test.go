@@ -0,0 +1,59 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSnapshotCollector(t *testing.T) {
+	ledgerDir := fstest.MapFS{
+		"snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst":                 &fstest.MapFile{},
+		"snapshot-90-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst":                  &fstest.MapFile{},
+		"incremental-snapshot-100-150-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst": &fstest.MapFile{},
+	}
+	collector := &SnapshotCollector{
+		LedgerDir: ledgerDir,
+		GetSlot:   func(context.Context) (uint64, error) { return 200, nil },
+		Log:       zaptest.NewLogger(t),
+	}
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP solana_snapshot_age_slots Number of slots the newest local snapshot is behind the current slot of the node, by kind
+# TYPE solana_snapshot_age_slots gauge
+solana_snapshot_age_slots{kind="full"} 100
+solana_snapshot_age_slots{kind="incremental"} 50
+# HELP solana_snapshot_newest_slot Slot of the newest local snapshot by kind (full, incremental)
+# TYPE solana_snapshot_newest_slot gauge
+solana_snapshot_newest_slot{kind="full"} 100
+solana_snapshot_newest_slot{kind="incremental"} 150
+`)))
+
+	// Without the current slot, only the newest slots are known.
+	collector.GetSlot = func(context.Context) (uint64, error) { return 0, errors.New("rpc down") }
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(`
+# HELP solana_snapshot_newest_slot Slot of the newest local snapshot by kind (full, incremental)
+# TYPE solana_snapshot_newest_slot gauge
+solana_snapshot_newest_slot{kind="full"} 100
+solana_snapshot_newest_slot{kind="incremental"} 150
+`)))
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"net/http"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gin-gonic/gin"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/zap"
+)
+
+// NodeHandler implements the node status sidecar API methods.
+type NodeHandler struct {
+	RpcUrl string
+	Log    *zap.Logger
+}
+
+// NewNodeHandler creates a new sidecar node status API handler using the provided HTTP RPC and logger.
+func NewNodeHandler(rpcUrl string, log *zap.Logger) *NodeHandler {
+	return &NodeHandler{
+		RpcUrl: rpcUrl,
+		Log:    log,
+	}
+}
+
+// RegisterHandlers registers this API with Gin web framework.
+func (h *NodeHandler) RegisterHandlers(group gin.IRoutes) {
+	group.GET("/node_status", h.GetNodeStatus)
+}
+
+// GetNodeStatus returns the current slot and health of the Solana node, as reported by RPC "getSlot" and "getHealth".
+func (h *NodeHandler) GetNodeStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+	client := rpc.New(h.RpcUrl)
+	slot, err := client.GetSlot(ctx, rpc.CommitmentProcessed)
+	if err != nil {
+		h.Log.Error("Failed to get slot from Solana RPC", zap.Error(err))
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+	// Unhealthy nodes answer getHealth with an error.
+	health, err := client.GetHealth(ctx)
+	c.JSON(http.StatusOK, &types.NodeStatus{
+		Slot:    slot,
+		Healthy: err == nil && health == rpc.HealthOk,
+	})
+}
@@ -0,0 +1,191 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/zap"
+)
+
+// SnapshotTrigger makes the node create a snapshot at or after the given slot.
+type SnapshotTrigger func(ctx context.Context, slot uint64) error
+
+const (
+	// snapshotRequestTTL is the time requests can be polled for.
+	snapshotRequestTTL = time.Hour
+	// triggerTimeout is the max time a SnapshotTrigger may take.
+	triggerTimeout = 30 * time.Minute
+)
+
+// SnapshotRequestHandler implements the privileged sidecar API methods for requesting snapshots.
+//
+// The Solana admin RPC has no method to create a snapshot.
+// Instead, requests invoke the Trigger set by the operator, if any,
+// and are ready once a snapshot at or after the requested slot appears in the store.
+type SnapshotRequestHandler struct {
+	Store   SnapshotStore
+	Token   string          // bearer token required for all requests
+	Trigger SnapshotTrigger // optional
+	Log     *zap.Logger
+
+	lock     sync.Mutex
+	requests map[string]*types.SnapshotRequest
+}
+
+// NewSnapshotRequestHandler creates a snapshot request API handler authorizing clients by the given token.
+func NewSnapshotRequestHandler(store SnapshotStore, token string, log *zap.Logger) *SnapshotRequestHandler {
+	return &SnapshotRequestHandler{
+		Store:    store,
+		Token:    token,
+		Log:      log,
+		requests: make(map[string]*types.SnapshotRequest),
+	}
+}
+
+// RegisterHandlers registers this API with Gin web framework.
+func (h *SnapshotRequestHandler) RegisterHandlers(group gin.IRoutes) {
+	group.POST("/snapshot_requests", h.authorize, h.CreateSnapshotRequest)
+	group.GET("/snapshot_requests/:id", h.authorize, h.GetSnapshotRequest)
+}
+
+// authorize rejects requests without the bearer token.
+func (h *SnapshotRequestHandler) authorize(c *gin.Context) {
+	expected := "Bearer " + h.Token
+	if h.Token == "" || subtle.ConstantTimeCompare([]byte(c.GetHeader("authorization")), []byte(expected)) != 1 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+// CreateSnapshotRequest requests a snapshot at or after the slot given by the "slot" query param.
+//
+// Responds with the request, to be polled using GetSnapshotRequest.
+// The status is 202 Accepted if the request is pending,
+// or 200 OK if a matching snapshot exists already.
+func (h *SnapshotRequestHandler) CreateSnapshotRequest(c *gin.Context) {
+	var slot uint64
+	if param := c.Query("slot"); param != "" {
+		var err error
+		slot, err = strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid slot")
+			return
+		}
+	}
+	req := &types.SnapshotRequest{
+		ID:        newRequestID(),
+		Slot:      slot,
+		Status:    types.SnapshotRequestPending,
+		CreatedAt: time.Now(),
+	}
+	h.update(c.Request.Context(), req)
+
+	h.lock.Lock()
+	for id, old := range h.requests {
+		if time.Since(old.CreatedAt) > snapshotRequestTTL {
+			delete(h.requests, id)
+		}
+	}
+	h.requests[req.ID] = req
+	res := *req
+	h.lock.Unlock()
+
+	h.Log.Info("Snapshot requested",
+		zap.String("request_id", req.ID),
+		zap.Uint64("slot", slot),
+		zap.String("status", res.Status))
+	if res.Status != types.SnapshotRequestPending {
+		c.JSON(http.StatusOK, &res)
+		return
+	}
+	if h.Trigger != nil {
+		go h.trigger(req.ID, slot)
+	}
+	c.JSON(http.StatusAccepted, &res)
+}
+
+// GetSnapshotRequest returns the status of a snapshot request.
+func (h *SnapshotRequestHandler) GetSnapshotRequest(c *gin.Context) {
+	h.lock.Lock()
+	req, ok := h.requests[c.Param("id")]
+	var res types.SnapshotRequest
+	if ok {
+		res = *req
+	}
+	h.lock.Unlock()
+	if !ok {
+		c.String(http.StatusNotFound, "unknown snapshot request")
+		return
+	}
+	h.update(c.Request.Context(), &res)
+
+	h.lock.Lock()
+	if res.Status != req.Status && req.Status == types.SnapshotRequestPending {
+		*req = res
+	}
+	res = *req
+	h.lock.Unlock()
+	c.JSON(http.StatusOK, &res)
+}
+
+// update marks a pending request as ready if the store has a matching snapshot.
+func (h *SnapshotRequestHandler) update(ctx context.Context, req *types.SnapshotRequest) {
+	if req.Status != types.SnapshotRequestPending {
+		return
+	}
+	files, err := h.Store.List(ctx)
+	if err != nil {
+		h.Log.Error("Failed to list snapshots", zap.Error(err))
+		return
+	}
+	// Files are sorted best first.
+	if len(files) > 0 && files[0].Slot >= req.Slot {
+		req.Status = types.SnapshotRequestReady
+		req.File = files[0]
+	}
+}
+
+// trigger invokes the snapshot trigger, failing the request if it fails.
+func (h *SnapshotRequestHandler) trigger(id string, slot uint64) {
+	ctx, cancel := context.WithTimeout(context.Background(), triggerTimeout)
+	defer cancel()
+	err := h.Trigger(ctx, slot)
+	if err == nil {
+		return
+	}
+	h.Log.Error("Failed to trigger snapshot", zap.String("request_id", id), zap.Error(err))
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if req, ok := h.requests[id]; ok && req.Status == types.SnapshotRequestPending {
+		req.Status = types.SnapshotRequestFailed
+		req.Error = err.Error()
+	}
+}
+
+// newRequestID returns a random snapshot request ID.
+func newRequestID() string {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -17,28 +17,49 @@ package sidecar
 
 import (
 	"errors"
-	"io"
 	"io/fs"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.blockdaemon.com/solana/cluster-manager/internal/checksum"
 	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
 	"go.blockdaemon.com/solana/cluster-manager/types"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 )
 
 // SnapshotHandler implements the snapshot-related sidecar API methods.
 type SnapshotHandler struct {
-	LedgerDir fs.FS
-	Log       *zap.Logger
+	Store SnapshotStore
+	// GenesisDir holds the genesis config of the node, if it is advertised.
+	GenesisDir fs.FS
+	Log        *zap.Logger
+
+	// MaxConcurrentUploads caps the number of snapshot downloads served at once, zero for unlimited.
+	// Excess requests are rejected with 503 Service Unavailable and a Retry-After header.
+	MaxConcurrentUploads int
+	// MaxUploadBytesPerSec caps the upload speed of each snapshot download, zero for unlimited.
+	MaxUploadBytesPerSec int64
+	// ChecksumAlgorithms are the checksums offered for verifying downloads, the first being the default.
+	// Defaults to SHA-256 only.
+	ChecksumAlgorithms []string
+	// WireCompression compresses uncompressed snapshots with zstd for clients accepting it as content coding.
+	// Compressed snapshots are always served as is.
+	WireCompression bool
+
+	checksums checksumCache
+	genesis   genesisCache
+	uploads   atomic.Int32
 }
 
 // NewSnapshotHandler creates a new sidecar snapshot API handler using the provided ledger dir and logger.
 func NewSnapshotHandler(ledgerDir string, log *zap.Logger) *SnapshotHandler {
 	return &SnapshotHandler{
-		LedgerDir: os.DirFS(ledgerDir),
-		Log:       log,
+		Store:      NewFSStore(ledgerDir),
+		GenesisDir: os.DirFS(ledgerDir),
+		Log:        log,
 	}
 }
 
@@ -51,25 +72,104 @@ func (s *SnapshotHandler) RegisterHandlers(group gin.IRoutes) {
 	group.GET("/snapshot.tar.zst", s.DownloadBestSnapshot)
 	group.HEAD("/snapshot/:name", s.DownloadSnapshot)
 	group.GET("/snapshot/:name", s.DownloadSnapshot)
+	group.GET("/snapshot/:name/checksum", s.GetSnapshotChecksum)
 }
 
 // ListSnapshots is an API handler listing available snapshots on the node.
 func (s *SnapshotHandler) ListSnapshots(c *gin.Context) {
-	infos, err := ledger.ListSnapshots(s.LedgerDir)
+	files, err := s.Store.List(c.Request.Context())
 	if err != nil {
 		s.Log.Error("Failed to list snapshots", zap.Error(err))
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	if infos == nil {
-		infos = make([]*types.SnapshotInfo, 0)
+	infos := ledger.BuildSnapshotInfos(files)
+	s.warmChecksums(files)
+	if s.GenesisDir != nil {
+		if hash := s.genesis.get(s.GenesisDir, s.Log); hash != nil {
+			for _, info := range infos {
+				info.GenesisHash = hash
+			}
+		}
 	}
 	c.JSON(http.StatusOK, infos)
 }
 
+// warmChecksums starts computing checksums of the listed snapshot files,
+// so they are ready by the time clients download them.
+func (s *SnapshotHandler) warmChecksums(files []*types.SnapshotFile) {
+	names := make(map[string]bool, len(files))
+	for _, file := range files {
+		names[file.FileName] = true
+		if file.ModTime != nil {
+			s.checksums.get(s.Store, file.FileName, int64(file.Size), *file.ModTime, s.checksumAlgorithms(), s.Log)
+		}
+	}
+	s.checksums.retain(names)
+}
+
+// checksumAlgorithms returns the checksum algorithms offered, the first being the default.
+func (s *SnapshotHandler) checksumAlgorithms() []string {
+	if len(s.ChecksumAlgorithms) == 0 {
+		return []string{checksum.SHA256}
+	}
+	return s.ChecksumAlgorithms
+}
+
+// ChecksumAlgorithmsHeader lists the checksum algorithms offered by the sidecar.
+const ChecksumAlgorithmsHeader = "X-Checksum-Algorithms"
+
+// GetSnapshotChecksum returns the checksum of a snapshot file as "<algorithm>:<hex digest>".
+//
+// The algorithm is selected by the "algo" query param, defaulting to the first offered one.
+// Offered algorithms are listed in the X-Checksum-Algorithms header.
+// Checksums are computed in the background.
+// Responds with 404 Not Found until the checksum is available, or if the algorithm is not offered.
+func (s *SnapshotHandler) GetSnapshotChecksum(c *gin.Context) {
+	algos := s.checksumAlgorithms()
+	c.Header(ChecksumAlgorithmsHeader, strings.Join(algos, ", "))
+	algo := c.Query("algo")
+	if algo == "" {
+		algo = algos[0]
+	}
+	if !containsString(algos, algo) {
+		c.String(http.StatusNotFound, "checksum algorithm not offered")
+		return
+	}
+	name := c.Param("name")
+	if ledger.ParseSnapshotFileName(name) == nil {
+		returnSnapshotNotFound(c)
+		return
+	}
+	info, err := s.Store.Stat(c.Request.Context(), name)
+	if errors.Is(err, fs.ErrNotExist) {
+		returnSnapshotNotFound(c)
+		return
+	} else if err != nil {
+		s.Log.Error("Stat failed on snapshot", zap.String("snapshot", name), zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	sums, ok := s.checksums.get(s.Store, name, info.Size(), info.ModTime(), algos, s.Log)
+	if !ok {
+		c.String(http.StatusNotFound, "checksum not available yet")
+		return
+	}
+	c.String(http.StatusOK, sums[algo])
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 // DownloadBestSnapshot selects the best full snapshot and sends it to the client.
 func (s *SnapshotHandler) DownloadBestSnapshot(c *gin.Context) {
-	files, err := ledger.ListSnapshotFiles(s.LedgerDir)
+	files, err := s.Store.List(c.Request.Context())
 	if err != nil {
 		s.Log.Error("Failed to list snapshot files", zap.Error(err))
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -108,9 +208,25 @@ func (s *SnapshotHandler) DownloadSnapshot(c *gin.Context) {
 
 func (s *SnapshotHandler) serveSnapshot(c *gin.Context, name string) {
 	log := s.Log.With(zap.String("snapshot", name))
+	if requestID := c.GetHeader("x-request-id"); requestID != "" {
+		log = log.With(zap.String("request_id", requestID))
+	}
+
+	// Protect the network of the node from too many downloads at once.
+	if c.Request.Method != http.MethodHead {
+		release, ok := s.acquireUpload()
+		if !ok {
+			log.Info("Rejecting snapshot download, too many uploads in progress")
+			c.Header("retry-after", retryAfterHeader(uploadRetryAfter))
+			c.String(http.StatusServiceUnavailable, "too many uploads in progress")
+			return
+		}
+		defer release()
+	}
 
 	// Open file.
-	baseFile, err := s.LedgerDir.Open(name)
+	ctx := c.Request.Context()
+	snapFile, err := s.Store.Open(ctx, name)
 	if errors.Is(err, fs.ErrNotExist) {
 		log.Info("Requested snapshot not found")
 		returnSnapshotNotFound(c)
@@ -120,22 +236,26 @@ func (s *SnapshotHandler) serveSnapshot(c *gin.Context, name string) {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	defer baseFile.Close()
-	snapFile, ok := baseFile.(io.ReadSeeker)
-	if !ok {
-		log.Error("Snapshot file is not an io.ReedSeeker")
-		c.AbortWithStatus(http.StatusInternalServerError)
-		return
-	}
+	defer snapFile.Close()
 
-	info, err := baseFile.Stat()
+	info, err := s.Store.Stat(ctx, name)
 	if err != nil {
 		log.Warn("Stat failed on snapshot", zap.String("snapshot", name), zap.Error(err))
 		returnSnapshotNotFound(c)
 		return
 	}
 
-	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), snapFile)
+	// Lets clients skip downloading files they already have using If-None-Match.
+	if file := ledger.ParseSnapshotFileName(name); file != nil {
+		c.Header("etag", file.ETag())
+	}
+	rd := newThrottledReadSeeker(ctx, snapFile, s.MaxUploadBytesPerSec)
+	if s.wireCompression(c, name) {
+		serveZstd(c, name, info.ModTime(), rd, log)
+		return
+	}
+	// Answers Range requests with 206 Partial Content, seeking the store to the requested offset.
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), rd)
 }
 
 func returnSnapshotNotFound(c *gin.Context) {
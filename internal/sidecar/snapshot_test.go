@@ -15,13 +15,20 @@
 package sidecar
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.blockdaemon.com/solana/cluster-manager/types"
 	"go.uber.org/zap/zaptest"
 )
 
@@ -47,3 +54,238 @@ func TestHandler_ListSnapshots_Error(t *testing.T) {
 	res := testRequest(h, req)
 	assert.Equal(t, http.StatusInternalServerError, res.Code)
 }
+
+func TestHandler_GetSnapshotChecksum(t *testing.T) {
+	const name = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	h := &SnapshotHandler{
+		Store: &FSStore{FS: fstest.MapFS{name: &fstest.MapFile{Data: []byte("hello")}}},
+		Log:   zaptest.NewLogger(t),
+	}
+	router := newRouter(h)
+	get := func(name string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/snapshot/"+name+"/checksum", nil)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, get("snapshot-101-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst").Code)
+	assert.Equal(t, http.StatusNotFound, get(name).Code, "computed in the background")
+	assert.Eventually(t, func() bool {
+		return get(name).Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", get(name).Body.String())
+}
+
+func TestHandler_GetSnapshotChecksum_Algorithms(t *testing.T) {
+	const name = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	h := &SnapshotHandler{
+		Store:              &FSStore{FS: fstest.MapFS{name: &fstest.MapFile{Data: []byte("hello")}}},
+		Log:                zaptest.NewLogger(t),
+		ChecksumAlgorithms: []string{"xxh3", "blake3"},
+	}
+	router := newRouter(h)
+	get := func(query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/snapshot/"+name+"/checksum"+query, nil)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Eventually(t, func() bool {
+		return get("").Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	res := get("")
+	assert.Equal(t, "xxh3:9555e8555c62dcfd", res.Body.String(), "first algorithm is the default")
+	assert.Equal(t, "xxh3, blake3", res.Header().Get(ChecksumAlgorithmsHeader))
+	assert.Equal(t, "blake3:ea8f163db38682925e4491c5e58d4bb3506ef8c14eb78a86e908c5624a67200f", get("?algo=blake3").Body.String())
+	res = get("?algo=sha256")
+	assert.Equal(t, http.StatusNotFound, res.Code, "not offered")
+	assert.Equal(t, "xxh3, blake3", res.Header().Get(ChecksumAlgorithmsHeader))
+}
+
+func TestHandler_DownloadSnapshot_ETag(t *testing.T) {
+	const name = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	const etag = `"0-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"`
+	h := &SnapshotHandler{
+		Store: &FSStore{FS: fstest.MapFS{name: &fstest.MapFile{Data: []byte("hello")}}},
+		Log:   zaptest.NewLogger(t),
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/snapshot/"+name, nil)
+	require.NoError(t, err)
+	res := testRequest(h, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, etag, res.Header().Get("etag"))
+	assert.Equal(t, "hello", res.Body.String())
+
+	req.Header.Set("if-none-match", etag)
+	res = testRequest(h, req)
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Empty(t, res.Body.String())
+}
+
+func TestHandler_ListSnapshots_GenesisHash(t *testing.T) {
+	const name = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	h := &SnapshotHandler{
+		Store:      &FSStore{FS: fstest.MapFS{name: &fstest.MapFile{Data: []byte("hello")}}},
+		GenesisDir: fstest.MapFS{"genesis.bin": &fstest.MapFile{Data: []byte("hello")}},
+		Log:        zaptest.NewLogger(t),
+	}
+	req, err := http.NewRequest(http.MethodGet, "/snapshots", nil)
+	require.NoError(t, err)
+	res := testRequest(h, req)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	var infos []*types.SnapshotInfo
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &infos))
+	require.Len(t, infos, 1)
+	require.NotNil(t, infos[0].GenesisHash)
+	assert.Equal(t, "42TEXg1vFAbcJ65y7qdYG9iCPvYfy3NDdVLd75akX2P5", infos[0].GenesisHash.String())
+}
+
+func TestHandler_InProgress(t *testing.T) {
+	const complete = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	const incomplete = "snapshot-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	h := &SnapshotHandler{
+		Store: &FSStore{FS: fstest.MapFS{
+			complete:                &fstest.MapFile{Data: []byte("hello")},
+			incomplete:              &fstest.MapFile{Data: []byte("hel")},
+			incomplete + ".partial": &fstest.MapFile{},
+		}},
+		Log: zaptest.NewLogger(t),
+	}
+	req, err := http.NewRequest(http.MethodGet, "/snapshots", nil)
+	require.NoError(t, err)
+	res := testRequest(h, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	var infos []*types.SnapshotInfo
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &infos))
+	require.Len(t, infos, 1)
+	assert.Equal(t, uint64(100), infos[0].Slot)
+
+	req, err = http.NewRequest(http.MethodGet, "/snapshot/"+incomplete, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, testRequest(h, req).Code)
+}
+
+func TestHandler_DownloadSnapshot_MaxConcurrentUploads(t *testing.T) {
+	const name = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	h := &SnapshotHandler{
+		Store:                &FSStore{FS: fstest.MapFS{name: &fstest.MapFile{Data: []byte("hello")}}},
+		Log:                  zaptest.NewLogger(t),
+		MaxConcurrentUploads: 1,
+	}
+	get := func(method string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "/snapshot/"+name, nil)
+		require.NoError(t, err)
+		return testRequest(h, req)
+	}
+
+	res := get(http.MethodGet)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "hello", res.Body.String())
+
+	// Simulate an upload in progress.
+	release, ok := h.acquireUpload()
+	require.True(t, ok)
+	res = get(http.MethodGet)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "10", res.Header().Get("retry-after"))
+	assert.Equal(t, http.StatusOK, get(http.MethodHead).Code, "HEAD requests are not limited")
+
+	release()
+	assert.Equal(t, http.StatusOK, get(http.MethodGet).Code)
+}
+
+func TestHandler_DownloadSnapshot_MaxUploadBytesPerSec(t *testing.T) {
+	const name = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	data := make([]byte, 96*1024)
+	h := &SnapshotHandler{
+		Store:                &FSStore{FS: fstest.MapFS{name: &fstest.MapFile{Data: data}}},
+		Log:                  zaptest.NewLogger(t),
+		MaxUploadBytesPerSec: 32 * 1024,
+	}
+	req, err := http.NewRequest(http.MethodGet, "/snapshot/"+name, nil)
+	require.NoError(t, err)
+	req.Header.Set("range", "bytes=32768-")
+
+	start := time.Now()
+	res := testRequest(h, req)
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, data[32*1024:], res.Body.Bytes())
+	// The burst covers the first 32 KiB, the remaining 32 KiB take about a second.
+	assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestHandler_DownloadSnapshot_WireCompression(t *testing.T) {
+	const tarName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar"
+	const zstName = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	data := bytes.Repeat([]byte("hello"), 1000)
+	h := &SnapshotHandler{
+		Store: &FSStore{FS: fstest.MapFS{
+			tarName: &fstest.MapFile{Data: data},
+			zstName: &fstest.MapFile{Data: data},
+		}},
+		Log:             zaptest.NewLogger(t),
+		WireCompression: true,
+	}
+	get := func(name string, header http.Header) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/snapshot/"+name, nil)
+		require.NoError(t, err)
+		req.Header = header
+		return testRequest(h, req)
+	}
+
+	res := get(tarName, http.Header{"Accept-Encoding": {"gzip, zstd"}})
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "zstd", res.Header().Get("content-encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header().Get("vary"))
+	assert.Empty(t, res.Header().Get("content-length"))
+	assert.Less(t, res.Body.Len(), len(data))
+	dec, err := zstd.NewReader(res.Body)
+	require.NoError(t, err)
+	defer dec.Close()
+	decoded, err := io.ReadAll(dec)
+	require.NoError(t, err)
+	assert.Equal(t, data, decoded)
+
+	res = get(zstName, http.Header{"Accept-Encoding": {"zstd"}})
+	assert.Empty(t, res.Header().Get("content-encoding"), "already compressed")
+	assert.Equal(t, data, res.Body.Bytes())
+
+	res = get(tarName, http.Header{"Accept-Encoding": {"zstd;q=0"}})
+	assert.Empty(t, res.Header().Get("content-encoding"), "not accepted")
+	assert.Equal(t, data, res.Body.Bytes())
+
+	res = get(tarName, http.Header{"Accept-Encoding": {"zstd"}, "Range": {"bytes=5-"}})
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Empty(t, res.Header().Get("content-encoding"), "range request")
+	assert.Equal(t, data[5:], res.Body.Bytes())
+
+	h.WireCompression = false
+	res = get(tarName, http.Header{"Accept-Encoding": {"zstd"}})
+	assert.Empty(t, res.Header().Get("content-encoding"), "disabled")
+	assert.Equal(t, data, res.Body.Bytes())
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	cases := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"zstd", true},
+		{"gzip, ZSTD", true},
+		{"gzip;q=1.0, zstd;q=0.5", true},
+		{"zstd;q=0", false},
+		{"zstd; q=0.000", false},
+		{"gzip", false},
+		{"*", false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, acceptsEncoding(tc.header, "zstd"), tc.header)
+	}
+}
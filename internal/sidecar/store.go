@@ -0,0 +1,147 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"go.blockdaemon.com/solana/cluster-manager/internal/ledger"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// SnapshotStore provides the snapshot files served by the sidecar.
+//
+// Stat and Open fail with fs.ErrNotExist if the snapshot file doesn't exist.
+type SnapshotStore interface {
+	// List returns all snapshot files, sorted best-to-worst.
+	List(ctx context.Context) ([]*types.SnapshotFile, error)
+	Open(ctx context.Context, name string) (io.ReadSeekCloser, error)
+	Stat(ctx context.Context, name string) (fs.FileInfo, error)
+}
+
+// FSStore serves snapshot files from a ledger dir.
+type FSStore struct {
+	FS fs.FS
+}
+
+// NewFSStore creates a snapshot store serving the snapshot files in the given dir.
+func NewFSStore(dir string) *FSStore {
+	return &FSStore{FS: os.DirFS(dir)}
+}
+
+func (s *FSStore) List(_ context.Context) ([]*types.SnapshotFile, error) {
+	return ledger.ListSnapshotFiles(s.FS)
+}
+
+func (s *FSStore) Open(_ context.Context, name string) (io.ReadSeekCloser, error) {
+	// Incomplete files must not be served, see ledger.InProgress.
+	if ledger.InProgress(s.FS, name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	snapFile, ok := f.(io.ReadSeekCloser)
+	if !ok {
+		_ = f.Close()
+		return nil, fmt.Errorf("snapshot file %s is not seekable", name)
+	}
+	return snapFile, nil
+}
+
+func (s *FSStore) Stat(_ context.Context, name string) (fs.FileInfo, error) {
+	return fs.Stat(s.FS, name)
+}
+
+// ObjectStore serves snapshot files from an S3-compatible bucket, such as S3 or GCS.
+//
+// This allows running a snapshot hub fronting a bucket, without a Solana node.
+type ObjectStore struct {
+	Client *minio.Client
+	Bucket string
+	Prefix string // prefix of snapshot object names, e.g. "mainnet/"
+}
+
+func (s *ObjectStore) List(ctx context.Context) ([]*types.SnapshotFile, error) {
+	var files []*types.SnapshotFile
+	for obj := range s.Client.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Prefix: s.Prefix}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list bucket: %w", obj.Err)
+		}
+		file := ledger.ParseSnapshotFileName(strings.TrimPrefix(obj.Key, s.Prefix))
+		if file == nil {
+			continue
+		}
+		file.Size = uint64(obj.Size)
+		if !obj.LastModified.IsZero() {
+			modTime := obj.LastModified
+			file.ModTime = &modTime
+		}
+		files = append(files, file)
+	}
+	types.SortSnapshots(files)
+	return files, nil
+}
+
+func (s *ObjectStore) Open(ctx context.Context, name string) (io.ReadSeekCloser, error) {
+	obj, err := s.Client.GetObject(ctx, s.Bucket, s.Prefix+name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, objectError("open", name, err)
+	}
+	// GetObject is lazy, check whether the object exists before serving it.
+	if _, err := obj.Stat(); err != nil {
+		_ = obj.Close()
+		return nil, objectError("open", name, err)
+	}
+	return obj, nil
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, name string) (fs.FileInfo, error) {
+	info, err := s.Client.StatObject(ctx, s.Bucket, s.Prefix+name, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, objectError("stat", name, err)
+	}
+	return &objectFileInfo{name: name, info: info}, nil
+}
+
+// objectError maps missing objects to fs.ErrNotExist.
+func objectError(op string, name string, err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// objectFileInfo implements fs.FileInfo for a bucket object.
+type objectFileInfo struct {
+	name string
+	info minio.ObjectInfo
+}
+
+func (o *objectFileInfo) Name() string       { return o.name }
+func (o *objectFileInfo) Size() int64        { return o.info.Size }
+func (o *objectFileInfo) Mode() fs.FileMode  { return 0444 }
+func (o *objectFileInfo) ModTime() time.Time { return o.info.LastModified }
+func (o *objectFileInfo) IsDir() bool        { return false }
+func (o *objectFileInfo) Sys() interface{}   { return o.info }
@@ -0,0 +1,151 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeBucket is a minimal S3 API serving objects from memory.
+type fakeBucket map[string]string
+
+func (b fakeBucket) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	if r.URL.Path == "/bucket/" || r.URL.Path == "/bucket" {
+		type object struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}
+		var res struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Name     string
+			Contents []object
+		}
+		res.Name = "bucket"
+		for name, data := range b {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				res.Contents = append(res.Contents, object{Key: name, Size: int64(len(data)), LastModified: time.Unix(1000, 0).UTC()})
+			}
+		}
+		w.Header().Set("content-type", "application/xml")
+		_ = xml.NewEncoder(w).Encode(&res)
+		return
+	}
+	data, ok := b[key]
+	if !ok {
+		w.Header().Set("content-type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `<Error><Code>NoSuchKey</Code></Error>`)
+		return
+	}
+	w.Header().Set("etag", `"abc"`)
+	http.ServeContent(w, r, key, time.Unix(1000, 0), strings.NewReader(data))
+}
+
+func TestObjectStore(t *testing.T) {
+	const name = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	server := httptest.NewServer(fakeBucket{
+		"mainnet/" + name:     "hello",
+		"mainnet/README":      "not a snapshot",
+		"testnet/" + name:     "other",
+		"mainnet/genesis.bin": "genesis",
+	})
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4("key", "secret", ""),
+		Region: "us-east-1",
+	})
+	require.NoError(t, err)
+	store := &ObjectStore{Client: client, Bucket: "bucket", Prefix: "mainnet/"}
+	ctx := context.Background()
+
+	files, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, name, files[0].FileName)
+	assert.Equal(t, uint64(5), files[0].Size)
+	require.NotNil(t, files[0].ModTime)
+
+	info, err := store.Stat(ctx, name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size())
+
+	f, err := store.Open(ctx, name)
+	require.NoError(t, err)
+	_, err = f.Seek(1, io.SeekStart)
+	require.NoError(t, err)
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "ello", string(data))
+	require.NoError(t, f.Close())
+
+	_, err = store.Stat(ctx, "snapshot-101-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = store.Open(ctx, "snapshot-101-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestHandler_DownloadSnapshot_ObjectStoreRange(t *testing.T) {
+	const name = "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"
+	var ranges []string
+	bucket := fakeBucket{name: "0123456789"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("range") != "" {
+			ranges = append(ranges, r.Header.Get("range"))
+		}
+		bucket.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4("key", "secret", ""),
+		Region: "us-east-1",
+	})
+	require.NoError(t, err)
+	h := &SnapshotHandler{
+		Store: &ObjectStore{Client: client, Bucket: "bucket"},
+		Log:   zaptest.NewLogger(t),
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/snapshot/"+name, nil)
+	require.NoError(t, err)
+	req.Header.Set("range", "bytes=2-5")
+	res := testRequest(h, req)
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, "bytes 2-5/10", res.Header().Get("content-range"))
+	assert.Equal(t, "bytes", res.Header().Get("accept-ranges"))
+	assert.Equal(t, "2345", res.Body.String())
+	// Only the requested part is fetched from the bucket.
+	assert.Contains(t, ranges, "bytes=2-")
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// uploadRetryAfter is the time clients are asked to wait when all upload slots are taken.
+const uploadRetryAfter = 10 * time.Second
+
+// acquireUpload takes an upload slot, returning false if MaxConcurrentUploads are in progress.
+func (s *SnapshotHandler) acquireUpload() (release func(), ok bool) {
+	if s.MaxConcurrentUploads <= 0 {
+		return func() {}, true
+	}
+	if int(s.uploads.Inc()) > s.MaxConcurrentUploads {
+		s.uploads.Dec()
+		return nil, false
+	}
+	return func() { s.uploads.Dec() }, true
+}
+
+// retryAfterHeader formats a duration as the value of a Retry-After header.
+func retryAfterHeader(d time.Duration) string {
+	return strconv.Itoa(int(d / time.Second))
+}
+
+// throttledReadSeeker delays reads to stay within the upload rate of a single download.
+type throttledReadSeeker struct {
+	ctx     context.Context
+	rd      io.ReadSeeker
+	limiter *rate.Limiter
+}
+
+func newThrottledReadSeeker(ctx context.Context, rd io.ReadSeeker, bytesPerSec int64) io.ReadSeeker {
+	if bytesPerSec <= 0 {
+		return rd
+	}
+	burst := int(bytesPerSec)
+	if burst < 32*1024 {
+		burst = 32 * 1024
+	}
+	return &throttledReadSeeker{
+		ctx:     ctx,
+		rd:      rd,
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSec), burst),
+	}
+}
+
+func (t *throttledReadSeeker) Read(p []byte) (int, error) {
+	if burst := t.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := t.rd.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+func (t *throttledReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return t.rd.Seek(offset, whence)
+}
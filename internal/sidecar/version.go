@@ -0,0 +1,53 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sidecar
+
+import (
+	"net/http"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// VersionHandler implements the version-related sidecar API methods.
+type VersionHandler struct {
+	RpcUrl string
+	Log    *zap.Logger
+}
+
+// NewVersionHandler creates a new sidecar version API handler using the provided HTTP RPC and logger.
+func NewVersionHandler(rpcUrl string, log *zap.Logger) *VersionHandler {
+	return &VersionHandler{
+		RpcUrl: rpcUrl,
+		Log:    log,
+	}
+}
+
+// RegisterHandlers registers this API with Gin web framework.
+func (h *VersionHandler) RegisterHandlers(group gin.IRoutes) {
+	group.GET("/version", h.GetVersion)
+}
+
+// GetVersion returns the software version of the Solana node, as reported by RPC "getVersion".
+func (h *VersionHandler) GetVersion(c *gin.Context) {
+	version, err := rpc.New(h.RpcUrl).GetVersion(c.Request.Context())
+	if err != nil {
+		h.Log.Error("Failed to get version from Solana RPC", zap.Error(err))
+		c.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+	c.JSON(http.StatusOK, version)
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracker
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.blockdaemon.com/solana/cluster-manager/internal/index"
+)
+
+// HealthHandler implements liveness and readiness probes.
+type HealthHandler struct {
+	DB *index.DB
+	// LastScrape returns when the last successful scrape finished.
+	LastScrape func() time.Time
+	// MaxScrapeAge is how long ago the last successful scrape may be for the tracker to be ready.
+	MaxScrapeAge time.Duration
+}
+
+// RegisterHandlers registers the /healthz and /readyz endpoints.
+func (h *HealthHandler) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.Healthz)
+	mux.HandleFunc("/readyz", h.Readyz)
+}
+
+// Healthz reports that the process is up.
+func (h *HealthHandler) Healthz(wr http.ResponseWriter, _ *http.Request) {
+	http.Error(wr, "ok", http.StatusOK)
+}
+
+// Readyz reports whether the tracker has recent snapshot info.
+func (h *HealthHandler) Readyz(wr http.ResponseWriter, _ *http.Request) {
+	lastScrape := h.LastScrape()
+	if lastScrape.IsZero() {
+		http.Error(wr, "no successful scrape yet", http.StatusServiceUnavailable)
+		return
+	}
+	if age := time.Since(lastScrape); age > h.MaxScrapeAge {
+		http.Error(wr, fmt.Sprintf("last successful scrape was %s ago", age.Round(time.Second)), http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(wr, fmt.Sprintf("ok, %d snapshots", len(h.DB.GetAllSnapshots())), http.StatusOK)
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.blockdaemon.com/solana/cluster-manager/internal/index"
+	"go.blockdaemon.com/solana/cluster-manager/types"
+)
+
+// manifestState tracks the generation of the manifest across requests.
+type manifestState struct {
+	lock       sync.Mutex
+	generation uint64
+	snapshots  []byte // JSON of the snapshots at generation
+}
+
+// GetManifest returns the manifest of all known snapshots.
+//
+// If the "since" query parameter matches the current generation, responds with 304 Not Modified instead.
+// The generation starts at the startup time in milliseconds,
+// such that it keeps increasing across restarts.
+func (h *Handler) GetManifest(c *gin.Context) {
+	var query struct {
+		Since uint64 `form:"since"`
+	}
+	if err := c.BindQuery(&query); err != nil {
+		return
+	}
+	manifest := h.manifest()
+	if query.Since != 0 && query.Since == manifest.Generation {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if h.ManifestKey != nil {
+		manifest.Sign(h.ManifestKey)
+	}
+	c.JSON(http.StatusOK, manifest)
+}
+
+// manifest builds the current manifest, advancing the generation if the snapshots changed.
+func (h *Handler) manifest() *types.Manifest {
+	snapshots := buildManifest(h.DB.GetAllSnapshots())
+	snapshotsJSON, err := json.Marshal(snapshots)
+	if err != nil {
+		panic(err)
+	}
+
+	h.manifestState.lock.Lock()
+	defer h.manifestState.lock.Unlock()
+	state := &h.manifestState
+	if state.generation == 0 {
+		state.generation = uint64(time.Now().UnixMilli())
+	} else if !bytes.Equal(state.snapshots, snapshotsJSON) {
+		state.generation++
+	}
+	state.snapshots = snapshotsJSON
+	return &types.Manifest{
+		Generation: state.generation,
+		Snapshots:  snapshots,
+	}
+}
+
+// buildManifest groups snapshot entries by snapshot, newest first.
+func buildManifest(entries []*index.SnapshotEntry) []types.ManifestSnapshot {
+	type snapshotKey struct {
+		slot uint64
+		hash string
+	}
+	byKey := make(map[snapshotKey]*types.ManifestSnapshot)
+	for _, entry := range entries {
+		info := entry.Info
+		key := snapshotKey{slot: info.Slot, hash: info.Hash.String()}
+		snap, ok := byKey[key]
+		if !ok {
+			snap = &types.ManifestSnapshot{
+				Slot: info.Slot,
+				Hash: info.Hash,
+				Size: info.TotalSize,
+			}
+			for _, file := range info.Files {
+				if file.Slot == info.Slot {
+					snap.BaseSlot = file.BaseSlot
+				}
+			}
+			byKey[key] = snap
+		}
+		snap.Sources = append(snap.Sources, entry.Target)
+	}
+
+	snapshots := make([]types.ManifestSnapshot, 0, len(byKey))
+	for _, snap := range byKey {
+		sort.Strings(snap.Sources)
+		snapshots = append(snapshots, *snap)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].Slot != snapshots[j].Slot {
+			return snapshots[i].Slot > snapshots[j].Slot
+		}
+		return snapshots[i].Hash.String() < snapshots[j].Hash.String()
+	})
+	return snapshots
+}
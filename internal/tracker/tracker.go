@@ -16,8 +16,11 @@
 package tracker
 
 import (
+	"math"
 	"net/http"
+	"time"
 
+	"github.com/gagliardetto/solana-go"
 	"github.com/gin-gonic/gin"
 	"go.blockdaemon.com/solana/cluster-manager/internal/index"
 	"go.blockdaemon.com/solana/cluster-manager/types"
@@ -26,6 +29,10 @@ import (
 // Handler implements the tracker API methods.
 type Handler struct {
 	DB *index.DB
+	// ManifestKey signs manifests if set.
+	ManifestKey []byte
+
+	manifestState manifestState
 }
 
 // NewHandler creates a new tracker API using the provided database.
@@ -37,32 +44,93 @@ func NewHandler(db *index.DB) *Handler {
 func (h *Handler) RegisterHandlers(group gin.IRoutes) {
 	group.GET("/snapshots", h.GetSnapshots)
 	group.GET("/best_snapshots", h.GetBestSnapshots)
+	group.GET("/manifest", h.GetManifest)
+	group.GET("/sources", h.GetSources)
 }
 
 func (h *Handler) GetSnapshots(c *gin.Context) {
 	c.JSON(http.StatusOK, h.DB.GetAllSnapshots())
 }
 
-// GetBestSnapshots returns the currently available best snapshots.
+// MaxBestSnapshots caps the number of snapshots returned by GetBestSnapshots.
+const MaxBestSnapshots = 25
+
+// GetBestSnapshots returns the currently available best snapshots, best first.
+//
+// Returns up to "max" snapshots, capped at MaxBestSnapshots (also used if "max" is unset or negative).
+// Optionally filters by slot number using the "min_slot" and "max_slot" query parameters,
+// and skips snapshots not seen by a scrape within the "max_age" duration (e.g. "5m").
+// With "base_slot", only incremental snapshots based on the full snapshot at that slot are returned.
 func (h *Handler) GetBestSnapshots(c *gin.Context) {
 	var query struct {
-		Max int `form:"max"`
+		Max      int           `form:"max"`
+		MinSlot  uint64        `form:"min_slot"`
+		MaxSlot  uint64        `form:"max_slot"`
+		MaxAge   time.Duration `form:"max_age"`
+		BaseSlot uint64        `form:"base_slot"`
 	}
 	if err := c.BindQuery(&query); err != nil {
 		return
 	}
-	const maxItems = 25
-	if query.Max < 0 || query.Max > 25 {
-		query.Max = maxItems
+	if query.Max <= 0 || query.Max > MaxBestSnapshots {
+		query.Max = MaxBestSnapshots
+	}
+	if query.MaxSlot == 0 {
+		query.MaxSlot = math.MaxUint64
+	}
+	dbQuery := index.BestSnapshotsQuery{
+		Max:      query.Max,
+		MinSlot:  query.MinSlot,
+		MaxSlot:  query.MaxSlot,
+		BaseSlot: query.BaseSlot,
 	}
-	entries := h.DB.GetBestSnapshots(query.Max)
+	if query.MaxAge > 0 {
+		dbQuery.UpdatedAfter = time.Now().Add(-query.MaxAge)
+	}
+	entries := h.DB.QueryBestSnapshots(dbQuery)
 	sources := make([]types.SnapshotSource, len(entries))
 	for i, entry := range entries {
 		sources[i] = types.SnapshotSource{
 			SnapshotInfo: *entry.Info,
 			Target:       entry.Target,
 			UpdatedAt:    entry.UpdatedAt,
+			Node:         entry.Node,
 		}
 	}
 	c.JSON(http.StatusOK, sources)
 }
+
+// GetSources returns the targets of all sources offering the snapshot with the given "slot" and "hash".
+//
+// Unlike GetBestSnapshots, the number of sources is not capped.
+// Skips sources not seen by a scrape within the "max_age" duration (e.g. "5m").
+func (h *Handler) GetSources(c *gin.Context) {
+	var query struct {
+		Slot   uint64        `form:"slot" binding:"required"`
+		Hash   string        `form:"hash" binding:"required"`
+		MaxAge time.Duration `form:"max_age"`
+	}
+	if err := c.BindQuery(&query); err != nil {
+		return
+	}
+	hash, err := solana.HashFromBase58(query.Hash)
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid hash")
+		return
+	}
+	dbQuery := index.BestSnapshotsQuery{
+		Max:     -1,
+		MinSlot: query.Slot,
+		MaxSlot: query.Slot,
+	}
+	if query.MaxAge > 0 {
+		dbQuery.UpdatedAfter = time.Now().Add(-query.MaxAge)
+	}
+	targets := make([]string, 0)
+	for _, entry := range h.DB.QueryBestSnapshots(dbQuery) {
+		if entry.Info != nil && entry.Info.Hash == hash {
+			targets = append(targets, entry.Target)
+		}
+	}
+	c.JSON(http.StatusOK, targets)
+}
@@ -27,6 +27,7 @@ import (
 // Config describes the root-level config file.
 type Config struct {
 	ScrapeInterval time.Duration  `json:"scrape_interval" yaml:"scrape_interval"`
+	ScrapeJitter   float64        `json:"scrape_jitter" yaml:"scrape_jitter"`
 	TargetGroups   []*TargetGroup `json:"target_groups" yaml:"target_groups"`
 }
 
@@ -54,9 +55,16 @@ type TargetGroup struct {
 	BearerAuth *BearerAuth `json:"bearer_auth" yaml:"bearer_auth"`
 	TLSConfig  *TLSConfig  `json:"tls_config" yaml:"tls_config"`
 
+	DefaultPort    uint16        `json:"default_port" yaml:"default_port"`
+	SidecarPort    uint16        `json:"sidecar_port" yaml:"sidecar_port"`
+	ProbeTimeout   time.Duration `json:"probe_timeout" yaml:"probe_timeout"`
+	MaxConcurrency int           `json:"max_concurrency" yaml:"max_concurrency"`
+
 	StaticTargets  *StaticTargets  `json:"static_targets" yaml:"static_targets"`
 	FileTargets    *FileTargets    `json:"file_targets" yaml:"file_targets"`
 	ConsulSDConfig *ConsulSDConfig `json:"consul_sd_config" yaml:"consul_sd_config"`
+	SRVSDConfig    *SRVSDConfig    `json:"srv_sd_config" yaml:"srv_sd_config"`
+	GossipSDConfig *GossipSDConfig `json:"gossip_sd_config" yaml:"gossip_sd_config"`
 }
 
 // StaticTargets is a hardcoded list of Solana nodes.
@@ -97,4 +105,19 @@ type ConsulSDConfig struct {
 	Datacenter string `json:"datacenter" yaml:"datacenter"`
 	Service    string `json:"service" yaml:"service"`
 	Filter     string `json:"filter" yaml:"filter"`
+	Tag        string `json:"tag" yaml:"tag"`
+
+	PassingOnly bool `json:"passing_only" yaml:"passing_only"`
+}
+
+// SRVSDConfig configures DNS SRV service discovery.
+type SRVSDConfig struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+// GossipSDConfig configures service discovery via Solana gossip.
+type GossipSDConfig struct {
+	RPCURL      string `json:"rpc_url" yaml:"rpc_url"`
+	MinPeers    int    `json:"min_peers" yaml:"min_peers"`
+	SidecarPort uint16 `json:"sidecar_port" yaml:"sidecar_port"`
 }
@@ -0,0 +1,139 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// SnapshotNameError is returned when a snapshot file name is malformed.
+type SnapshotNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *SnapshotNameError) Error() string {
+	return fmt.Sprintf("invalid snapshot file name %q: %s", e.Name, e.Reason)
+}
+
+// InProgressSuffixes mark snapshot files still being written, e.g. by a download or copy.
+//
+// A snapshot file is in progress if its name ends with one of them,
+// or while a file named like it plus one of them exists next to it.
+var InProgressSuffixes = []string{".tmp", ".partial", ".part"}
+
+// IsInProgressName returns whether the name marks a snapshot file still being written.
+func IsInProgressName(name string) bool {
+	for _, suffix := range InProgressSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSnapshotFileName parses the name of a full or incremental snapshot archive.
+//
+// Full snapshots are named "snapshot-<slot>-<hash><ext>",
+// incremental snapshots "incremental-snapshot-<base>-<slot>-<hash><ext>",
+// where ext is a double extension like ".tar.zst", ".tar.bz2" or ".tar.gz".
+func ParseSnapshotFileName(name string) (*SnapshotFile, error) {
+	invalid := func(reason string) (*SnapshotFile, error) {
+		return nil, &SnapshotNameError{Name: name, Reason: reason}
+	}
+	// Split file name into base and stem.
+	stem := name
+	var ext string
+	for i := 0; i < 2; i++ {
+		extPart := filepath.Ext(stem)
+		stem = strings.TrimSuffix(stem, extPart)
+		ext = extPart + ext
+	}
+	if IsInProgressName(name) {
+		return invalid("file still being written")
+	}
+	if strings.ContainsAny(stem, "\\/ \t\n") {
+		return invalid("contains path separator or whitespace")
+	}
+	// Parse file name fields.
+	// The incremental prefix is checked first, since it contains the full one.
+	if strings.HasPrefix(stem, "incremental-snapshot-") {
+		var baseSlot, incrementalSlot uint64
+		var hashStr string
+		n, err := fmt.Sscanf(stem, "incremental-snapshot-%d-%d-%s", &baseSlot, &incrementalSlot, &hashStr)
+		if n != 3 || err != nil {
+			return invalid("expected incremental-snapshot-<base>-<slot>-<hash>")
+		}
+		hash, err := solana.HashFromBase58(hashStr)
+		if err != nil {
+			return invalid("invalid hash")
+		}
+		if incrementalSlot <= baseSlot {
+			return invalid("slot not after base slot")
+		}
+		return &SnapshotFile{
+			FileName: name,
+			Slot:     incrementalSlot,
+			BaseSlot: baseSlot,
+			Hash:     hash,
+			Ext:      ext,
+		}, nil
+	}
+	if strings.HasPrefix(stem, "snapshot-") {
+		var slot uint64
+		var hashStr string
+		n, err := fmt.Sscanf(stem, "snapshot-%d-%s", &slot, &hashStr)
+		if n != 2 || err != nil {
+			return invalid("expected snapshot-<slot>-<hash>")
+		}
+		hash, err := solana.HashFromBase58(hashStr)
+		if err != nil {
+			return invalid("invalid hash")
+		}
+		return &SnapshotFile{
+			FileName: name,
+			Slot:     slot,
+			Hash:     hash,
+			Ext:      ext,
+		}, nil
+	}
+	return invalid("unknown prefix")
+}
+
+// BuildFileName returns the canonical file name of the snapshot,
+// such that ParseSnapshotFileName(s.BuildFileName()) yields s.
+//
+// Not called FileName() because that name is taken by the struct field.
+func (s *SnapshotFile) BuildFileName() string {
+	if s.IsFull() {
+		return fmt.Sprintf("snapshot-%d-%s%s", s.Slot, s.Hash, s.Ext)
+	}
+	return fmt.Sprintf("incremental-snapshot-%d-%d-%s%s", s.BaseSlot, s.Slot, s.Hash, s.Ext)
+}
+
+// ETag returns the HTTP entity tag of the snapshot file.
+// The slot numbers, hash and extension identify the file contents.
+func (s *SnapshotFile) ETag() string {
+	return fmt.Sprintf(`"%d-%d-%s%s"`, s.BaseSlot, s.Slot, s.Hash, s.Ext)
+}
+
+// Compression returns the compression extension of the archive (e.g. ".zst"), or "" if uncompressed.
+func (s *SnapshotFile) Compression() string {
+	return strings.TrimPrefix(s.Ext, ".tar")
+}
@@ -0,0 +1,156 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSnapshotFileName(t *testing.T) {
+	hash := solana.MustHashFromBase58("AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr")
+	cases := []struct {
+		name string
+		path string
+		file *SnapshotFile
+	}{
+		{
+			name: "FullZstd",
+			path: "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+			file: &SnapshotFile{Slot: 100, Hash: hash, Ext: ".tar.zst"},
+		},
+		{
+			name: "FullBzip2",
+			path: "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.bz2",
+			file: &SnapshotFile{Slot: 100, Hash: hash, Ext: ".tar.bz2"},
+		},
+		{
+			name: "FullGzip",
+			path: "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.gz",
+			file: &SnapshotFile{Slot: 100, Hash: hash, Ext: ".tar.gz"},
+		},
+		{
+			name: "FullUncompressed",
+			path: "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar",
+			file: &SnapshotFile{Slot: 100, Hash: hash, Ext: ".tar"},
+		},
+		{
+			name: "FullUnknownCompression",
+			path: "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.xz",
+			file: &SnapshotFile{Slot: 100, Hash: hash, Ext: ".tar.xz"},
+		},
+		{
+			name: "IncrementalZstd",
+			path: "incremental-snapshot-100-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+			file: &SnapshotFile{Slot: 200, BaseSlot: 100, Hash: hash, Ext: ".tar.zst"},
+		},
+		{
+			name: "IncrementalBzip2",
+			path: "incremental-snapshot-100-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.bz2",
+			file: &SnapshotFile{Slot: 200, BaseSlot: 100, Hash: hash, Ext: ".tar.bz2"},
+		},
+		{
+			name: "IncrementalGzip",
+			path: "incremental-snapshot-100-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.gz",
+			file: &SnapshotFile{Slot: 200, BaseSlot: 100, Hash: hash, Ext: ".tar.gz"},
+		},
+		{
+			name: "Empty",
+			path: "",
+		},
+		{
+			name: "UnknownPrefix",
+			path: "archive-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		},
+		{
+			name: "MissingHash",
+			path: "snapshot-100.tar.zst",
+		},
+		{
+			name: "InvalidSlot",
+			path: "snapshot-abc-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		},
+		{
+			name: "InvalidHash",
+			path: "snapshot-100-bad!hash.tar.zst",
+		},
+		{
+			name: "IncrementalMissingSlot",
+			path: "incremental-snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		},
+		{
+			name: "IncrementalBeforeBase",
+			path: "incremental-snapshot-300-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		},
+		{
+			name: "InProgress",
+			path: "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tmp",
+		},
+		{
+			name: "InProgressArchive",
+			path: "snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst.partial",
+		},
+		{
+			name: "PathSeparator",
+			path: "dir/snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			file, err := ParseSnapshotFileName(tc.path)
+			if tc.file == nil {
+				var nameErr *SnapshotNameError
+				require.ErrorAs(t, err, &nameErr)
+				assert.Equal(t, tc.path, nameErr.Name)
+				assert.Nil(t, file)
+				return
+			}
+			require.NoError(t, err)
+			tc.file.FileName = tc.path
+			assert.Equal(t, tc.file, file)
+
+			// Round trip through the canonical name.
+			assert.Equal(t, tc.path, file.BuildFileName())
+			again, err := ParseSnapshotFileName(file.BuildFileName())
+			require.NoError(t, err)
+			assert.Equal(t, file, again)
+		})
+	}
+}
+
+func TestSnapshotFile_Compression(t *testing.T) {
+	for ext, compression := range map[string]string{
+		".tar.zst": ".zst",
+		".tar.bz2": ".bz2",
+		".tar.gz":  ".gz",
+		".tar.xz":  ".xz",
+		".tar":     "",
+	} {
+		assert.Equal(t, compression, (&SnapshotFile{Ext: ext}).Compression(), ext)
+	}
+}
+
+func TestSnapshotFile_ETag(t *testing.T) {
+	full, err := ParseSnapshotFileName("snapshot-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst")
+	require.NoError(t, err)
+	inc, err := ParseSnapshotFileName("incremental-snapshot-100-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst")
+	require.NoError(t, err)
+	assert.Equal(t, `"0-100-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"`, full.ETag())
+	assert.Equal(t, `"100-200-AvFf9oS8A8U78HdjT9YG2sTTThLHJZmhaMn2g8vkWYnr.tar.zst"`, inc.ETag())
+}
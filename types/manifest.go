@@ -0,0 +1,75 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// ErrManifestSignature is returned when a manifest signature is missing or doesn't match.
+var ErrManifestSignature = errors.New("invalid manifest signature")
+
+// Manifest is a compact view of the snapshots known to a tracker.
+//
+// The generation increases whenever the listed snapshots change,
+// so clients can cheaply poll for changes.
+type Manifest struct {
+	Generation uint64             `json:"generation"`
+	Snapshots  []ManifestSnapshot `json:"snapshots"`
+	// Signature is the hex-encoded HMAC-SHA256 of the manifest without signature, if signed.
+	Signature string `json:"signature,omitempty"`
+}
+
+// ManifestSnapshot is a snapshot listed in a manifest, along with the targets serving it.
+type ManifestSnapshot struct {
+	Slot     uint64      `json:"slot"`
+	BaseSlot uint64      `json:"base_slot,omitempty"`
+	Hash     solana.Hash `json:"hash"`
+	Size     uint64      `json:"size"`
+	Sources  []string    `json:"sources"`
+}
+
+// Sign sets the signature of the manifest using the given key.
+func (m *Manifest) Sign(key []byte) {
+	m.Signature = hex.EncodeToString(m.mac(key))
+}
+
+// Verify checks the signature of the manifest against the given key.
+func (m *Manifest) Verify(key []byte) error {
+	sig, err := hex.DecodeString(m.Signature)
+	if err != nil || !hmac.Equal(sig, m.mac(key)) {
+		return ErrManifestSignature
+	}
+	return nil
+}
+
+func (m *Manifest) mac(key []byte) []byte {
+	unsigned := *m
+	unsigned.Signature = ""
+	// Encoding a struct is deterministic, so tracker and client compute the same payload.
+	payload, err := json.Marshal(&unsigned)
+	if err != nil {
+		panic(err)
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 Blockdaemon Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest_Sign(t *testing.T) {
+	manifest := &Manifest{
+		Generation: 3,
+		Snapshots: []ManifestSnapshot{{
+			Slot:     110,
+			BaseSlot: 100,
+			Hash:     solana.Hash{1},
+			Size:     42,
+			Sources:  []string{"10.0.0.1:13080", "[2001:db8::1]:13080"},
+		}},
+	}
+	assert.ErrorIs(t, manifest.Verify([]byte("key")), ErrManifestSignature, "unsigned")
+	manifest.Sign([]byte("key"))
+	assert.Len(t, manifest.Signature, 64)
+
+	// The signature survives a round trip through JSON.
+	buf, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	var decoded Manifest
+	require.NoError(t, json.Unmarshal(buf, &decoded))
+	assert.NoError(t, decoded.Verify([]byte("key")))
+	assert.ErrorIs(t, decoded.Verify([]byte("other")), ErrManifestSignature)
+
+	decoded.Snapshots[0].Sources = decoded.Snapshots[0].Sources[:1]
+	assert.ErrorIs(t, decoded.Verify([]byte("key")), ErrManifestSignature, "tampered")
+}
@@ -16,6 +16,8 @@ package types
 
 import (
 	"bytes"
+	"errors"
+	"sort"
 	"time"
 
 	"github.com/gagliardetto/solana-go"
@@ -26,6 +28,14 @@ type SnapshotSource struct {
 	SnapshotInfo
 	Target    string    `json:"target"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// Node is the status of the node serving the snapshot as of UpdatedAt, if known.
+	Node *NodeStatus `json:"node,omitempty"`
+}
+
+// NodeStatus describes the state of a Solana node as reported by its sidecar.
+type NodeStatus struct {
+	Slot    uint64 `json:"slot"`    // processed slot of the node
+	Healthy bool   `json:"healthy"` // whether RPC "getHealth" reports the node as caught up with the cluster
 }
 
 // SnapshotInfo describes a snapshot.
@@ -34,6 +44,8 @@ type SnapshotInfo struct {
 	Hash      solana.Hash     `json:"hash"`
 	Files     []*SnapshotFile `json:"files"`
 	TotalSize uint64          `json:"size"`
+	// GenesisHash identifies the cluster of the node serving the snapshot, if known.
+	GenesisHash *solana.Hash `json:"genesis_hash,omitempty"`
 }
 
 // SnapshotFile is a file that makes up a snapshot (either full or incremental).
@@ -46,6 +58,8 @@ type SnapshotFile struct {
 
 	ModTime *time.Time `json:"mod_time,omitempty"`
 	Size    uint64     `json:"size,omitempty"`
+	// Version is the software version of the node serving the snapshot, if known.
+	Version string `json:"version,omitempty"`
 }
 
 // IsFull returns whether the snapshot is a full snapshot.
@@ -53,21 +67,78 @@ func (s *SnapshotFile) IsFull() bool {
 	return s.BaseSlot == 0
 }
 
+// IsIncremental returns whether the snapshot is an incremental snapshot.
+func (s *SnapshotFile) IsIncremental() bool {
+	return s.BaseSlot != 0
+}
+
+// ErrZeroHash is returned for snapshot files without a known hash.
+var ErrZeroHash = errors.New("snapshot file has zero hash")
+
+// Validate checks that the snapshot file has a hash.
+func (s *SnapshotFile) Validate() error {
+	if s.Hash.IsZero() {
+		return ErrZeroHash
+	}
+	return nil
+}
+
 // Compare implements lexicographic ordering by (slot, base_slot, hash).
+// A zero hash is unknown, and compares worse than any known hash.
 func (s *SnapshotFile) Compare(o *SnapshotFile) int {
 	if s.Slot < o.Slot {
 		return -1
 	} else if s.Slot > o.Slot {
 		return +1
-	} else if s.BaseSlot != 0 && o.BaseSlot == 0 {
+	} else if s.IsIncremental() && o.IsFull() {
 		return -1
-	} else if s.BaseSlot == 0 && o.BaseSlot != 0 {
+	} else if s.IsFull() && o.IsIncremental() {
 		return +1
 	} else if s.BaseSlot < o.BaseSlot {
 		return -1
 	} else if s.BaseSlot > o.BaseSlot {
 		return +1
+	} else if s.Hash.IsZero() != o.Hash.IsZero() {
+		if s.Hash.IsZero() {
+			return -1
+		}
+		return +1
 	} else {
 		return bytes.Compare(s.Hash[:], o.Hash[:])
 	}
 }
+
+// SortSnapshots sorts snapshot files best-to-worst, as defined by Compare.
+func SortSnapshots(files []*SnapshotFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Compare(files[j]) > 0
+	})
+}
+
+// BestSnapshot returns the best snapshot file as defined by Compare, or nil if there is none.
+func BestSnapshot(files []*SnapshotFile) *SnapshotFile {
+	var best *SnapshotFile
+	for _, file := range files {
+		if best == nil || file.Compare(best) > 0 {
+			best = file
+		}
+	}
+	return best
+}
+
+// SnapshotRequest asks a sidecar for a snapshot at or after a slot.
+type SnapshotRequest struct {
+	ID        string        `json:"id"`
+	Slot      uint64        `json:"slot"`
+	Status    string        `json:"status"`
+	File      *SnapshotFile `json:"file,omitempty"`  // the snapshot, once ready
+	Error     string        `json:"error,omitempty"` // why the request failed
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// Statuses of a SnapshotRequest.
+const (
+	SnapshotRequestPending = "pending"
+	SnapshotRequestReady   = "ready"
+	SnapshotRequestFailed  = "failed"
+)
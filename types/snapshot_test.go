@@ -44,7 +44,39 @@ func TestSnapshotFile_Compare(t *testing.T) {
 		assert.Equal(t, worsee, (&SnapshotFile{Slot: 10, Hash: solana.Hash{0x69}}).Compare(&SnapshotFile{Slot: 10, Hash: solana.Hash{0x70}}))
 		assert.Equal(t, worsee, (&SnapshotFile{Slot: 10, BaseSlot: 12, Hash: solana.Hash{0x69}}).Compare(&SnapshotFile{Slot: 10, BaseSlot: 12, Hash: solana.Hash{0x70}}))
 	})
+	t.Run("ZeroHash", func(t *testing.T) {
+		// An unknown hash is worse than any known hash.
+		assert.Equal(t, worsee, (&SnapshotFile{Slot: 10}).Compare(&SnapshotFile{Slot: 10, Hash: solana.Hash{0x69}}))
+		assert.Equal(t, better, (&SnapshotFile{Slot: 10, Hash: solana.Hash{0x69}}).Compare(&SnapshotFile{Slot: 10}))
+		assert.Equal(t, worsee, (&SnapshotFile{Slot: 10, BaseSlot: 8}).Compare(&SnapshotFile{Slot: 10, BaseSlot: 8, Hash: solana.Hash{31: 0x01}}))
+		assert.Equal(t, better, (&SnapshotFile{Slot: 10, BaseSlot: 8, Hash: solana.Hash{31: 0x01}}).Compare(&SnapshotFile{Slot: 10, BaseSlot: 8}))
+		// Slots still take precedence.
+		assert.Equal(t, better, (&SnapshotFile{Slot: 12}).Compare(&SnapshotFile{Slot: 10, Hash: solana.Hash{0x69}}))
+	})
 	t.Run("Same", func(t *testing.T) {
 		assert.Equal(t, sameee, (&SnapshotFile{Slot: 10}).Compare(&SnapshotFile{Slot: 10}))
 	})
 }
+
+func TestSnapshotFile_Validate(t *testing.T) {
+	assert.ErrorIs(t, (&SnapshotFile{Slot: 10}).Validate(), ErrZeroHash)
+	assert.NoError(t, (&SnapshotFile{Slot: 10, Hash: solana.Hash{0x69}}).Validate())
+}
+
+func TestSnapshotFile_IsIncremental(t *testing.T) {
+	assert.False(t, (&SnapshotFile{Slot: 10}).IsIncremental())
+	assert.True(t, (&SnapshotFile{Slot: 10, BaseSlot: 8}).IsIncremental())
+}
+
+func TestSortSnapshots(t *testing.T) {
+	full10 := &SnapshotFile{Slot: 10}
+	inc10 := &SnapshotFile{Slot: 10, BaseSlot: 8}
+	full8 := &SnapshotFile{Slot: 8}
+	inc12 := &SnapshotFile{Slot: 12, BaseSlot: 10}
+	files := []*SnapshotFile{full8, inc10, inc12, full10}
+
+	assert.Same(t, inc12, BestSnapshot(files))
+	SortSnapshots(files)
+	assert.Equal(t, []*SnapshotFile{inc12, full10, inc10, full8}, files)
+	assert.Nil(t, BestSnapshot(nil))
+}